@@ -10,6 +10,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"nidavellir/config"
+	"nidavellir/services/janitor"
+	"nidavellir/services/notify"
 	"nidavellir/services/scheduler"
 	"nidavellir/services/store"
 )
@@ -17,11 +19,13 @@ import (
 type App struct {
 	closeCh   chan struct{}
 	scheduler scheduler.IScheduler
+	janitor   *janitor.Janitor
+	notifier  *notify.Notifier
 	server    *http.Server
 	conf      *config.Config
 }
 
-func New(server *http.Server, store *store.Postgres, manager scheduler.IScheduler, conf *config.Config) (*App, error) {
+func New(server *http.Server, store *store.Postgres, manager scheduler.IScheduler, notifier *notify.Notifier, conf *config.Config) (*App, error) {
 	setLogger()
 	if err := store.Migrate(); err != nil {
 		return nil, err
@@ -34,6 +38,8 @@ func New(server *http.Server, store *store.Postgres, manager scheduler.ISchedule
 	return &App{
 		closeCh:   make(chan struct{}),
 		scheduler: manager,
+		janitor:   janitor.New(store, conf),
+		notifier:  notifier,
 		server:    server,
 		conf:      conf,
 	}, nil
@@ -42,6 +48,7 @@ func New(server *http.Server, store *store.Postgres, manager scheduler.ISchedule
 func (a *App) Run() {
 	go a.shutdownListener()
 	go a.scheduler.Start()
+	go a.janitor.Start()
 	a.runServer()
 	<-a.closeCh
 }
@@ -74,6 +81,15 @@ func (a *App) shutdownListener() {
 
 	log.Info("Shutting down job scheduler")
 	a.scheduler.Close()
+	a.janitor.Close()
+
+	// the jobs stopped by the scheduler may still be notifying their channels
+	if a.notifier != nil {
+		log.Info("Sending pending notifications")
+		if !a.notifier.Close(a.conf.Notify.ShutdownTimeout) {
+			log.Warn("timed out sending pending notifications")
+		}
+	}
 
 	close(a.closeCh)
 }
@@ -13,14 +13,14 @@ func createAdminAccount(db *store.Postgres, conf *config.Config) error {
 	}
 
 	if len(admins) == 0 {
-		_, err = db.AddAccount(&store.Account{
-			Username: conf.Acct.Username,
-			Password: conf.Acct.Password,
-			IsAdmin:  true,
-		})
+		account, err := store.NewAccount(conf.Acct.Username, conf.Acct.Password, true)
 		if err != nil {
 			return err
 		}
+
+		if _, err = db.AddAccount(account); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -18,12 +18,26 @@ type AppConfig struct {
 	} `mapstructure:"tls"`
 	Port int `mapstructure:"port"`
 	PAT  PAT `mapstructure:"pat"`
+	// maximum number of jobs that can run concurrently
+	MaxJobs int `mapstructure:"max-jobs"`
+	// what to do with jobs which were running when the application last stopped
+	OrphanPolicy string `mapstructure:"orphan-policy"`
 }
 
+const (
+	// Orphaned jobs are marked as failed
+	OrphanFail = "fail"
+	// Orphaned jobs are queued again
+	OrphanRequeue = "requeue"
+)
+
 // Personal Access Token information
 type PAT struct {
 	Provider string `mapstructure:"provider"`
-	Token    string `mapstructure:"token"`
+	// host of the remote which the token is used with, such as a self-hosted gitlab.
+	// Defaults to the provider's public host
+	Host  string `mapstructure:"host"`
+	Token string `mapstructure:"token"`
 }
 
 func (a *AppConfig) Validate() error {
@@ -45,7 +59,21 @@ func (a *AppConfig) Validate() error {
 		}
 	}
 
+	if a.MaxJobs < 0 {
+		return errors.Errorf("expected a non-negative max-jobs but got %d", a.MaxJobs)
+	} else if a.MaxJobs == 0 {
+		a.MaxJobs = 1
+	}
+
+	a.OrphanPolicy = libs.LowerTrim(a.OrphanPolicy)
+	if a.OrphanPolicy == "" {
+		a.OrphanPolicy = OrphanFail
+	} else if !libs.IsIn(a.OrphanPolicy, []string{OrphanFail, OrphanRequeue}) {
+		return errors.Errorf("expected orphan-policy to be one of '%s' or '%s' but got '%s'", OrphanFail, OrphanRequeue, a.OrphanPolicy)
+	}
+
 	a.PAT.Provider = libs.LowerTrim(a.PAT.Provider)
+	a.PAT.Host = libs.LowerTrim(a.PAT.Host)
 	a.PAT.Token = strings.TrimSpace(a.PAT.Token)
 
 	return nil
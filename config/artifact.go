@@ -0,0 +1,82 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Artifacts are copied into a folder, such as a network mount
+	ArtifactLocal = "local"
+	// Artifacts are uploaded to an S3 compatible bucket
+	ArtifactS3 = "s3"
+)
+
+// Storage which the output and logs of every job are uploaded to once the job ends
+type ArtifactConfig struct {
+	// "local" or "s3". Empty keeps the artifacts only in the job folders
+	Backend string `mapstructure:"backend"`
+	// folder which the local backend copies the artifacts into
+	Dir string   `mapstructure:"dir"`
+	S3  S3Config `mapstructure:"s3"`
+}
+
+// S3 compatible bucket, such as AWS S3 or MinIO
+type S3Config struct {
+	// url of the S3 api, such as http://localhost:9000. Defaults to the AWS S3 endpoint
+	// of the region
+	Endpoint string `mapstructure:"endpoint"`
+	// defaults to us-east-1
+	Region string `mapstructure:"region"`
+	Bucket string `mapstructure:"bucket"`
+	// prefix added to the key of every artifact
+	Prefix    string `mapstructure:"prefix"`
+	AccessKey string `mapstructure:"access-key"`
+	SecretKey string `mapstructure:"secret-key"`
+	// addresses the bucket as part of the path instead of the host name. Most S3
+	// compatible servers need this
+	PathStyle bool `mapstructure:"path-style"`
+}
+
+func (a *ArtifactConfig) Validate() error {
+	a.Backend = strings.ToLower(strings.TrimSpace(a.Backend))
+
+	switch a.Backend {
+	case "":
+	case ArtifactLocal:
+		a.Dir = strings.TrimSpace(a.Dir)
+		if a.Dir == "" {
+			return errors.New("artifact dir must be specified for the local artifact backend")
+		}
+	case ArtifactS3:
+		return a.S3.Validate()
+	default:
+		return errors.Errorf("unknown artifact backend '%s'. Use %s or %s", a.Backend, ArtifactLocal, ArtifactS3)
+	}
+	return nil
+}
+
+func (s *S3Config) Validate() error {
+	s.Endpoint = strings.TrimRight(strings.TrimSpace(s.Endpoint), "/")
+	s.Region = strings.TrimSpace(s.Region)
+	s.Bucket = strings.TrimSpace(s.Bucket)
+	s.Prefix = strings.Trim(strings.TrimSpace(s.Prefix), "/")
+
+	if s.Bucket == "" {
+		return errors.New("s3 bucket must be specified for the s3 artifact backend")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return errors.New("s3 access-key and secret-key must be specified for the s3 artifact backend")
+	}
+
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	} else if !strings.HasPrefix(s.Endpoint, "http://") && !strings.HasPrefix(s.Endpoint, "https://") {
+		return errors.Errorf("s3 endpoint '%s' must start with http:// or https://", s.Endpoint)
+	}
+	return nil
+}
@@ -1,8 +1,50 @@
 package config
 
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Accounts managed in Nidavellir's own database
+	AuthBasic = "BASIC"
+	// Bearer tokens signed by an external server
+	AuthJWT = "JWT"
+	// API tokens created for accounts in Nidavellir's own database
+	AuthToken = "TOKEN"
+)
+
 type AuthConfig struct {
 	Type string            `mapstructure:"type"`
 	Info map[string]string `mapstructure:"info"`
 }
 
-var BasicAuth = AuthConfig{Type: "BASIC"}
+var BasicAuth = AuthConfig{Type: AuthBasic}
+
+func (a *AuthConfig) Validate() error {
+	a.Type = strings.ToUpper(strings.TrimSpace(a.Type))
+
+	switch a.Type {
+	case AuthBasic, AuthToken:
+	case AuthJWT:
+		if a.Get("publicKey") == "" && a.Get("jwks") == "" {
+			return errors.New("JWT authentication requires either the publicKey or the jwks info to be specified")
+		}
+	default:
+		return errors.Errorf("unknown authentication type: %s", a.Type)
+	}
+
+	return nil
+}
+
+// Gets the info value of the key. Keys are matched case insensitively as the
+// config loader lower cases them
+func (a *AuthConfig) Get(key string) string {
+	for k, v := range a.Info {
+		if strings.EqualFold(k, key) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
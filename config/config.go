@@ -10,10 +10,14 @@ import (
 )
 
 type Config struct {
-	Acct accountConfig `mapstructure:"account"`
-	App  AppConfig     `mapstructure:"app"`
-	Run  runConfig     `mapstructure:"run"`
-	Auth []AuthConfig  `mapstructure:"auth"`
+	Acct      accountConfig   `mapstructure:"account"`
+	App       AppConfig       `mapstructure:"app"`
+	Run       runConfig       `mapstructure:"run"`
+	Auth      []AuthConfig    `mapstructure:"auth"`
+	Notify    NotifyConfig    `mapstructure:"notify"`
+	Secret    SecretConfig    `mapstructure:"secret"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Artifact  ArtifactConfig  `mapstructure:"artifact"`
 }
 
 type IValidate interface {
@@ -39,16 +43,30 @@ func New() (*Config, error) {
 		return nil, errors.Wrap(err, "could not unmarshal config")
 	}
 
-	for _, t := range []IValidate{
+	validators := []IValidate{
 		&config.Acct,
 		&config.App,
 		&config.Run,
-	} {
+		&config.Notify,
+		&config.Secret,
+		&config.Retention,
+		&config.Artifact,
+	}
+	for i := range config.Auth {
+		validators = append(validators, &config.Auth[i])
+	}
+
+	for _, t := range validators {
 		if err := t.Validate(); err != nil {
 			return nil, err
 		}
 	}
 
+	// the work directory is only known after the app config is validated
+	if err := config.Secret.useKeyFile(filepath.Join(config.App.WorkDir, "secret.key")); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type NotifyConfig struct {
+	// maximum number of times a notification is sent before giving up
+	Attempts int `mapstructure:"attempts"`
+	// delay before the first retry. The delay doubles after every retry
+	Backoff time.Duration `mapstructure:"backoff"`
+	// time the application waits on shutdown for pending notifications to be sent
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout"`
+	SMTP            SMTPConfig    `mapstructure:"smtp"`
+}
+
+// Mail server used to send email notifications
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
+func (n *NotifyConfig) Validate() error {
+	if n.Attempts < 0 {
+		return errors.Errorf("expected a non-negative number of notification attempts but got %d", n.Attempts)
+	} else if n.Attempts == 0 {
+		n.Attempts = 3
+	}
+
+	if n.Backoff < 0 {
+		return errors.Errorf("expected a non-negative notification backoff but got %s", n.Backoff)
+	} else if n.Backoff == 0 {
+		n.Backoff = 30 * time.Second
+	}
+
+	if n.ShutdownTimeout < 0 {
+		return errors.Errorf("expected a non-negative notification shutdown timeout but got %s", n.ShutdownTimeout)
+	} else if n.ShutdownTimeout == 0 {
+		n.ShutdownTimeout = 30 * time.Second
+	}
+
+	n.SMTP.Host = strings.TrimSpace(n.SMTP.Host)
+	n.SMTP.From = strings.TrimSpace(n.SMTP.From)
+	if n.SMTP.Host != "" {
+		if n.SMTP.Port <= 0 {
+			n.SMTP.Port = 25
+		}
+		if n.SMTP.From == "" {
+			return errors.New("smtp from address must be specified when the smtp host is set")
+		}
+	}
+
+	return nil
+}
+
+// Checks if email notifications can be sent
+func (s *SMTPConfig) Enabled() bool {
+	return s.Host != ""
+}
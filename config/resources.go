@@ -0,0 +1,82 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Container resource limits of the tasks. Limits declared in the runtime config of a
+// repo take precedence over the defaults but can not exceed the caps
+type ResourceConfig struct {
+	// limits of tasks which do not declare their own
+	Default ResourceLimits `mapstructure:"default"`
+	// maximum limits of every task
+	Max ResourceLimits `mapstructure:"max"`
+}
+
+// Limits of a container. Empty or 0 values mean no limit
+type ResourceLimits struct {
+	// number of CPUs, such as 1.5
+	CPUs float64 `mapstructure:"cpus"`
+	// memory limit, such as "2GB"
+	Memory string `mapstructure:"memory"`
+	// maximum number of processes
+	Pids int64 `mapstructure:"pids"`
+	// size of /dev/shm, such as "256MB"
+	ShmSize string `mapstructure:"shm-size"`
+
+	memoryBytes  int64
+	shmSizeBytes int64
+}
+
+func (r *ResourceConfig) Validate() error {
+	if err := r.Default.Validate(); err != nil {
+		return errors.Wrap(err, "invalid default resources")
+	}
+	if err := r.Max.Validate(); err != nil {
+		return errors.Wrap(err, "invalid max resources")
+	}
+
+	for _, limit := range []struct {
+		Name         string
+		Default, Max float64
+	}{
+		{"cpus", r.Default.CPUs, r.Max.CPUs},
+		{"memory", float64(r.Default.memoryBytes), float64(r.Max.memoryBytes)},
+		{"pids", float64(r.Default.Pids), float64(r.Max.Pids)},
+		{"shm-size", float64(r.Default.shmSizeBytes), float64(r.Max.shmSizeBytes)},
+	} {
+		if limit.Max > 0 && limit.Default > limit.Max {
+			return errors.Errorf("default resource %s cannot exceed its max", limit.Name)
+		}
+	}
+
+	return nil
+}
+
+func (r *ResourceLimits) Validate() error {
+	if r.CPUs < 0 {
+		return errors.Errorf("expected a non-negative number of cpus but got %g", r.CPUs)
+	}
+	if r.Pids < 0 {
+		return errors.Errorf("expected a non-negative pids limit but got %d", r.Pids)
+	}
+
+	var err error
+	if r.memoryBytes, err = ParseSize(r.Memory); err != nil {
+		return errors.Wrap(err, "invalid memory")
+	}
+	if r.shmSizeBytes, err = ParseSize(r.ShmSize); err != nil {
+		return errors.Wrap(err, "invalid shm-size")
+	}
+	return nil
+}
+
+// Memory limit in bytes. 0 means there is no limit
+func (r *ResourceLimits) MemoryBytes() int64 {
+	return r.memoryBytes
+}
+
+// Size of /dev/shm in bytes. 0 means the docker default is used
+func (r *ResourceLimits) ShmSizeBytes() int64 {
+	return r.shmSizeBytes
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Retention policy of ended jobs. Sources can override the number of jobs and days kept
+type RetentionConfig struct {
+	// number of most recent ended jobs kept for each source. 0 keeps every job
+	KeepJobs int `mapstructure:"keep-jobs"`
+	// number of days ended jobs are kept for. 0 keeps jobs forever
+	KeepDays int `mapstructure:"keep-days"`
+	// maximum total size of the job folders, such as "20GB". The oldest ended jobs are
+	// removed once the size is exceeded. Empty for no limit
+	MaxSize string `mapstructure:"max-size"`
+	// interval between each clean up. Defaults to 1h
+	Interval time.Duration `mapstructure:"interval"`
+	// removes dangling docker images during the clean up
+	PruneImages bool `mapstructure:"prune-images"`
+
+	// max size in bytes
+	maxSizeBytes int64
+}
+
+func (r *RetentionConfig) Validate() error {
+	if r.KeepJobs < 0 {
+		return errors.Errorf("expected a non-negative retention keep-jobs but got %d", r.KeepJobs)
+	}
+	if r.KeepDays < 0 {
+		return errors.Errorf("expected a non-negative retention keep-days but got %d", r.KeepDays)
+	}
+
+	if r.Interval < 0 {
+		return errors.Errorf("expected a non-negative retention interval but got %s", r.Interval)
+	} else if r.Interval == 0 {
+		r.Interval = time.Hour
+	}
+
+	size, err := ParseSize(r.MaxSize)
+	if err != nil {
+		return errors.Wrap(err, "invalid retention max-size")
+	}
+	r.maxSizeBytes = size
+
+	return nil
+}
+
+// Maximum total size in bytes of the job folders. 0 means there is no limit
+func (r *RetentionConfig) MaxSizeBytes() int64 {
+	return r.maxSizeBytes
+}
+
+// Parses sizes such as "512MB", "20GB", "2g" or "1024" (bytes). Units are powers of
+// 1024. An empty size is 0
+func ParseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if size == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		Suffix string
+		Bytes  int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+		{"T", 1 << 40},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+		{"K", 1 << 10},
+	} {
+		if strings.HasSuffix(size, unit.Suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.Suffix))
+			multiplier = unit.Bytes
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value < 0 {
+		return 0, errors.Errorf("'%s' is not a valid size", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
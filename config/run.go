@@ -1,20 +1,59 @@
 package config
 
 import (
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// Duration jobs are limited to when max-duration is not set
+const DefaultMaxDuration = 1 * time.Hour
+
+// Delay before the first retry of a failed job when retry-delay is not set
+const DefaultRetryDelay = 1 * time.Minute
+
 type runConfig struct {
+	// maximum duration of each job. Defaults to DefaultMaxDuration
 	MaxDuration time.Duration     `mapstructure:"max-duration"`
 	BuildArgs   map[string]string `mapstructure:"build-args"`
+	Resources   ResourceConfig    `mapstructure:"resources"`
+	Security    SecurityConfig    `mapstructure:"security"`
+	// delay before the first retry of a failed job. It doubles with every further attempt.
+	// Defaults to DefaultRetryDelay
+	RetryDelay time.Duration `mapstructure:"retry-delay"`
+	// host and the existing docker networks which sources are allowed to run their tasks in
+	Networks []string `mapstructure:"networks"`
 }
 
 func (r *runConfig) Validate() error {
 	if r.MaxDuration.Nanoseconds() < 0 {
 		return errors.Errorf("expected a non-negative duration but got %+v", r.MaxDuration)
+	} else if r.MaxDuration == 0 {
+		r.MaxDuration = DefaultMaxDuration
+	}
+
+	if r.RetryDelay < 0 {
+		return errors.Errorf("expected a non-negative retry delay but got %+v", r.RetryDelay)
+	} else if r.RetryDelay == 0 {
+		r.RetryDelay = DefaultRetryDelay
+	}
+
+	if err := r.Resources.Validate(); err != nil {
+		return err
+	}
+
+	if err := r.Security.Validate(); err != nil {
+		return err
+	}
+
+	var networks []string
+	for _, n := range r.Networks {
+		if n = strings.TrimSpace(n); n != "" {
+			networks = append(networks, n)
+		}
 	}
+	r.Networks = networks
 
 	return nil
 }
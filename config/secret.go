@@ -0,0 +1,113 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"nidavellir/libs"
+)
+
+// Size in bytes of the master keys which encrypt source secrets
+const masterKeySize = 32
+
+// Master keys used to encrypt source secrets
+type SecretConfig struct {
+	// id of the current master key. Every secret records the id of the master key
+	// which encrypted it
+	KeyId string `mapstructure:"key-id"`
+	// base64 encoded 32 byte master key. Can also be set through the NIDA_SECRET_KEY
+	// environment variable
+	Key string `mapstructure:"key"`
+	// master keys which have been replaced by their id. These are kept so that secrets
+	// can be decrypted until they are re-encrypted with the current key
+	PreviousKeys map[string]string `mapstructure:"previous-keys"`
+}
+
+func (s *SecretConfig) Validate() error {
+	s.KeyId = strings.TrimSpace(s.KeyId)
+	if s.KeyId == "" {
+		s.KeyId = "default"
+	}
+
+	s.Key = strings.TrimSpace(s.Key)
+	if s.Key == "" {
+		s.Key = strings.TrimSpace(os.Getenv("NIDA_SECRET_KEY"))
+	}
+	if s.Key != "" {
+		if _, err := decodeMasterKey(s.Key); err != nil {
+			return errors.Wrap(err, "invalid secret key")
+		}
+	}
+
+	for id, key := range s.PreviousKeys {
+		if strings.EqualFold(id, s.KeyId) {
+			return errors.Errorf("previous secret key '%s' has the same id as the current key", id)
+		}
+		if _, err := decodeMasterKey(key); err != nil {
+			return errors.Wrapf(err, "invalid previous secret key '%s'", id)
+		}
+	}
+
+	return nil
+}
+
+// Uses the master key saved in the file if no key is configured. If the file does
+// not exist, a new key is generated and saved in it
+func (s *SecretConfig) useKeyFile(path string) error {
+	if s.Key != "" {
+		return nil
+	}
+
+	if libs.PathExists(path) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "could not read secret key file '%s'", path)
+		}
+
+		s.Key = strings.TrimSpace(string(content))
+		if _, err := decodeMasterKey(s.Key); err != nil {
+			return errors.Wrapf(err, "invalid secret key in '%s'", path)
+		}
+		return nil
+	}
+
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return errors.Wrap(err, "could not generate secret key")
+	}
+
+	s.Key = base64.StdEncoding.EncodeToString(key)
+	if err := ioutil.WriteFile(path, []byte(s.Key), 0600); err != nil {
+		return errors.Wrapf(err, "could not save secret key to '%s'", path)
+	}
+
+	log.Warnf("No secret key configured. Generated a new secret key at '%s'. Back it up as secrets can't be decrypted without it", path)
+	return nil
+}
+
+// Gets the decoded master keys by their id
+func (s *SecretConfig) MasterKeys() map[string][]byte {
+	keys := make(map[string][]byte, len(s.PreviousKeys)+1)
+	for id, key := range s.PreviousKeys {
+		keys[id], _ = decodeMasterKey(key)
+	}
+	keys[s.KeyId], _ = decodeMasterKey(s.Key)
+
+	return keys
+}
+
+func decodeMasterKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "key must be base64 encoded")
+	} else if len(decoded) != masterKeySize {
+		return nil, errors.Errorf("key must be %d bytes long but has %d bytes", masterKeySize, len(decoded))
+	}
+	return decoded, nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Hardening of the task containers. Sources can only tighten these settings
+type SecurityConfig struct {
+	// user and optionally the group the tasks run as, such as "1000:1000". Empty uses
+	// the user of the image
+	User string `mapstructure:"user"`
+	// mounts the repository at /repo as read-only
+	ReadOnlyRepo bool `mapstructure:"read-only-repo"`
+	// mounts the root filesystem of the containers as read-only
+	ReadOnlyRootfs bool `mapstructure:"read-only-rootfs"`
+	// path of the tmpfs mounted as a scratch space when the root filesystem is read-only.
+	// Defaults to /tmp
+	Scratch string `mapstructure:"scratch"`
+	// size of the scratch space, such as "256MB". Empty for the docker default
+	ScratchSize string `mapstructure:"scratch-size"`
+	// kernel capabilities removed from the containers, such as "ALL"
+	CapDrop []string `mapstructure:"cap-drop"`
+	// stops the tasks from gaining privileges, such as through setuid binaries
+	NoNewPrivileges bool `mapstructure:"no-new-privileges"`
+
+	scratchSizeBytes int64
+}
+
+func (s *SecurityConfig) Validate() error {
+	s.User = strings.TrimSpace(s.User)
+
+	s.Scratch = strings.TrimSpace(s.Scratch)
+	if s.Scratch == "" {
+		s.Scratch = "/tmp"
+	} else if !path.IsAbs(s.Scratch) {
+		return errors.Errorf("expected security scratch '%s' to be an absolute path", s.Scratch)
+	}
+
+	size, err := ParseSize(s.ScratchSize)
+	if err != nil {
+		return errors.Wrap(err, "invalid security scratch-size")
+	}
+	s.scratchSizeBytes = size
+
+	for i, c := range s.CapDrop {
+		s.CapDrop[i] = strings.ToUpper(strings.TrimSpace(c))
+	}
+
+	return nil
+}
+
+// Size of the scratch space in bytes. 0 means the docker default is used
+func (s *SecurityConfig) ScratchSizeBytes() int64 {
+	return s.scratchSizeBytes
+}
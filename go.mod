@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/dhui/dktest v0.3.0
 	github.com/go-chi/chi v4.0.3+incompatible
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang-migrate/migrate/v4 v4.7.1
 	github.com/hashicorp/go-multierror v1.0.0
 	github.com/jinzhu/gorm v1.9.11
@@ -14,6 +15,7 @@ require (
 	github.com/sirupsen/logrus v1.4.1
 	github.com/spf13/viper v1.6.1
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	gopkg.in/yaml.v2 v2.2.4
 )
@@ -2,16 +2,21 @@ package main
 
 import "C"
 import (
+	"flag"
 	"log"
 
 	"nidavellir/application"
 	"nidavellir/config"
 	"nidavellir/server"
+	"nidavellir/services/notify"
 	"nidavellir/services/scheduler"
 	"nidavellir/services/store"
 )
 
 func main() {
+	reencrypt := flag.Bool("reencrypt-secrets", false, "re-encrypts all source secrets with the current secret key and exits")
+	flag.Parse()
+
 	conf, err := config.New()
 	if err != nil {
 		log.Fatalln(err)
@@ -27,7 +32,20 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	sch, err := scheduler.NewScheduler(db, conf.App)
+	keyring, err := store.NewKeyring(conf.Secret.KeyId, conf.Secret.MasterKeys())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db.SetKeyring(keyring)
+
+	if *reencrypt {
+		reencryptSecrets(db)
+		return
+	}
+
+	notifier := notify.New(db, conf.Notify)
+
+	sch, err := scheduler.NewScheduler(db, notifier, conf)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -37,9 +55,22 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	app, err := application.New(srv, db, sch, conf)
+	app, err := application.New(srv, db, sch, notifier, conf)
 	if err != nil {
 		log.Fatalln(err)
 	}
 	app.Run()
 }
+
+// Re-encrypts the source secrets so that previous secret keys can be removed from the config
+func reencryptSecrets(db *store.Postgres) {
+	if err := db.Migrate(); err != nil {
+		log.Fatalln(err)
+	}
+
+	count, err := db.ReencryptSecrets()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Re-encrypted %d secrets", count)
+}
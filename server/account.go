@@ -12,14 +12,23 @@ import (
 
 type IAccountStore interface {
 	GetAccount(name string) (*store.Account, error)
+	GetAccountById(id int) (*store.Account, error)
 	AddAccount(account *store.Account) (*store.Account, error)
 	UpdateAccount(account *store.Account) (*store.Account, error)
 	RemoveAccount(id int) error
 	IsLastAdmin(id int) (bool, error)
+	GetSourceGrants(accountId int) ([]*store.SourceGrant, error)
+	SetSourceGrant(grant *store.SourceGrant) (*store.SourceGrant, error)
+	RemoveSourceGrant(accountId, sourceId int) error
+	AddApiToken(token *store.ApiToken) (*store.ApiToken, string, error)
+	GetApiTokens(accountId int) ([]*store.ApiToken, error)
+	RemoveApiToken(accountId, id int) error
 }
 
 type AccountHandler struct {
 	DB IAccountStore
+	// records changes to accounts and their source grants. Changes are not audited if nil
+	Audit IAuditStore
 }
 
 func (a *AccountHandler) AddAccount() http.HandlerFunc {
@@ -38,6 +47,7 @@ func (a *AccountHandler) AddAccount() http.HandlerFunc {
 		}
 
 		account.MaskSensitiveData()
+		audit(a.Audit, r, store.AuditCreate, store.AuditAccount, account.Id, nil, account)
 		toJson(w, account)
 	}
 }
@@ -51,11 +61,21 @@ func (a *AccountHandler) UpdateAccount() http.HandlerFunc {
 			return
 		}
 
+		before, err := a.DB.GetAccountById(payload.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		before.MaskSensitiveData()
+
 		account, err := a.DB.UpdateAccount(payload)
 		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+
+		account.MaskSensitiveData()
+		audit(a.Audit, r, store.AuditUpdate, store.AuditAccount, account.Id, before, account)
 		toJson(w, account)
 	}
 }
@@ -74,12 +94,20 @@ func (a *AccountHandler) RemoveAccount() http.HandlerFunc {
 			return
 		}
 
+		before, err := a.DB.GetAccountById(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		before.MaskSensitiveData()
+
 		err = a.DB.RemoveAccount(id)
 		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return
 		}
 
+		audit(a.Audit, r, store.AuditDelete, store.AuditAccount, id, before, nil)
 		ok(w)
 	}
 }
@@ -100,7 +128,7 @@ func (a *AccountHandler) ValidateAccount() http.HandlerFunc {
 		} else if account == nil {
 			http.Error(w, "user not found", 400)
 			return
-		} else if account.Password != payload.Password {
+		} else if !account.HasValidPassword(payload.Password) {
 			http.Error(w, "invalid credentials", 400)
 			return
 		}
@@ -109,3 +137,186 @@ func (a *AccountHandler) ValidateAccount() http.HandlerFunc {
 		toJson(w, account)
 	}
 }
+
+func (a *AccountHandler) GetSourceGrants() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		grants, err := a.DB.GetSourceGrants(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		toJson(w, grants)
+	}
+}
+
+// Gives the account a role on a source, replacing any role it had on the source
+func (a *AccountHandler) SetSourceGrant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		var grant *store.SourceGrant
+		if err := readJson(r, &grant); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		grant.AccountId = id
+
+		before, err := a.getSourceGrant(id, grant.SourceId)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		grant, err = a.DB.SetSourceGrant(grant)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		action := store.AuditUpdate
+		if before == nil {
+			action = store.AuditCreate
+		}
+		audit(a.Audit, r, action, store.AuditSourceGrant, grant.Id, before, grant)
+		toJson(w, grant)
+	}
+}
+
+func (a *AccountHandler) RemoveSourceGrant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		sourceId, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid source id").Error(), 400)
+			return
+		}
+
+		before, err := a.getSourceGrant(id, sourceId)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if err := a.DB.RemoveSourceGrant(id, sourceId); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if before != nil {
+			audit(a.Audit, r, store.AuditDelete, store.AuditSourceGrant, before.Id, before, nil)
+		}
+		ok(w)
+	}
+}
+
+// Gets the account's grant on the source. Returns nil if there is no such grant
+func (a *AccountHandler) getSourceGrant(accountId, sourceId int) (*store.SourceGrant, error) {
+	grants, err := a.DB.GetSourceGrants(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range grants {
+		if g.SourceId == sourceId {
+			copied := *g
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *AccountHandler) GetApiTokens() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		tokens, err := a.DB.GetApiTokens(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if tokens == nil {
+			tokens = []*store.ApiToken{}
+		}
+		toJson(w, tokens)
+	}
+}
+
+// Creates an api token for the account. The token is only returned in this response
+func (a *AccountHandler) AddApiToken() http.HandlerFunc {
+	type Response struct {
+		*store.ApiToken
+		Token string `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		if _, err := a.DB.GetAccountById(id); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		var token *store.ApiToken
+		if err := readJson(r, &token); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		token.AccountId = id
+
+		token, value, err := a.DB.AddApiToken(token)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		audit(a.Audit, r, store.AuditCreate, store.AuditApiToken, token.Id, nil, token)
+		toJson(w, &Response{ApiToken: token, Token: value})
+	}
+}
+
+func (a *AccountHandler) RemoveApiToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+			return
+		}
+
+		tokenId, err := strconv.Atoi(chi.URLParam(r, "tokenId"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid token id").Error(), 400)
+			return
+		}
+
+		if err := a.DB.RemoveApiToken(id, tokenId); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		audit(a.Audit, r, store.AuditDelete, store.AuditApiToken, tokenId, map[string]int{"id": tokenId, "accountId": id}, nil)
+		ok(w)
+	}
+}
@@ -1,13 +1,17 @@
 package server_test
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 
 	"nidavellir/services/store"
 )
 
 type MockAccountStore struct {
-	db map[int]*store.Account
+	db     map[int]*store.Account
+	grants []*store.SourceGrant
+	tokens []*store.ApiToken
 }
 
 func (m *MockAccountStore) GetAccount(name string) (*store.Account, error) {
@@ -19,6 +23,16 @@ func (m *MockAccountStore) GetAccount(name string) (*store.Account, error) {
 	return nil, errors.Errorf("no account with username: %s ", name)
 }
 
+func (m *MockAccountStore) GetAccountById(id int) (*store.Account, error) {
+	account, exists := m.db[id]
+	if !exists {
+		return nil, errors.Errorf("no account with id: %d", id)
+	}
+	// return a copy as handlers modify the account
+	a := *account
+	return &a, nil
+}
+
 func (m *MockAccountStore) AddAccount(account *store.Account) (*store.Account, error) {
 	err := account.Validate()
 	if err != nil {
@@ -64,3 +78,74 @@ func (m *MockAccountStore) IsLastAdmin(id int) (bool, error) {
 	}
 	return numAdmin == 1, nil
 }
+
+func (m *MockAccountStore) GetSourceGrants(accountId int) ([]*store.SourceGrant, error) {
+	var grants []*store.SourceGrant
+	for _, g := range m.grants {
+		if g.AccountId == accountId {
+			grants = append(grants, g)
+		}
+	}
+	return grants, nil
+}
+
+func (m *MockAccountStore) SetSourceGrant(grant *store.SourceGrant) (*store.SourceGrant, error) {
+	if err := grant.Validate(); err != nil {
+		return nil, err
+	} else if _, exists := m.db[grant.AccountId]; !exists {
+		return nil, errors.Errorf("no account with id: %d", grant.AccountId)
+	}
+
+	for _, g := range m.grants {
+		if g.AccountId == grant.AccountId && g.SourceId == grant.SourceId {
+			g.Role = grant.Role
+			return g, nil
+		}
+	}
+
+	grant.Id = len(m.grants) + 1
+	m.grants = append(m.grants, grant)
+	return grant, nil
+}
+
+func (m *MockAccountStore) RemoveSourceGrant(accountId, sourceId int) error {
+	for i, g := range m.grants {
+		if g.AccountId == accountId && g.SourceId == sourceId {
+			m.grants = append(m.grants[:i], m.grants[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *MockAccountStore) AddApiToken(token *store.ApiToken) (*store.ApiToken, string, error) {
+	if err := token.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	token.Id = len(m.tokens) + 1
+	value := fmt.Sprintf("%stest-%d", store.ApiTokenPrefix, token.Id)
+	token.Hash = store.HashApiToken(value)
+	m.tokens = append(m.tokens, token)
+	return token, value, nil
+}
+
+func (m *MockAccountStore) GetApiTokens(accountId int) ([]*store.ApiToken, error) {
+	var tokens []*store.ApiToken
+	for _, t := range m.tokens {
+		if t.AccountId == accountId {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MockAccountStore) RemoveApiToken(accountId, id int) error {
+	for i, t := range m.tokens {
+		if t.AccountId == accountId && t.Id == id {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Errorf("account id %d has no token with id %d", accountId, id)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,19 +16,15 @@ import (
 )
 
 func NewAccountHandler() *AccountHandler {
+	admin, _ := store.NewAccount("admin", "password", true)
+	admin.Id = 1
+
+	user, _ := store.NewAccount("user", "", false)
+	user.Id = 2
+
 	return &AccountHandler{DB: &MockAccountStore{db: map[int]*store.Account{
-		1: {
-			Id:       1,
-			Username: "admin",
-			Password: "password",
-			IsAdmin:  true,
-		},
-		2: {
-			Id:       2,
-			Username: "user",
-			Password: "",
-			IsAdmin:  false,
-		},
+		1: admin,
+		2: user,
 	}}}
 }
 
@@ -137,3 +135,103 @@ func TestAccountHandler_ValidateAccount(t *testing.T) {
 		assert.Equal(test.StatusCode, w.Code)
 	}
 }
+
+func TestAccountHandler_SourceGrants(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := NewAccountHandler()
+
+	for _, test := range []struct {
+		AccountId  string
+		Body       string
+		StatusCode int
+	}{
+		{"2", `{"sourceId": 1, "role": "operator"}`, http.StatusOK},
+		{"2", `{"sourceId": 1, "role": "editor"}`, http.StatusOK}, // replaces the previous role
+		{"2", `{"sourceId": 2, "role": "admin"}`, http.StatusBadRequest},
+		{"2", `{"sourceId": 2, "role": "owner"}`, http.StatusBadRequest},
+		{"2", `{"sourceId": 2, "role": "viewer"}`, http.StatusBadRequest}, // every account is a viewer
+		{"9", `{"sourceId": 1, "role": "viewer"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("PUT", "/", strings.NewReader(test.Body), map[string]string{"id": test.AccountId})
+		handler.SetSourceGrant()(w, r)
+		assert.Equal(test.StatusCode, w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"id": "2"})
+	handler.GetSourceGrants()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var grants []*store.SourceGrant
+	assert.NoError(readJson(w, &grants))
+	assert.Len(grants, 1)
+	assert.Equal(store.RoleEditor, grants[0].Role)
+
+	w = httptest.NewRecorder()
+	r = NewTestRequest("DELETE", "/", nil, map[string]string{"id": "2", "sourceId": "1"})
+	handler.RemoveSourceGrant()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	grants, err := handler.DB.GetSourceGrants(2)
+	assert.NoError(err)
+	assert.Empty(grants)
+}
+
+func TestAccountHandler_ApiTokens(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := NewAccountHandler()
+
+	for _, test := range []struct {
+		AccountId  string
+		Body       string
+		StatusCode int
+	}{
+		{"2", `{"name": "ci", "scopes": ["read", "trigger"]}`, http.StatusOK},
+		{"2", `{"name": "ci", "scopes": ["delete"]}`, http.StatusBadRequest},
+		{"2", `{"name": "ci", "scopes": ["read"], "expiresAt": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"9", `{"name": "ci", "scopes": ["read"]}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("POST", "/", strings.NewReader(test.Body), map[string]string{"id": test.AccountId})
+		handler.AddApiToken()(w, r)
+		assert.Equal(test.StatusCode, w.Code, w.Body.String())
+
+		if test.StatusCode == http.StatusOK {
+			var created struct {
+				Id    int    `json:"id"`
+				Token string `json:"token"`
+				Hash  string `json:"hash"`
+			}
+			assert.NoError(readJson(w, &created))
+			assert.NotEmpty(created.Token)
+			assert.Empty(created.Hash)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"id": "2"})
+	handler.GetApiTokens()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var tokens []*store.ApiToken
+	assert.NoError(readJson(w, &tokens))
+	assert.Len(tokens, 1)
+	assert.Equal(store.Scopes{store.ScopeRead, store.ScopeTrigger}, tokens[0].Scopes)
+
+	for _, test := range []struct {
+		AccountId  string
+		StatusCode int
+	}{
+		{"1", http.StatusBadRequest}, // token belongs to another account
+		{"2", http.StatusOK},
+		{"2", http.StatusBadRequest},
+	} {
+		w = httptest.NewRecorder()
+		r = NewTestRequest("DELETE", "/", nil, map[string]string{"id": test.AccountId, "tokenId": strconv.Itoa(tokens[0].Id)})
+		handler.RemoveApiToken()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"nidavellir/server/authentication"
+	"nidavellir/services/store"
+)
+
+type IAuditStore interface {
+	AddAuditLog(log *store.AuditLog) (*store.AuditLog, error)
+	GetAuditLogs(options *store.ListAuditOption) ([]*store.AuditLog, error)
+}
+
+type AuditHandler struct {
+	DB IAuditStore
+}
+
+// Gets the audit logs, latest first. The logs can be filtered by the actor, action,
+// targetType, targetId, since and until (RFC3339 times) query parameters
+func (a *AuditHandler) GetAuditLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		options, err := parseAuditOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		logs, err := a.DB.GetAuditLogs(options)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if logs == nil {
+			logs = []*store.AuditLog{}
+		}
+		toJson(w, logs)
+	}
+}
+
+func parseAuditOptions(r *http.Request) (*store.ListAuditOption, error) {
+	query := r.URL.Query()
+	options := &store.ListAuditOption{
+		Actor:      strings.TrimSpace(query.Get("actor")),
+		Action:     strings.ToUpper(strings.TrimSpace(query.Get("action"))),
+		TargetType: strings.ToUpper(strings.TrimSpace(query.Get("targetType"))),
+	}
+
+	var err error
+	if value := query.Get("targetId"); value != "" {
+		if options.TargetId, err = strconv.Atoi(value); err != nil {
+			return nil, errors.Wrapf(err, "invalid target id '%s'", value)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if options.Limit, err = strconv.Atoi(value); err != nil {
+			return nil, errors.Wrapf(err, "invalid limit '%s'", value)
+		}
+	}
+	if value := query.Get("since"); value != "" {
+		if options.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errors.Wrapf(err, "invalid since time '%s'", value)
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if options.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, errors.Wrapf(err, "invalid until time '%s'", value)
+		}
+	}
+
+	return options, nil
+}
+
+// Records the change made by the request's user. Nothing is recorded if the store is
+// nil. As the change has already been made, failures are only logged
+func audit(db IAuditStore, r *http.Request, action, targetType string, targetId int, before, after interface{}) {
+	if db == nil {
+		return
+	}
+
+	entry, err := store.NewAuditLog(authentication.Username(r.Context()), action, targetType, targetId, before, after)
+	if err == nil {
+		_, err = db.AddAuditLog(entry)
+	}
+	if err != nil {
+		log.Error(errors.Wrapf(err, "could not audit %s of %s %d", action, targetType, targetId))
+	}
+}
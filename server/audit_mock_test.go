@@ -0,0 +1,31 @@
+package server_test
+
+import (
+	"nidavellir/services/store"
+)
+
+type MockAuditStore struct {
+	logs []*store.AuditLog
+}
+
+func (m *MockAuditStore) AddAuditLog(log *store.AuditLog) (*store.AuditLog, error) {
+	if err := log.Validate(); err != nil {
+		return nil, err
+	}
+
+	log.Id = len(m.logs) + 1
+	m.logs = append(m.logs, log)
+	return log, nil
+}
+
+func (m *MockAuditStore) GetAuditLogs(options *store.ListAuditOption) ([]*store.AuditLog, error) {
+	var logs []*store.AuditLog
+	for _, log := range m.logs {
+		if (options.Actor == "" || log.Actor == options.Actor) &&
+			(options.Action == "" || log.Action == options.Action) &&
+			(options.TargetType == "" || log.TargetType == options.TargetType) {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
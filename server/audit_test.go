@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/server"
+	"nidavellir/server/authentication"
+	"nidavellir/services/store"
+)
+
+func withUser(r *http.Request, username string) *http.Request {
+	return r.WithContext(authentication.WithIdentity(r.Context(), &authentication.Identity{Username: username}))
+}
+
+func TestAuditHandler_GetAuditLogs(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	db := &MockAuditStore{}
+	for _, log := range []*store.AuditLog{
+		{Actor: "admin", Action: store.AuditCreate, TargetType: store.AuditSource, TargetId: 1},
+		{Actor: "user", Action: store.AuditTrigger, TargetType: store.AuditSource, TargetId: 1},
+	} {
+		_, err := db.AddAuditLog(log)
+		assert.NoError(err)
+	}
+	handler := AuditHandler{DB: db}
+
+	for _, test := range []struct {
+		Query      string
+		StatusCode int
+		Expected   int
+	}{
+		{"", http.StatusOK, 2},
+		{"?actor=user", http.StatusOK, 1},
+		{"?action=create&targetType=source", http.StatusOK, 1},
+		{"?actor=nobody", http.StatusOK, 0},
+		{"?since=2020-01-01T00:00:00Z&until=2030-01-01T00:00:00Z", http.StatusOK, 2},
+		{"?since=yesterday", http.StatusBadRequest, 0},
+		{"?targetId=abc", http.StatusBadRequest, 0},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/"+test.Query, nil, nil)
+		handler.GetAuditLogs()(w, r)
+		assert.Equal(test.StatusCode, w.Code, test.Query)
+
+		if test.StatusCode == http.StatusOK {
+			var logs []*store.AuditLog
+			assert.NoError(readJson(w, &logs))
+			assert.Len(logs, test.Expected, test.Query)
+		}
+	}
+}
+
+func TestSourceHandler_AuditsChanges(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	audits := &MockAuditStore{}
+	handler := NewSourceHandler()
+	handler.Audit = audits
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("PUT", "/", strings.NewReader(`{"id": 1, "key": "secret-key", "value": "new-value"}`), map[string]string{"sourceId": "1"})
+	handler.UpdateSecret()(w, withUser(r, "editor"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = NewTestRequest("DELETE", "/", nil, map[string]string{"sourceId": "1", "id": "2"})
+	handler.DeleteSecret()(w, withUser(r, "editor"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	assert.Len(audits.logs, 2)
+	update, remove := audits.logs[0], audits.logs[1]
+
+	assert.Equal("editor", update.Actor)
+	assert.Equal(store.AuditUpdate, update.Action)
+	assert.Equal(store.AuditSecret, update.TargetType)
+	assert.Equal(1, update.TargetId)
+
+	assert.Equal(store.AuditDelete, remove.Action)
+	assert.Equal(2, remove.TargetId)
+	assert.EqualValues("null", remove.After)
+
+	// secret values are never recorded
+	content, err := json.Marshal(audits.logs)
+	assert.NoError(err)
+	for _, value := range []string{"secret-value", "new-value", "some-name"} {
+		assert.NotContains(string(content), value)
+	}
+}
+
+func TestAccountHandler_AuditsChanges(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	audits := &MockAuditStore{}
+	handler := NewAccountHandler()
+	handler.Audit = audits
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("POST", "/", strings.NewReader(`{"username": "new-user", "password": "new-password"}`), nil)
+	handler.AddAccount()(w, withUser(r, "admin"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	assert.Len(audits.logs, 1)
+	log := audits.logs[0]
+	assert.Equal("admin", log.Actor)
+	assert.Equal(store.AuditCreate, log.Action)
+	assert.Equal(store.AuditAccount, log.TargetType)
+	assert.EqualValues("null", log.Before)
+	assert.Contains(string(log.After), "new-user")
+	assert.NotContains(string(log.After), "new-password")
+}
+
+func TestNotificationHandler_AuditsChanges(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	audits := &MockAuditStore{}
+	handler, _ := NewNotificationHandler()
+	handler.Audit = audits
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("POST", "/", strings.NewReader(`{"channel": "webhook", "target": "https://example.com/added", "secret": "added-secret"}`), map[string]string{"sourceId": "1"})
+	handler.AddNotification()(w, withUser(r, "editor"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = NewTestRequest("PUT", "/", strings.NewReader(`{"id": 1, "channel": "webhook", "target": "https://example.com/new", "secret": "new-secret"}`), map[string]string{"sourceId": "1"})
+	handler.UpdateNotification()(w, withUser(r, "editor"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = NewTestRequest("DELETE", "/", nil, map[string]string{"sourceId": "1", "id": "1"})
+	handler.DeleteNotification()(w, withUser(r, "editor"))
+	assert.Equal(http.StatusOK, w.Code)
+
+	assert.Len(audits.logs, 3)
+	for i, action := range []string{store.AuditCreate, store.AuditUpdate, store.AuditDelete} {
+		assert.Equal("editor", audits.logs[i].Actor)
+		assert.Equal(action, audits.logs[i].Action)
+		assert.Equal(store.AuditNotification, audits.logs[i].TargetType)
+	}
+	assert.Contains(string(audits.logs[1].Before), "https://example.com/hook")
+	assert.Contains(string(audits.logs[1].After), "https://example.com/new")
+	assert.EqualValues("null", audits.logs[2].After)
+
+	// webhook secrets are never recorded
+	content, err := json.Marshal(audits.logs)
+	assert.NoError(err)
+	for _, value := range []string{"webhook-secret", "added-secret", "new-secret"} {
+		assert.NotContains(string(content), value)
+	}
+}
@@ -0,0 +1,285 @@
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+)
+
+// Verifies bearer tokens signed by an external server
+type jwtVerifier struct {
+	// verification keys by their key id. The key from the publicKey file has an empty id
+	keys map[string]interface{}
+	// true if the keys are read from a JWKS, whose key ids are then matched
+	hasJwks  bool
+	issuer   string
+	audience string
+	// claim holding the username. Defaults to "sub"
+	usernameClaim string
+	// the account is an admin if the admin claim has (or contains) the admin value
+	adminClaim string
+	adminValue string
+}
+
+func newJwtVerifier(conf config.AuthConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{
+		keys:          make(map[string]interface{}),
+		issuer:        conf.Get("issuer"),
+		audience:      conf.Get("audience"),
+		usernameClaim: conf.Get("usernameClaim"),
+		adminClaim:    conf.Get("adminClaim"),
+		adminValue:    conf.Get("adminValue"),
+	}
+	if v.usernameClaim == "" {
+		v.usernameClaim = "sub"
+	}
+	if v.adminValue == "" {
+		v.adminValue = "true"
+	}
+
+	if path := conf.Get("publicKey"); path != "" {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		v.keys[""] = key
+	}
+
+	if path := conf.Get("jwks"); path != "" {
+		keys, err := readJwks(path)
+		if err != nil {
+			return nil, err
+		}
+		for kid, key := range keys {
+			v.keys[kid] = key
+		}
+		v.hasJwks = true
+	}
+
+	if len(v.keys) == 0 {
+		return nil, errors.New("no keys available to verify JWT")
+	}
+
+	return v, nil
+}
+
+// Verifies the token's signature and claims. The token is only valid if it has an
+// expiry and the username claim
+func (v *jwtVerifier) verify(tokenString string) (isValid bool, username string, isAdmin bool, err error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"},
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, claims, v.getKey); err != nil {
+		return false, "", false, errors.Wrap(err, "invalid JWT")
+	}
+
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return false, "", false, errors.New("JWT has no expiry or has expired")
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return false, "", false, errors.Errorf("JWT is not issued by '%s'", v.issuer)
+	}
+	if v.audience != "" && !claimHas(claims["aud"], v.audience) {
+		return false, "", false, errors.Errorf("JWT is not intended for audience '%s'", v.audience)
+	}
+
+	username, _ = claims[v.usernameClaim].(string)
+	if username = strings.TrimSpace(username); username == "" {
+		return false, "", false, errors.Errorf("JWT does not have the username claim '%s'", v.usernameClaim)
+	}
+
+	if v.adminClaim != "" {
+		isAdmin = claimHas(claims[v.adminClaim], v.adminValue)
+	}
+
+	return true, username, isAdmin, nil
+}
+
+// Selects the key matching the token's key id. Tokens without a key id are verified
+// with the publicKey, or the only key if there is just one. Without a JWKS, there are
+// no key ids to match, so every token is verified with the publicKey
+func (v *jwtVerifier) getKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, exists := v.keys[kid]
+	if !exists && !v.hasJwks {
+		key, exists = v.keys[""]
+	}
+	if !exists && kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			key, exists = k, true
+		}
+	}
+	if !exists {
+		return nil, errors.Errorf("no key found for key id '%s'", kid)
+	}
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, errors.Errorf("key '%s' can not be used with signing method %s", kid, token.Method.Alg())
+}
+
+// Checks if the claim equals the value or, if the claim is a list, contains the value
+func claimHas(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, item := range c {
+			if fmt.Sprint(item) == value {
+				return true
+			}
+		}
+		return false
+	default:
+		return fmt.Sprint(c) == value
+	}
+}
+
+// Gets the token from the "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// Reads a PEM encoded RSA or ECDSA public key
+func readPublicKey(path string) (interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read public key file '%s'", path)
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(content); err == nil {
+		return key, nil
+	}
+	return nil, errors.Errorf("'%s' is not a PEM encoded RSA or ECDSA public key", path)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Reads the signing keys from a JSON Web Key Set file. Keys which are not for
+// signing are ignored
+func readJwks(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read jwks file '%s'", path)
+	}
+
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, errors.Wrapf(err, "could not parse jwks file '%s'", path)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key '%s' in jwks file '%s'", k.Kid, path)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve '%s'", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode key parameter")
+	}
+	if len(b) == 0 {
+		return nil, errors.New("key parameter is empty")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
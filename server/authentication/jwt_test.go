@@ -0,0 +1,253 @@
+package authentication_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/config"
+	. "nidavellir/server/authentication"
+	"nidavellir/services/store"
+)
+
+type mockStore struct{}
+
+func (m *mockStore) GetAccount(username string) (*store.Account, error) {
+	return store.NewAccount(username, "password", false)
+}
+
+func (m *mockStore) GetAccountById(id int) (*store.Account, error) {
+	return nil, errors.Errorf("no account with id: %d", id)
+}
+
+func (m *mockStore) GetApiToken(_ string) (*store.ApiToken, error) {
+	return nil, errors.New("no api tokens")
+}
+
+func (m *mockStore) TouchApiToken(_ int) error {
+	return nil
+}
+
+type keys struct {
+	dir   string
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}
+
+// Creates the signing keys together with a PEM file for the RSA public key and a
+// jwks file for the ECDSA public key
+func newKeys(t *testing.T) *keys {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-jwt")
+	assert.NoError(err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NoError(err)
+	content := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "public.pem"), content, 0644))
+
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	content, err = json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": "ec-key", "use": "sig", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+			{"kty": "RSA", "kid": "enc-key", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	})
+	assert.NoError(err)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "jwks.json"), content, 0644))
+
+	return &keys{dir: dir, rsa: rsaKey, ecdsa: ecKey}
+}
+
+func (k *keys) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	var key interface{} = k.rsa
+	if _, ok := method.(*jwt.SigningMethodECDSA); ok {
+		key = k.ecdsa
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestNew_JWT(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	k := newKeys(t)
+	defer func() { _ = os.RemoveAll(k.dir) }()
+
+	conf := config.AuthConfig{
+		Type: config.AuthJWT,
+		Info: map[string]string{
+			// keys are lower cased by the config loader
+			"publickey":  filepath.Join(k.dir, "public.pem"),
+			"jwks":       filepath.Join(k.dir, "jwks.json"),
+			"issuer":     "https://sso.example.com",
+			"audience":   "nidavellir",
+			"adminclaim": "groups",
+			"adminvalue": "nida-admins",
+		},
+	}
+
+	future := time.Now().Add(time.Hour).Unix()
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub": "user",
+			"iss": "https://sso.example.com",
+			"aud": "nidavellir",
+			"exp": future,
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(c, key)
+			} else {
+				c[key] = value
+			}
+		}
+		return c
+	}
+
+	for i, test := range []struct {
+		Token     string
+		AdminOnly bool
+		Expected  int
+	}{
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(nil)), false, http.StatusOK},
+		{k.sign(t, jwt.SigningMethodES256, "ec-key", claims(nil)), false, http.StatusOK},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"aud": []string{"other", "nidavellir"}})), false, http.StatusOK},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"groups": []string{"nida-admins"}})), true, http.StatusOK},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(nil)), true, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"exp": nil})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"nbf": future})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"iss": "https://evil.example.com"})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"aud": "other"})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "", claims(jwt.MapClaims{"sub": nil})), false, http.StatusForbidden},
+		{k.sign(t, jwt.SigningMethodRS256, "unknown", claims(nil)), false, http.StatusForbidden},
+		// ECDSA token signed with a key id pointing at the RSA key
+		{k.sign(t, jwt.SigningMethodES256, "", claims(nil)), false, http.StatusForbidden},
+		{"not-a-token", false, http.StatusForbidden},
+	} {
+		handler := New(&mockStore{}, test.AdminOnly, conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+test.Token)
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, "test %d", i)
+	}
+}
+
+func TestNew_JWTPublicKeyOnly(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	k := newKeys(t)
+	defer func() { _ = os.RemoveAll(k.dir) }()
+
+	conf := config.AuthConfig{
+		Type: config.AuthJWT,
+		Info: map[string]string{"publickey": filepath.Join(k.dir, "public.pem")},
+	}
+	claims := jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// without a JWKS, the key id set by most identity providers is not matched
+	for _, kid := range []string{"", "provider-key-1"} {
+		handler := New(&mockStore{}, false, conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+k.sign(t, jwt.SigningMethodRS256, kid, claims))
+		handler.ServeHTTP(w, r)
+		assert.Equal(http.StatusOK, w.Code, kid)
+	}
+}
+
+func TestNew_BasicAndJWT(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	k := newKeys(t)
+	defer func() { _ = os.RemoveAll(k.dir) }()
+
+	jwtConf := config.AuthConfig{
+		Type: config.AuthJWT,
+		Info: map[string]string{"publicKey": filepath.Join(k.dir, "public.pem")},
+	}
+	handler := New(&mockStore{}, false, config.BasicAuth, jwtConf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token := k.sign(t, jwt.SigningMethodRS256, "", jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()})
+
+	for _, test := range []struct {
+		Setup    func(r *http.Request)
+		Expected int
+	}{
+		{func(r *http.Request) { r.SetBasicAuth("user", "password") }, http.StatusOK},
+		{func(r *http.Request) { r.SetBasicAuth("user", "wrong") }, http.StatusForbidden},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, http.StatusOK},
+		{func(r *http.Request) {}, http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		test.Setup(r)
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code)
+	}
+}
+
+func TestNew_InvalidJWTConfig(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	conf := config.AuthConfig{
+		Type: config.AuthJWT,
+		Info: map[string]string{"publicKey": "/does/not/exist.pem"},
+	}
+	handler := New(&mockStore{}, false, conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(http.StatusForbidden, w.Code)
+}
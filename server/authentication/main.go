@@ -15,12 +15,53 @@ import (
 
 type IStore interface {
 	GetAccount(username string) (*store.Account, error)
+	GetAccountById(id int) (*store.Account, error)
+	GetApiToken(value string) (*store.ApiToken, error)
+	TouchApiToken(id int) error
+}
+
+// The authenticated user of a request
+type Identity struct {
+	Username string
+	// true if the credentials themselves give admin rights, such as the admin claim
+	// of a JWT or the admin flag of the account
+	IsAdmin bool
+	// the most privileged role the credentials can use, such as the role allowed by an
+	// api token's scopes. Empty if the credentials are not limited
+	MaxRole string
+}
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+
+// Gets the authenticated user of the request. Returns nil if the request was not
+// authenticated, which is the case when no authentication is configured
+func GetIdentity(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey).(*Identity)
+	return identity
+}
+
+// Gets the username of the authenticated user. Returns an empty string if the request
+// was not authenticated
+func Username(ctx context.Context) string {
+	if identity := GetIdentity(ctx); identity != nil {
+		return identity.Username
+	}
+	return ""
+}
+
+// Adds the authenticated user to the context
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
 }
 
 type authenticator struct {
 	adminOnly bool
 	configs   []config.AuthConfig
 	db        IStore
+	// JWT verifiers by the index of their config
+	jwts map[int]*jwtVerifier
 }
 
 func New(db IStore, adminOnly bool, configs ...config.AuthConfig) func(http.Handler) http.Handler {
@@ -28,6 +69,21 @@ func New(db IStore, adminOnly bool, configs ...config.AuthConfig) func(http.Hand
 		adminOnly: adminOnly,
 		configs:   configs,
 		db:        db,
+		jwts:      make(map[int]*jwtVerifier),
+	}
+
+	for i, conf := range configs {
+		if strings.ToUpper(conf.Type) != config.AuthJWT {
+			continue
+		}
+
+		// tokens are rejected if the verifier could not be created as its config is kept
+		v, err := newJwtVerifier(conf)
+		if err != nil {
+			log.Error(errors.Wrap(err, "could not set up JWT authentication"))
+			continue
+		}
+		auth.jwts[i] = v
 	}
 
 	return auth.Next()
@@ -41,58 +97,124 @@ func (a *authenticator) Next() func(http.Handler) http.Handler {
 		}
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			isValid, username, err := a.Verify(r)
+			identity, err := a.Verify(r)
 			if err != nil {
 				log.Print(err)
 			}
 
-			if !isValid {
+			if identity == nil {
 				forbid(w, r)
 				return
 			}
 
-			ctx := r.Context()
-			context.WithValue(ctx, "username", username)
-
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
 		})
 	}
 }
 
-func (a *authenticator) Verify(r *http.Request) (isValid bool, username string, err error) {
-	for _, conf := range a.configs {
+// Verifies the request's credentials against each authentication config in turn.
+// Configs are skipped if the request does not carry their type of credentials.
+// Returns the authenticated user or nil if the credentials are not valid
+func (a *authenticator) Verify(r *http.Request) (*Identity, error) {
+	attempted := false
+
+	for i, conf := range a.configs {
+		var isValid bool
+		var identity Identity
+		var err error
+
 		switch strings.ToUpper(conf.Type) {
-		case "BASIC":
-			isValid, username, err := a.verifyBasic(r)
-			if err != nil {
-				return false, "", err
-			} else if isValid {
-				return isValid, username, nil
+		case config.AuthBasic:
+			if _, _, ok := r.BasicAuth(); !ok {
+				continue
+			}
+			isValid, identity.Username, identity.IsAdmin, err = a.verifyBasic(r)
+		case config.AuthJWT:
+			token, ok := bearerToken(r)
+			if !ok || strings.HasPrefix(token, store.ApiTokenPrefix) {
+				continue
+			}
+
+			v, exists := a.jwts[i]
+			if !exists {
+				return nil, errors.New("JWT authentication is not set up properly")
+			}
+			isValid, identity.Username, identity.IsAdmin, err = v.verify(token)
+		case config.AuthToken:
+			token, ok := apiToken(r)
+			if !ok {
+				continue
 			}
-		case "JWT":
-			log.Println("Not implemented yet")
+			isValid, identity, err = a.verifyToken(token)
 		default:
-			return false, "", errors.Errorf("Unknown authentication type: %s", conf.Type)
+			return nil, errors.Errorf("Unknown authentication type: %s", conf.Type)
+		}
+
+		attempted = true
+		if err != nil {
+			return nil, err
+		} else if isValid {
+			if a.adminOnly && !identity.IsAdmin {
+				return nil, nil
+			}
+			return &identity, nil
 		}
 	}
-	return false, "", nil
-}
 
-func (a *authenticator) verifyBasic(r *http.Request) (isValid bool, username string, err error) {
-	username, password, ok := r.BasicAuth()
-	if !ok {
-		return false, "", errors.New("Could not get authentication credentials")
+	if !attempted {
+		return nil, errors.New("Could not get authentication credentials")
 	}
+	return nil, nil
+}
+
+func (a *authenticator) verifyBasic(r *http.Request) (isValid bool, username string, isAdmin bool, err error) {
+	username, password, _ := r.BasicAuth()
 	account, err := a.db.GetAccount(username)
 	if err != nil {
-		return false, "", err
+		return false, "", false, err
+	}
+
+	return account.HasValidPassword(password), account.Username, account.IsAdmin, nil
+}
+
+// Verifies the api token. The identity is limited to the role allowed by the token's
+// scopes
+func (a *authenticator) verifyToken(value string) (isValid bool, identity Identity, err error) {
+	token, err := a.db.GetApiToken(value)
+	if err != nil {
+		return false, identity, err
+	} else if token.IsExpired() {
+		return false, identity, errors.Errorf("token '%s' has expired", token.Name)
+	}
+
+	account, err := a.db.GetAccountById(token.AccountId)
+	if err != nil {
+		return false, identity, err
+	}
+
+	if err := a.db.TouchApiToken(token.Id); err != nil {
+		log.Error(err)
+	}
+
+	identity.Username = account.Username
+	identity.MaxRole = store.ScopeRole(token.Scopes)
+	identity.IsAdmin = account.IsAdmin && identity.MaxRole == store.RoleAdmin
+	return true, identity, nil
+}
+
+// Gets the api token from the "Authorization: Token <token>" header. Bearer tokens
+// are also accepted if they have the api token prefix
+func apiToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) > 6 && strings.EqualFold(header[:6], "Token ") {
+		token := strings.TrimSpace(header[6:])
+		return token, token != ""
 	}
 
-	isValid = account.HasValidPassword(password)
-	if a.adminOnly && !account.IsAdmin {
-		isValid = false
+	if token, ok := bearerToken(r); ok && strings.HasPrefix(token, store.ApiTokenPrefix) {
+		return token, true
 	}
-	return isValid, account.Username, nil
+	return "", false
 }
 
 func forbid(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,99 @@
+package authentication_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/config"
+	. "nidavellir/server/authentication"
+	"nidavellir/services/store"
+)
+
+type tokenStore struct {
+	mockStore
+	tokens  map[string]*store.ApiToken
+	touched []int
+}
+
+func newTokenStore() *tokenStore {
+	future := time.Now().Add(time.Hour)
+	return &tokenStore{tokens: map[string]*store.ApiToken{
+		"nida_admin":   {Id: 1, AccountId: 1, Name: "admin", Scopes: store.Scopes{store.ScopeAdmin}, ExpiresAt: future},
+		"nida_read":    {Id: 2, AccountId: 1, Name: "read", Scopes: store.Scopes{store.ScopeRead}, ExpiresAt: future},
+		"nida_user":    {Id: 3, AccountId: 2, Name: "user", Scopes: store.Scopes{store.ScopeRead, store.ScopeWrite}, ExpiresAt: future},
+		"nida_expired": {Id: 4, AccountId: 2, Name: "expired", Scopes: store.Scopes{store.ScopeRead}, ExpiresAt: time.Now().Add(-time.Hour)},
+	}}
+}
+
+func (s *tokenStore) GetAccountById(id int) (*store.Account, error) {
+	switch id {
+	case 1:
+		return &store.Account{Id: 1, Username: "admin", Role: store.RoleAdmin, IsAdmin: true}, nil
+	case 2:
+		return &store.Account{Id: 2, Username: "user", Role: store.RoleEditor}, nil
+	}
+	return nil, errors.Errorf("no account with id: %d", id)
+}
+
+func (s *tokenStore) GetApiToken(value string) (*store.ApiToken, error) {
+	if token, exists := s.tokens[value]; exists {
+		return token, nil
+	}
+	return nil, errors.New("could not find token")
+}
+
+func (s *tokenStore) TouchApiToken(id int) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+func TestNew_Token(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	db := newTokenStore()
+	tokenAuth := config.AuthConfig{Type: config.AuthToken}
+
+	for _, test := range []struct {
+		Header    string
+		AdminOnly bool
+		Expected  int
+		Username  string
+		MaxRole   string
+	}{
+		{"Token nida_user", false, http.StatusOK, "user", store.RoleEditor},
+		{"Bearer nida_user", false, http.StatusOK, "user", store.RoleEditor},
+		{"token nida_admin", true, http.StatusOK, "admin", store.RoleAdmin},
+		// admins using a token without the admin scope are not admins
+		{"Token nida_read", true, http.StatusForbidden, "", ""},
+		{"Token nida_read", false, http.StatusOK, "admin", store.RoleViewer},
+		{"Token nida_expired", false, http.StatusForbidden, "", ""},
+		{"Token nida_unknown", false, http.StatusForbidden, "", ""},
+		{"Bearer not-an-api-token", false, http.StatusForbidden, "", ""},
+	} {
+		var identity *Identity
+		handler := New(db, test.AdminOnly, config.BasicAuth, tokenAuth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity = GetIdentity(r.Context())
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", test.Header)
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, test.Header)
+		if test.Expected == http.StatusOK {
+			assert.Equal(test.Username, identity.Username)
+			assert.Equal(test.MaxRole, identity.MaxRole)
+		}
+	}
+
+	assert.Contains(db.touched, 3)
+	assert.NotContains(db.touched, 4)
+}
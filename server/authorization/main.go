@@ -0,0 +1,223 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"nidavellir/server/authentication"
+	"nidavellir/services/store"
+)
+
+type IStore interface {
+	GetAccount(username string) (*store.Account, error)
+	GetSourceGrants(accountId int) ([]*store.SourceGrant, error)
+	GetJob(id int) (*store.Job, error)
+}
+
+// Gets the id of the source which the request acts on
+type SourceResolver func(r *http.Request) (int, error)
+
+// Authorizer checks that the authenticated user has the role required by the route.
+// It must be used after the authentication middleware
+type Authorizer struct {
+	db IStore
+	// if false, authentication is not configured and every request is allowed
+	enabled bool
+}
+
+func New(db IStore, enabled bool) *Authorizer {
+	return &Authorizer{db: db, enabled: enabled}
+}
+
+// Requires the user to have the role on every source
+func (a *Authorizer) Require(role string) func(http.Handler) http.Handler {
+	return a.middleware(role, nil)
+}
+
+// Requires the user to have the role on the source which the request acts on. The
+// role can come from the user's account or from a grant on the source
+func (a *Authorizer) RequireForSource(role string, resolve SourceResolver) func(http.Handler) http.Handler {
+	return a.middleware(role, resolve)
+}
+
+// Requires the user to own the account given by the url parameter or to be an admin
+func (a *Authorizer) RequireAccountOwner(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !a.enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := authentication.GetIdentity(r.Context())
+			if identity == nil {
+				forbid(w, "user is not authenticated")
+				return
+			}
+
+			id, err := strconv.Atoi(chi.URLParam(r, name))
+			if err != nil {
+				http.Error(w, errors.Wrap(err, "invalid account id").Error(), 400)
+				return
+			}
+
+			role, err := a.Role(identity, 0)
+			if err != nil {
+				log.Print(err)
+			}
+
+			if !store.HasRole(role, store.RoleAdmin) {
+				account, err := a.db.GetAccount(identity.Username)
+				if err != nil || account.Id != id {
+					forbid(w, fmt.Sprintf("user '%s' does not own account id %d", identity.Username, id))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *Authorizer) middleware(role string, resolve SourceResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !a.enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := authentication.GetIdentity(r.Context())
+			if identity == nil {
+				forbid(w, "user is not authenticated")
+				return
+			}
+
+			sourceId := 0
+			if resolve != nil {
+				id, err := resolve(r)
+				if err != nil {
+					http.Error(w, err.Error(), 400)
+					return
+				}
+				sourceId = id
+			}
+
+			userRole, err := a.Role(identity, sourceId)
+			if err != nil {
+				log.Print(err)
+			}
+
+			if !store.HasRole(userRole, role) {
+				forbid(w, fmt.Sprintf("user '%s' requires the %s role", identity.Username, role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gets the user's role on the source. If the source id is 0, gets the role the user
+// has on every source. Users without an account are viewers unless their credentials
+// make them admins. The role is limited by the credentials' max role
+func (a *Authorizer) Role(identity *authentication.Identity, sourceId int) (string, error) {
+	role, err := a.role(identity, sourceId)
+	if identity.MaxRole != "" {
+		role = store.LowerRole(role, identity.MaxRole)
+	}
+	return role, err
+}
+
+func (a *Authorizer) role(identity *authentication.Identity, sourceId int) (string, error) {
+	if identity.IsAdmin {
+		return store.RoleAdmin, nil
+	}
+
+	account, err := a.db.GetAccount(identity.Username)
+	if err != nil {
+		return store.RoleViewer, nil
+	}
+
+	role := account.Role
+	if role == "" {
+		role = store.RoleViewer
+	}
+	if sourceId <= 0 || store.HasRole(role, store.RoleAdmin) {
+		return role, nil
+	}
+
+	grants, err := a.db.GetSourceGrants(account.Id)
+	if err != nil {
+		return role, errors.Wrapf(err, "could not get source grants of '%s'", identity.Username)
+	}
+
+	for _, g := range grants {
+		if g.SourceId == sourceId {
+			role = store.HigherRole(role, g.Role)
+		}
+	}
+	return role, nil
+}
+
+// Gets the source id from the url parameter
+func URLParam(name string) SourceResolver {
+	return func(r *http.Request) (int, error) {
+		id, err := strconv.Atoi(chi.URLParam(r, name))
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid source id")
+		}
+		return id, nil
+	}
+}
+
+// Gets the source id from a field of the json body. The body is restored so that it
+// can be read again by the handler
+func JsonField(name string) SourceResolver {
+	return func(r *http.Request) (int, error) {
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return 0, errors.Wrap(err, "could not read request body")
+		}
+		_ = r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(content, &body); err != nil {
+			return 0, errors.Wrap(err, "could not parse request body")
+		}
+
+		id, ok := body[name].(float64)
+		if !ok {
+			return 0, errors.Errorf("source id '%s' not specified", name)
+		}
+		return int(id), nil
+	}
+}
+
+// Gets the source of the job specified by the url parameter
+func JobURLParam(db IStore, name string) SourceResolver {
+	return func(r *http.Request) (int, error) {
+		id, err := strconv.Atoi(chi.URLParam(r, name))
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid job id")
+		}
+
+		job, err := db.GetJob(id)
+		if err != nil {
+			return 0, err
+		}
+		return job.SourceId, nil
+	}
+}
+
+func forbid(w http.ResponseWriter, reason string) {
+	log.Print(reason)
+	http.Error(w, "user forbidden", http.StatusForbidden)
+}
@@ -0,0 +1,231 @@
+package authorization_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/server/authentication"
+	. "nidavellir/server/authorization"
+	"nidavellir/services/store"
+)
+
+type mockStore struct{}
+
+var accounts = map[string]*store.Account{
+	"admin":    {Id: 1, Username: "admin", Role: store.RoleAdmin, IsAdmin: true},
+	"viewer":   {Id: 2, Username: "viewer", Role: store.RoleViewer},
+	"operator": {Id: 3, Username: "operator", Role: store.RoleOperator},
+	"editor":   {Id: 4, Username: "editor", Role: store.RoleEditor},
+}
+
+func (m *mockStore) GetAccount(username string) (*store.Account, error) {
+	if a, exists := accounts[username]; exists {
+		return a, nil
+	}
+	return nil, errors.Errorf("no account with username: %s", username)
+}
+
+func (m *mockStore) GetSourceGrants(accountId int) ([]*store.SourceGrant, error) {
+	if accountId == 2 {
+		// viewer can edit source 1 and run jobs of source 2
+		return []*store.SourceGrant{
+			{Id: 1, AccountId: 2, SourceId: 1, Role: store.RoleEditor},
+			{Id: 2, AccountId: 2, SourceId: 2, Role: store.RoleOperator},
+		}, nil
+	}
+	return nil, nil
+}
+
+func (m *mockStore) GetJob(id int) (*store.Job, error) {
+	return &store.Job{Id: id, SourceId: id % 10}, nil
+}
+
+// Creates a router which authenticates the user from the "user" header
+func newRouter(setup func(r chi.Router)) http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username := r.Header.Get("user"); username != "" {
+				identity := &authentication.Identity{
+					Username: username,
+					IsAdmin:  r.Header.Get("admin") == "true",
+					MaxRole:  r.Header.Get("max-role"),
+				}
+				r = r.WithContext(authentication.WithIdentity(r.Context(), identity))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	setup(r)
+	return r
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestAuthorizer_Require(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	authorizer := New(&mockStore{}, true)
+	router := newRouter(func(r chi.Router) {
+		r.With(authorizer.Require(store.RoleViewer)).Get("/view", ok)
+		r.With(authorizer.Require(store.RoleOperator)).Get("/operate", ok)
+		r.With(authorizer.Require(store.RoleAdmin)).Get("/admin", ok)
+	})
+
+	for _, test := range []struct {
+		User     string
+		IsAdmin  bool
+		Path     string
+		Expected int
+	}{
+		{"viewer", false, "/view", http.StatusOK},
+		{"viewer", false, "/operate", http.StatusForbidden},
+		{"operator", false, "/operate", http.StatusOK},
+		{"editor", false, "/admin", http.StatusForbidden},
+		{"admin", false, "/admin", http.StatusOK},
+		{"sso-user", false, "/view", http.StatusOK}, // users without accounts are viewers
+		{"sso-user", false, "/operate", http.StatusForbidden},
+		{"sso-admin", true, "/admin", http.StatusOK},
+		{"", false, "/view", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", test.Path, nil)
+		r.Header.Set("user", test.User)
+		if test.IsAdmin {
+			r.Header.Set("admin", "true")
+		}
+		router.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, "%s %s", test.User, test.Path)
+	}
+}
+
+func TestAuthorizer_RequireForSource(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	db := &mockStore{}
+	authorizer := New(db, true)
+	router := newRouter(func(r chi.Router) {
+		r.With(authorizer.RequireForSource(store.RoleEditor, URLParam("sourceId"))).Delete("/source/{sourceId}", ok)
+		r.With(authorizer.RequireForSource(store.RoleEditor, JsonField("id"))).Put("/source", func(w http.ResponseWriter, r *http.Request) {
+			// body must still be readable
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(err)
+			assert.Contains(string(body), `"id"`)
+		})
+		r.With(authorizer.RequireForSource(store.RoleOperator, JobURLParam(db, "id"))).Post("/job/{id}/cancel", ok)
+	})
+
+	for _, test := range []struct {
+		User     string
+		Method   string
+		Path     string
+		Body     string
+		Expected int
+	}{
+		{"viewer", "DELETE", "/source/1", "", http.StatusOK},
+		{"viewer", "DELETE", "/source/2", "", http.StatusForbidden},
+		{"editor", "DELETE", "/source/2", "", http.StatusOK},
+		{"viewer", "DELETE", "/source/abc", "", http.StatusBadRequest},
+		{"viewer", "PUT", "/source", `{"id": 1, "name": "source"}`, http.StatusOK},
+		{"viewer", "PUT", "/source", `{"id": 3, "name": "source"}`, http.StatusForbidden},
+		{"viewer", "PUT", "/source", `{"name": "source"}`, http.StatusBadRequest},
+		{"viewer", "POST", "/job/12/cancel", "", http.StatusOK}, // job 12 is from source 2
+		{"viewer", "POST", "/job/13/cancel", "", http.StatusForbidden},
+		{"operator", "POST", "/job/13/cancel", "", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, strings.NewReader(test.Body))
+		r.Header.Set("user", test.User)
+		router.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, "%s %s %s", test.User, test.Method, test.Path)
+	}
+}
+
+func TestAuthorizer_MaxRole(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	authorizer := New(&mockStore{}, true)
+	router := newRouter(func(r chi.Router) {
+		r.With(authorizer.Require(store.RoleViewer)).Get("/view", ok)
+		r.With(authorizer.Require(store.RoleAdmin)).Get("/admin", ok)
+		r.With(authorizer.RequireForSource(store.RoleEditor, URLParam("sourceId"))).Delete("/source/{sourceId}", ok)
+	})
+
+	for _, test := range []struct {
+		User     string
+		MaxRole  string
+		Method   string
+		Path     string
+		Expected int
+	}{
+		{"admin", store.RoleViewer, "GET", "/view", http.StatusOK},
+		{"admin", store.RoleViewer, "GET", "/admin", http.StatusForbidden},
+		{"admin", store.RoleAdmin, "GET", "/admin", http.StatusOK},
+		{"viewer", store.RoleAdmin, "GET", "/admin", http.StatusForbidden},
+		{"viewer", store.RoleEditor, "DELETE", "/source/1", http.StatusOK},
+		{"viewer", store.RoleOperator, "DELETE", "/source/1", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+		r.Header.Set("user", test.User)
+		r.Header.Set("max-role", test.MaxRole)
+		router.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, "%s limited to %s %s", test.User, test.MaxRole, test.Path)
+	}
+}
+
+func TestAuthorizer_RequireAccountOwner(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	router := newRouter(func(r chi.Router) {
+		r.With(New(&mockStore{}, true).RequireAccountOwner("id")).Get("/account/{id}/tokens", ok)
+	})
+
+	for _, test := range []struct {
+		User     string
+		Path     string
+		Expected int
+	}{
+		{"viewer", "/account/2/tokens", http.StatusOK},
+		{"viewer", "/account/3/tokens", http.StatusForbidden},
+		{"admin", "/account/3/tokens", http.StatusOK},
+		{"sso-user", "/account/2/tokens", http.StatusForbidden},
+		{"viewer", "/account/abc/tokens", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", test.Path, nil)
+		r.Header.Set("user", test.User)
+		router.ServeHTTP(w, r)
+
+		assert.Equal(test.Expected, w.Code, "%s %s", test.User, test.Path)
+	}
+}
+
+func TestAuthorizer_Disabled(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	router := newRouter(func(r chi.Router) {
+		r.With(New(&mockStore{}, false).Require(store.RoleAdmin)).Get("/", ok)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, w.Code)
+}
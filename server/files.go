@@ -1,8 +1,6 @@
 package server
 
 import (
-	"io/ioutil"
-
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 
@@ -15,6 +13,8 @@ type IFileHandler interface {
 	GetImageLogs(sourceId, jobId int) (string, error)
 	GetLogContent(sourceId, jobId int) (string, error)
 	GetOutputFileList(sourceId, jobId int) ([]string, error)
+	GetLogFilePath(sourceId, jobId int) string
+	GetOutputPath(sourceId, jobId int) string
 }
 
 func newFileHandler(appFolder string) (*FileHandler, error) {
@@ -63,25 +63,35 @@ func (f *FileHandler) GetLogContent(sourceId, jobId int) (logs string, err error
 	return
 }
 
+// Lists the files in the output folder and its sub folders. The paths are relative to
+// the output folder
 func (f *FileHandler) GetOutputFileList(sourceId, jobId int) (files []string, err error) {
 	folder, err := iofiles.GetOutputDir(f.AppFolder, sourceId, jobId)
 	if err != nil {
 		return
 	}
 
-	fileInfos, err := ioutil.ReadDir(folder)
+	outputs, err := iofiles.ListFiles(folder)
 	if err != nil {
 		return
 	}
 
-	for _, file := range fileInfos {
-		if !file.IsDir() {
-			files = append(files, file.Name())
+	for _, file := range outputs {
+		if !file.IsDir {
+			files = append(files, file.Path)
 		}
 	}
 	return
 }
 
+func (f *FileHandler) GetOutputPath(sourceId, jobId int) string {
+	return iofiles.GetOutputDirPath(f.AppFolder, sourceId, jobId)
+}
+
+func (f *FileHandler) GetLogFilePath(sourceId, jobId int) string {
+	return iofiles.GetLogFilePath(f.AppFolder, sourceId, jobId)
+}
+
 func (f *FileHandler) readLog(sourceId, jobId int, forImage bool) (logs string, err error) {
 	var file *iofiles.LogFile
 
@@ -1,15 +1,21 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 
 	"nidavellir/libs"
+	"nidavellir/services/artifact"
 	"nidavellir/services/scheduler"
 	"nidavellir/services/store"
 )
@@ -17,6 +23,8 @@ import (
 type IJobStore interface {
 	GetJob(id int) (*store.Job, error)
 	GetJobs(options *store.ListJobOption) ([]*store.Job, error)
+	CountJobs(options *store.ListJobOption) (int, error)
+	GetStepRuns(jobId int) ([]*store.StepRun, error)
 }
 
 type JobInfo struct {
@@ -30,46 +38,127 @@ type JobHandler struct {
 	DB        IJobStore
 	Files     IFileHandler
 	Scheduler scheduler.IScheduler
+	// records manually triggered jobs. Triggers are not audited if nil
+	Audit IAuditStore
+	// serves the output of jobs whose folders are no longer on this host. Can be nil
+	Artifacts artifact.ArtifactStore
 }
 
+const (
+	// Number of jobs returned when no limit is given
+	DefaultJobLimit = 50
+	// Maximum number of jobs which can be requested at once
+	MaxJobLimit = 500
+)
+
+type JobList struct {
+	Jobs []*store.Job `json:"jobs"`
+	// number of jobs matching the filters, regardless of the limit and offset
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// Lists the jobs matching the query parameters
+//
+//	state     comma separated job states. Defaults to QUEUED,RUNNING
+//	sourceId  jobs of the source
+//	trigger   jobs started by the trigger
+//	since     jobs initialized at or after the RFC3339 time
+//	until     jobs initialized before the RFC3339 time
+//	limit     number of jobs to return. Defaults to 50 with a maximum of 500
+//	offset    number of jobs to skip
+//	sort      id, initTime, startTime or endTime. Prefix with "-" to sort descending
 func (j *JobHandler) GetJobs() http.HandlerFunc {
-	checkInvalidStates := func(states []string) string {
-		var invalidStates []string
-		for _, state := range states {
-			if libs.IsIn(state, []string{store.JobRunning, store.JobQueued, store.JobFailure, store.JobSuccess}) {
-				invalidStates = append(invalidStates, state)
-			}
+	return func(w http.ResponseWriter, r *http.Request) {
+		options, err := parseJobOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		jobs, err := j.DB.GetJobs(options)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		total, err := j.DB.CountJobs(options)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
 		}
-		if len(invalidStates) == 0 {
-			return ""
+
+		if jobs == nil {
+			jobs = []*store.Job{}
 		}
-		return fmt.Sprintf("Invalid states: %s", strings.Join(invalidStates, ", "))
+		toJson(w, &JobList{Jobs: jobs, Total: total, Limit: options.Limit, Offset: options.Offset})
+	}
+}
+
+func parseJobOptions(r *http.Request) (*store.ListJobOption, error) {
+	query := r.URL.Query()
+	options := &store.ListJobOption{
+		Trigger: libs.UpperTrim(query.Get("trigger")),
+		Limit:   DefaultJobLimit,
 	}
 
-	getStates := func(r *http.Request) []string {
-		states := strings.Split(r.URL.Query().Get("state"), ",")
-		if len(states) == 0 {
-			states = append(states, store.JobQueued, store.JobRunning)
+	validStates := []string{store.JobQueued, store.JobRunning, store.JobSuccess, store.JobFailure, store.JobCancelled}
+	var invalidStates []string
+	for _, state := range strings.Split(query.Get("state"), ",") {
+		if state = libs.UpperTrim(state); state == "" {
+			continue
+		} else if !libs.IsIn(state, validStates) {
+			invalidStates = append(invalidStates, state)
+		} else if !libs.IsIn(state, options.State) {
+			options.State = append(options.State, state)
 		}
-		return states
+	}
+	if len(invalidStates) > 0 {
+		return nil, errors.Errorf("Invalid states: %s", strings.Join(invalidStates, ", "))
+	}
+	if len(options.State) == 0 {
+		options.State = []string{store.JobQueued, store.JobRunning}
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		states := getStates(r)
-		if msg := checkInvalidStates(states); msg != "" {
-			http.Error(w, msg, 400)
-			return
+	var err error
+	for name, value := range map[string]*int{
+		"sourceId": &options.SourceId,
+		"limit":    &options.Limit,
+		"offset":   &options.Offset,
+	} {
+		if text := query.Get(name); text != "" {
+			if *value, err = strconv.Atoi(text); err != nil || *value < 0 {
+				return nil, errors.Errorf("invalid %s '%s'", name, text)
+			}
 		}
+	}
+	if options.Limit == 0 {
+		return nil, errors.New("limit must be at least 1")
+	} else if options.Limit > MaxJobLimit {
+		options.Limit = MaxJobLimit
+	}
 
-		jobs, err := j.DB.GetJobs(&store.ListJobOption{
-			State: states,
-		})
-		if err != nil {
-			http.Error(w, err.Error(), 400)
-			return
+	for name, value := range map[string]*time.Time{
+		"since": &options.Since,
+		"until": &options.Until,
+	} {
+		if text := query.Get(name); text != "" {
+			if *value, err = time.Parse(time.RFC3339, text); err != nil {
+				return nil, errors.Wrapf(err, "invalid %s time '%s'", name, text)
+			}
+		}
+	}
+
+	if sort := strings.TrimSpace(query.Get("sort")); sort != "" {
+		options.Descending = strings.HasPrefix(sort, "-")
+		options.SortBy = strings.TrimPrefix(sort, "-")
+		if !libs.IsIn(options.SortBy, []string{store.JobSortId, store.JobSortInitTime, store.JobSortStartTime, store.JobSortEndTime}) {
+			return nil, errors.Errorf("cannot sort jobs by '%s'", options.SortBy)
 		}
-		toJson(w, jobs)
 	}
+
+	return options, nil
 }
 
 func (j *JobHandler) GetJobInfo() http.HandlerFunc {
@@ -103,6 +192,164 @@ func (j *JobHandler) GetJobInfo() http.HandlerFunc {
 	}
 }
 
+// Gets the execution records of each step and task in the job
+func (j *JobHandler) GetJobTasks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrapf(err, "invalid job id '%s'", chi.URLParam(r, "id")).Error(), 400)
+			return
+		}
+
+		if _, err := j.DB.GetJob(id); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		runs, err := j.DB.GetStepRuns(id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		toJson(w, runs)
+	}
+}
+
+// Interval between each check for new log lines when streaming logs
+var logStreamInterval = 500 * time.Millisecond
+
+// Streams the job's logs as Server-Sent Events. Each log line is sent as a message and
+// the stream ends with an "end" event carrying the final job state once the job ends
+func (j *JobHandler) StreamLogs() http.HandlerFunc {
+	isDone := func(state string) bool {
+		return libs.IsIn(state, []string{store.JobSuccess, store.JobFailure, store.JobCancelled})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrapf(err, "invalid job id '%s'", chi.URLParam(r, "id")).Error(), 400)
+			return
+		}
+
+		job, err := j.DB.GetJob(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", 500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		tail := &logTail{path: j.Files.GetLogFilePath(job.SourceId, job.Id)}
+		defer tail.Close()
+
+		ticker := time.NewTicker(logStreamInterval)
+		defer ticker.Stop()
+
+		// the final logs are written after the job ends, so they are read on the tick after
+		// the job is seen to have ended
+		done := false
+		for {
+			lines, err := tail.ReadLines(done)
+			if err != nil {
+				writeEvent(w, "error", err.Error())
+				flusher.Flush()
+				return
+			}
+			for _, line := range lines {
+				writeEvent(w, "", line)
+			}
+
+			if done {
+				writeEvent(w, "end", job.State)
+				flusher.Flush()
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+
+			if job, err = j.DB.GetJob(id); err != nil {
+				writeEvent(w, "error", err.Error())
+				flusher.Flush()
+				return
+			}
+			done = isDone(job.State)
+		}
+	}
+}
+
+// Reads the lines appended to a log file since the last read
+type logTail struct {
+	path    string
+	file    *os.File
+	partial []byte
+}
+
+// Reads the complete lines added to the file since the last read. If all is true, the
+// last incomplete line is returned as well. The file may not exist yet if the job is queued
+func (t *logTail) ReadLines(all bool) ([]string, error) {
+	if t.file == nil {
+		file, err := os.Open(t.path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not open log file")
+		}
+		t.file = file
+	}
+
+	content, err := ioutil.ReadAll(t.file)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read log file")
+	}
+	content = append(t.partial, content...)
+
+	index := bytes.LastIndexByte(content, '\n')
+	if all {
+		index = len(content) - 1
+	}
+	if index < 0 {
+		t.partial = content
+		return nil, nil
+	}
+	t.partial = append([]byte{}, content[index+1:]...)
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(content[:index+1]), "\n"), "\n") {
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	return lines, nil
+}
+
+func (t *logTail) Close() {
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+}
+
+// Writes a Server-Sent Event. Messages without an event name are received as "message" events
+func writeEvent(w io.Writer, event, data string) {
+	if event != "" {
+		_, _ = fmt.Fprintf(w, "event: %s\n", event)
+	}
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
 // Inserts a job to the top of the queue
 func (j *JobHandler) InsertJob() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +365,30 @@ func (j *JobHandler) InsertJob() http.HandlerFunc {
 			return
 		}
 
+		audit(j.Audit, r, store.AuditTrigger, store.AuditSource, sourceId, nil, map[string]string{"trigger": store.TriggerManual})
+		ok(w)
+	}
+}
+
+// Cancels a queued or running job
+func (j *JobHandler) CancelJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrapf(err, "invalid job id '%s'", chi.URLParam(r, "id")).Error(), 400)
+			return
+		}
+
+		if _, err := j.DB.GetJob(id); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if err := j.Scheduler.CancelJob(id); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
 		ok(w)
 	}
 }
@@ -1,8 +1,14 @@
 package server_test
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
 	"github.com/pkg/errors"
 
+	"nidavellir/libs"
 	"nidavellir/services/store"
 )
 
@@ -18,16 +24,67 @@ func (m *MockJobStore) GetJob(id int) (*store.Job, error) {
 	}
 }
 
-func (m *MockJobStore) GetJobs(_ *store.ListJobOption) ([]*store.Job, error) {
+func (m *MockJobStore) GetJobs(options *store.ListJobOption) ([]*store.Job, error) {
+	jobs := m.filter(options)
+	sort.Slice(jobs, func(i, j int) bool {
+		if options.Descending {
+			return jobs[i].Id > jobs[j].Id
+		}
+		return jobs[i].Id < jobs[j].Id
+	})
+
+	if options.Offset >= len(jobs) {
+		return nil, nil
+	}
+	jobs = jobs[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(jobs) {
+		jobs = jobs[:options.Limit]
+	}
+	return jobs, nil
+}
+
+func (m *MockJobStore) CountJobs(options *store.ListJobOption) (int, error) {
+	return len(m.filter(options)), nil
+}
+
+func (m *MockJobStore) filter(options *store.ListJobOption) []*store.Job {
 	var jobs []*store.Job
 	for _, job := range m.db {
-		jobs = append(jobs, job)
+		if (len(options.State) == 0 || libs.IsIn(job.State, options.State)) &&
+			(options.SourceId == 0 || job.SourceId == options.SourceId) &&
+			(options.Since.IsZero() || !job.InitTime.Before(options.Since)) &&
+			(options.Until.IsZero() || job.InitTime.Before(options.Until)) {
+			jobs = append(jobs, job)
+		}
 	}
+	return jobs
+}
 
-	return jobs, nil
+func (m *MockJobStore) GetStepRuns(jobId int) ([]*store.StepRun, error) {
+	job, err := m.GetJob(jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*store.StepRun{
+		{
+			Id:        1,
+			JobId:     job.Id,
+			Name:      "Extraction",
+			StartTime: job.StartTime,
+			EndTime:   job.EndTime,
+			Tasks: []store.TaskRun{
+				{Id: 1, StepRunId: 1, JobId: job.Id, Name: "Extract A", StartTime: job.StartTime, EndTime: job.EndTime},
+				{Id: 2, StepRunId: 1, JobId: job.Id, Name: "Extract B", StartTime: job.StartTime, EndTime: job.EndTime},
+			},
+		},
+	}, nil
 }
 
-type MockFileHandler struct{}
+type MockFileHandler struct {
+	// folder which is served as the output of every job
+	OutputDir string
+}
 
 func (m *MockFileHandler) GetAll(sourceId, jobId int) (logs, imageLogs string, files []string, err error) {
 	logs, _ = m.GetLogContent(sourceId, jobId)
@@ -44,6 +101,14 @@ func (m *MockFileHandler) GetLogContent(_, _ int) (string, error) {
 	return "Some Job Logs", nil
 }
 
+func (m *MockFileHandler) GetLogFilePath(sourceId, jobId int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("nida-mock-%d-%d-logs.txt", sourceId, jobId))
+}
+
+func (m *MockFileHandler) GetOutputPath(_, _ int) string {
+	return m.OutputDir
+}
+
 func (m *MockFileHandler) GetOutputFileList(_, _ int) ([]string, error) {
 	return []string{"file1", "file2"}, nil
 }
@@ -61,6 +126,13 @@ func (m *MockJobScheduler) AddJob(sourceId int, _ string) error {
 	return nil
 }
 
+func (m *MockJobScheduler) CancelJob(jobId int) error {
+	if jobId%2 == 0 {
+		return errors.New("mock error: job is not queued or running")
+	}
+	return nil
+}
+
 func (m *MockJobScheduler) Start() {
 }
 
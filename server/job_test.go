@@ -1,8 +1,11 @@
 package server_test
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -45,28 +48,43 @@ func TestJobHandler_GetJobs(t *testing.T) {
 	handler := NewJobHandler()
 
 	for _, test := range []struct {
-		States []string
+		Query      string
+		StatusCode int
+		Total      int
+		Count      int
+		FirstId    int
 	}{
-		{nil},
-		{[]string{store.JobQueued}},
-		{[]string{store.JobRunning}},
+		{"", http.StatusOK, 14, 14, 1}, // defaults to queued and running jobs
+		{"?state=success", http.StatusOK, 4, 4, 5},
+		{"?state=SUCCESS,FAILURE", http.StatusOK, 6, 6, 5},
+		{"?state=queued&limit=3&offset=2", http.StatusOK, 10, 3, 3},
+		{"?state=queued&offset=20", http.StatusOK, 10, 0, 0},
+		{"?sourceId=1", http.StatusOK, 7, 7, 1},
+		{"?sort=-id&limit=1", http.StatusOK, 14, 1, 20},
+		{"?limit=1000", http.StatusOK, 14, 14, 1},
+		{"?state=bad", http.StatusBadRequest, 0, 0, 0},
+		{"?sort=name", http.StatusBadRequest, 0, 0, 0},
+		{"?limit=0", http.StatusBadRequest, 0, 0, 0},
+		{"?offset=-1", http.StatusBadRequest, 0, 0, 0},
+		{"?since=yesterday", http.StatusBadRequest, 0, 0, 0},
 	} {
 		w := httptest.NewRecorder()
-		r := NewTestRequest("GET", "/", nil, nil)
-		if len(test.States) > 0 {
-			r.URL.Query().Add("states", strings.Join(test.States, ","))
-		}
+		r := NewTestRequest("GET", "/"+test.Query, nil, nil)
 
 		handler.GetJobs()(w, r)
-		assert.Equal(http.StatusOK, w.Code)
-
-		var jobs []*store.Job
-		err := readJson(w, &jobs)
-		assert.NoError(err)
-		assert.IsType([]*store.Job{}, jobs)
-		assert.Condition(func() bool {
-			return len(jobs) > 0
-		})
+		assert.Equal(test.StatusCode, w.Code, test.Query)
+		if test.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var list *JobList
+		assert.NoError(readJson(w, &list))
+		assert.Equal(test.Total, list.Total, test.Query)
+		assert.Len(list.Jobs, test.Count, test.Query)
+		assert.True(list.Limit > 0 && list.Limit <= MaxJobLimit)
+		if test.Count > 0 {
+			assert.Equal(test.FirstId, list.Jobs[0].Id, test.Query)
+		}
 	}
 }
 
@@ -99,6 +117,83 @@ func TestJobHandler_GetJobInfo(t *testing.T) {
 	}
 }
 
+func TestJobHandler_GetJobTasks(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := NewJobHandler()
+
+	for _, test := range []struct {
+		Id         string
+		StatusCode int
+	}{
+		{"abc", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+		{"1", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/", nil, map[string]string{
+			"id": test.Id,
+		})
+
+		handler.GetJobTasks()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+		if test.Id == "abc" {
+			assert.Contains(w.Body.String(), "invalid job id 'abc'")
+		}
+
+		if test.StatusCode == http.StatusOK {
+			var runs []*store.StepRun
+			err := readJson(w, &runs)
+			assert.NoError(err)
+			assert.NotEmpty(runs)
+			assert.NotEmpty(runs[0].Tasks)
+		}
+	}
+}
+
+func TestJobHandler_StreamLogs(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := NewJobHandler()
+
+	// job 5 has ended, so the stream sends all its logs and closes
+	job, err := handler.DB.GetJob(5)
+	assert.NoError(err)
+	path := handler.Files.GetLogFilePath(job.SourceId, job.Id)
+	err = ioutil.WriteFile(path, []byte("[Step | Task A] line 1\n[Step | Task B] line 2\nlast line"), 0666)
+	assert.NoError(err)
+	defer func() { _ = os.Remove(path) }()
+
+	for _, test := range []struct {
+		Id         string
+		StatusCode int
+	}{
+		{"abc", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+		{"5", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/", nil, map[string]string{
+			"id": test.Id,
+		})
+
+		handler.StreamLogs()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+		if test.Id == "abc" {
+			assert.Contains(w.Body.String(), "invalid job id 'abc'")
+		}
+
+		if test.StatusCode == http.StatusOK {
+			assert.Equal("text/event-stream", w.Header().Get("Content-Type"))
+			body := w.Body.String()
+			assert.Contains(body, "data: [Step | Task A] line 1\n\n")
+			assert.Contains(body, "data: [Step | Task B] line 2\n\n")
+			assert.Contains(body, "data: last line\n\n")
+			assert.True(strings.HasSuffix(body, fmt.Sprintf("event: end\ndata: %s\n\n", job.State)))
+		}
+	}
+}
+
 func TestJobHandler_InsertJob(t *testing.T) {
 	t.Parallel()
 	assert := require.New(t)
@@ -110,3 +205,28 @@ func TestJobHandler_InsertJob(t *testing.T) {
 	handler.InsertJob()(w, r)
 	assert.Equal(http.StatusOK, w.Code)
 }
+
+func TestJobHandler_CancelJob(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := NewJobHandler()
+
+	for _, test := range []struct {
+		Id         string
+		StatusCode int
+	}{
+		{"abc", http.StatusBadRequest}, // invalid id
+		{"999", http.StatusBadRequest}, // job does not exist
+		{"2", http.StatusBadRequest},   // job could not be cancelled
+		{"1", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("POST", "/cancel", nil, map[string]string{"id": test.Id})
+
+		handler.CancelJob()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+		if test.Id == "abc" {
+			assert.Contains(w.Body.String(), "invalid job id 'abc'")
+		}
+	}
+}
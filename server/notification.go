@@ -0,0 +1,167 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"nidavellir/services/store"
+)
+
+type INotificationStore interface {
+	AddNotification(notification *store.Notification) (*store.Notification, error)
+	GetNotification(id int) (*store.Notification, error)
+	GetNotifications(sourceId int) ([]*store.Notification, error)
+	UpdateNotification(notification *store.Notification) (*store.Notification, error)
+	RemoveNotification(id int) error
+	GetNotificationDeliveries(notificationId int) ([]*store.NotificationDelivery, error)
+}
+
+type NotificationHandler struct {
+	DB INotificationStore
+	// records changes to notifications. Changes are not audited if nil
+	Audit IAuditStore
+}
+
+func (n *NotificationHandler) GetNotifications() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sourceId, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid source id").Error(), 400)
+			return
+		}
+
+		notifications, err := n.DB.GetNotifications(sourceId)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		for _, notification := range notifications {
+			hideNotificationSecret(notification)
+		}
+		toJson(w, notifications)
+	}
+}
+
+func (n *NotificationHandler) AddNotification() http.HandlerFunc {
+	return n.createAddUpdateNotificationHandler(true)
+}
+
+// Updates the notification. The existing webhook secret is kept if no secret is given
+func (n *NotificationHandler) UpdateNotification() http.HandlerFunc {
+	return n.createAddUpdateNotificationHandler(false)
+}
+
+func (n *NotificationHandler) createAddUpdateNotificationHandler(isCreate bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sourceId, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid source id").Error(), 400)
+			return
+		}
+
+		var notification *store.Notification
+		if err := readJson(r, &notification); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		notification.SourceId = sourceId
+
+		var before *store.Notification
+		action := store.AuditCreate
+		if isCreate {
+			notification, err = n.DB.AddNotification(notification)
+		} else {
+			action = store.AuditUpdate
+			existing, getErr := n.DB.GetNotification(notification.Id)
+			if getErr != nil {
+				http.Error(w, getErr.Error(), 400)
+				return
+			} else if existing.SourceId != sourceId {
+				http.Error(w, "notification does not belong to the source", 400)
+				return
+			}
+			if notification.Secret == "" {
+				notification.Secret = existing.Secret
+			}
+			before = hideNotificationSecret(existing)
+			notification, err = n.DB.UpdateNotification(notification)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		// webhook secrets are never audited
+		hideNotificationSecret(notification)
+		audit(n.Audit, r, action, store.AuditNotification, notification.Id, before, notification)
+		toJson(w, notification)
+	}
+}
+
+func (n *NotificationHandler) DeleteNotification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notification, err := n.getSourceNotification(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		if err := n.DB.RemoveNotification(notification.Id); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		audit(n.Audit, r, store.AuditDelete, store.AuditNotification, notification.Id, hideNotificationSecret(notification), nil)
+		ok(w)
+	}
+}
+
+// Gets the record of every attempt to send the notification
+func (n *NotificationHandler) GetDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notification, err := n.getSourceNotification(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		deliveries, err := n.DB.GetNotificationDeliveries(notification.Id)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		toJson(w, deliveries)
+	}
+}
+
+// Gets the notification specified in the route, checking that it belongs to the source
+func (n *NotificationHandler) getSourceNotification(r *http.Request) (*store.Notification, error) {
+	sourceId, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid source id")
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid notification id")
+	}
+
+	notification, err := n.DB.GetNotification(id)
+	if err != nil {
+		return nil, err
+	} else if notification.SourceId != sourceId {
+		return nil, errors.New("notification does not belong to the source")
+	}
+	return notification, nil
+}
+
+// Webhook secrets are never returned by the api
+func hideNotificationSecret(notification *store.Notification) *store.Notification {
+	notification.Secret = ""
+	return notification
+}
@@ -0,0 +1,72 @@
+package server_test
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/services/store"
+)
+
+type MockNotificationStore struct {
+	db map[int]*store.Notification
+}
+
+func (m *MockNotificationStore) AddNotification(notification *store.Notification) (*store.Notification, error) {
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+
+	notification.Id = len(m.db) + 1
+	m.db[notification.Id] = notification
+	return notification, nil
+}
+
+func (m *MockNotificationStore) GetNotification(id int) (*store.Notification, error) {
+	if notification, exist := m.db[id]; !exist {
+		return nil, errors.Errorf("no notification with id %d", id)
+	} else {
+		// return a copy as handlers modify the notification
+		n := *notification
+		return &n, nil
+	}
+}
+
+func (m *MockNotificationStore) GetNotifications(sourceId int) ([]*store.Notification, error) {
+	var notifications []*store.Notification
+	for _, n := range m.db {
+		if n.SourceId == sourceId {
+			notification := *n
+			notifications = append(notifications, &notification)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *MockNotificationStore) UpdateNotification(notification *store.Notification) (*store.Notification, error) {
+	if _, exists := m.db[notification.Id]; !exists {
+		return nil, errors.New("id does not exist")
+	}
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+
+	n := *notification
+	m.db[notification.Id] = &n
+	return notification, nil
+}
+
+func (m *MockNotificationStore) RemoveNotification(id int) error {
+	if _, exists := m.db[id]; !exists {
+		return errors.Errorf("id %d does not exists", id)
+	}
+	delete(m.db, id)
+	return nil
+}
+
+func (m *MockNotificationStore) GetNotificationDeliveries(notificationId int) ([]*store.NotificationDelivery, error) {
+	return []*store.NotificationDelivery{
+		{Id: 2, NotificationId: notificationId, JobId: 1, Attempt: 2, Time: time.Now(), Success: true},
+		{Id: 1, NotificationId: notificationId, JobId: 1, Attempt: 1, Time: time.Now(), Error: "received status 500"},
+	}, nil
+}
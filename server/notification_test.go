@@ -0,0 +1,140 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/server"
+	"nidavellir/services/store"
+)
+
+func NewNotificationHandler() (*NotificationHandler, *MockNotificationStore) {
+	db := &MockNotificationStore{db: map[int]*store.Notification{
+		1: {
+			Id:       1,
+			SourceId: 1,
+			Channel:  store.ChannelWebhook,
+			Target:   "https://example.com/hook",
+			Secret:   "webhook-secret",
+			NotifyOn: store.NotifyAlways,
+		},
+		2: {
+			Id:       2,
+			SourceId: 2,
+			Channel:  store.ChannelEmail,
+			Target:   "team@example.com",
+			NotifyOn: store.NotifyOnFailure,
+		},
+	}}
+
+	return &NotificationHandler{DB: db}, db
+}
+
+func TestNotificationHandler_GetNotifications(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, _ := NewNotificationHandler()
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"sourceId": "1"})
+
+	handler.GetNotifications()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var notifications []*store.Notification
+	err := readJson(w, &notifications)
+	assert.NoError(err)
+	assert.Len(notifications, 1)
+	assert.Empty(notifications[0].Secret)
+}
+
+func TestNotificationHandler_AddNotification(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, _ := NewNotificationHandler()
+
+	for _, test := range []struct {
+		Body       string
+		StatusCode int
+	}{
+		{`{"channel": "slack", "target": "https://hooks.slack.com/services/abc", "notifyOn": "recovery"}`, http.StatusOK},
+		{`{"channel": "email", "target": "a@example.com, b@example.com"}`, http.StatusOK},
+		{`{"channel": "email", "target": "not an email"}`, http.StatusBadRequest},
+		{`{"channel": "pager", "target": "https://example.com"}`, http.StatusBadRequest},
+		{`{"channel": "webhook", "target": "https://example.com", "notifyOn": "sometimes"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("POST", "/", strings.NewReader(test.Body), map[string]string{"sourceId": "1"})
+
+		handler.AddNotification()(w, r)
+		assert.Equal(test.StatusCode, w.Code, w.Body.String())
+	}
+}
+
+func TestNotificationHandler_UpdateNotification(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, db := NewNotificationHandler()
+
+	for _, test := range []struct {
+		SourceId   string
+		Body       string
+		StatusCode int
+	}{
+		{"1", `{"id": 1, "channel": "webhook", "target": "https://example.com/new", "notifyOn": "failure"}`, http.StatusOK},
+		{"1", `{"id": 2, "channel": "email", "target": "team@example.com"}`, http.StatusBadRequest}, // different source
+		{"1", `{"id": 9, "channel": "email", "target": "team@example.com"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("PUT", "/", strings.NewReader(test.Body), map[string]string{"sourceId": test.SourceId})
+
+		handler.UpdateNotification()(w, r)
+		assert.Equal(test.StatusCode, w.Code, w.Body.String())
+	}
+
+	// the secret is kept when it is not given
+	notification, err := db.GetNotification(1)
+	assert.NoError(err)
+	assert.Equal("https://example.com/new", notification.Target)
+	assert.Equal("webhook-secret", notification.Secret)
+}
+
+func TestNotificationHandler_DeleteNotification(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, _ := NewNotificationHandler()
+
+	for _, test := range []struct {
+		Id         string
+		StatusCode int
+	}{
+		{"2", http.StatusBadRequest}, // different source
+		{"1", http.StatusOK},
+		{"1", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("DELETE", "/", nil, map[string]string{"sourceId": "1", "id": test.Id})
+		handler.DeleteNotification()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+	}
+}
+
+func TestNotificationHandler_GetDeliveries(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, _ := NewNotificationHandler()
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"sourceId": "1", "id": "1"})
+	handler.GetDeliveries()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var deliveries []*store.NotificationDelivery
+	err := readJson(w, &deliveries)
+	assert.NoError(err)
+	assert.Len(deliveries, 2)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"nidavellir/libs"
+	"nidavellir/services/artifact"
+	"nidavellir/services/iofiles"
+	"nidavellir/services/store"
+)
+
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Serves the job's output. The path after "/output/" selects a file or folder in the
+// output folder. Files are served with range support. Folders are listed recursively,
+// or downloaded as an archive when the archive query parameter is "zip" or "tar.gz"
+func (j *JobHandler) GetOutput() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, errors.Wrapf(err, "invalid job id '%s'", chi.URLParam(r, "id")).Error(), 400)
+			return
+		}
+
+		job, err := j.DB.GetJob(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		artifacts, prefix := j.outputStore(job)
+		if artifacts == nil {
+			http.Error(w, fmt.Sprintf("job %d has no output", job.Id), 404)
+			return
+		}
+
+		relPath := chi.URLParam(r, "*")
+		key := artifact.CleanKey(relPath)
+		if key != "" {
+			reader, obj, err := artifacts.Open(prefix + key)
+			if err == nil {
+				defer func() { _ = reader.Close() }()
+				// the files are written by the tasks, so they are downloaded rather than
+				// shown by the browser, where html files could run scripts on the api's origin
+				name := path.Base(obj.Key)
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				w.Header().Set("Content-Security-Policy", "sandbox")
+				w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+				// the content type is guessed from the extension or else the content
+				http.ServeContent(w, r, name, obj.ModTime, reader)
+				return
+			} else if err != artifact.ErrNotFound {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+
+		// the path is a folder if there are artifacts under it
+		folder := artifact.FolderPrefix(prefix + key)
+		objects, err := artifacts.List(folder)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		} else if len(objects) == 0 && key != "" {
+			http.Error(w, fmt.Sprintf("'%s' does not exist", relPath), 404)
+			return
+		}
+
+		archive := strings.ToLower(r.URL.Query().Get("archive"))
+		if archive == "" {
+			toJson(w, listOutput(objects, folder))
+			return
+		}
+
+		name := fmt.Sprintf("job-%d-output", job.Id)
+		if key != "" {
+			name += "-" + path.Base(key)
+		}
+		serveArchive(w, archive, name, artifacts, folder)
+	}
+}
+
+// Gets the store holding the job's output and the prefix of the output in the store.
+// The output folder is used while it is on this host, otherwise the output uploaded to
+// the artifact store. Returns nil if neither is available
+func (j *JobHandler) outputStore(job *store.Job) (artifact.ArtifactStore, string) {
+	if root := j.Files.GetOutputPath(job.SourceId, job.Id); libs.PathExists(root) {
+		return artifact.NewLocal(root), ""
+	} else if j.Artifacts != nil {
+		return j.Artifacts, artifact.OutputPrefix(job.SourceId, job.Id)
+	}
+	return nil, ""
+}
+
+// Lists the artifacts relative to the folder. As object stores have no folders, the
+// folders are derived from the artifact paths
+func listOutput(objects []*artifact.Object, folder string) []*iofiles.OutputFile {
+	files := make([]*iofiles.OutputFile, 0, len(objects))
+	folders := make(map[string]*iofiles.OutputFile)
+
+	for _, obj := range objects {
+		relPath := strings.TrimPrefix(obj.Key, folder)
+		files = append(files, &iofiles.OutputFile{Path: relPath, Size: obj.Size, ModTime: obj.ModTime})
+
+		for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+			f, exists := folders[dir]
+			if !exists {
+				f = &iofiles.OutputFile{Path: dir, IsDir: true}
+				folders[dir] = f
+				files = append(files, f)
+			}
+			if obj.ModTime.After(f.ModTime) {
+				f.ModTime = obj.ModTime
+			}
+		}
+	}
+
+	sort.Slice(files, func(a, b int) bool { return files[a].Path < files[b].Path })
+	return files
+}
+
+func serveArchive(w http.ResponseWriter, archive, name string, artifacts artifact.ArtifactStore, folder string) {
+	var write func() error
+	switch archive {
+	case ArchiveZip:
+		w.Header().Set("Content-Type", "application/zip")
+		write = func() error { return artifact.WriteZip(w, artifacts, folder) }
+	case ArchiveTarGz:
+		w.Header().Set("Content-Type", "application/gzip")
+		write = func() error { return artifact.WriteTarGz(w, artifacts, folder) }
+	default:
+		http.Error(w, fmt.Sprintf("unsupported archive '%s'. Use %s or %s", archive, ArchiveZip, ArchiveTarGz), 400)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, archive))
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent while streaming so errors can only be logged
+	if err := write(); err != nil {
+		log.Error(errors.Wrapf(err, "could not stream %s archive of %s", archive, folder))
+	}
+}
@@ -0,0 +1,201 @@
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/server"
+	"nidavellir/services/artifact"
+	"nidavellir/services/iofiles"
+)
+
+func newOutputHandler(assert *require.Assertions) (*JobHandler, string) {
+	dir, err := ioutil.TempDir("", "nida-output")
+	assert.NoError(err)
+
+	output := filepath.Join(dir, "output")
+	assert.NoError(os.MkdirAll(filepath.Join(output, "plots"), 0777))
+	assert.NoError(ioutil.WriteFile(filepath.Join(output, "result.json"), []byte(`{"value": 1}`), 0666))
+	assert.NoError(ioutil.WriteFile(filepath.Join(output, "plots", "data.txt"), []byte("0123456789"), 0666))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0666))
+
+	handler := NewJobHandler()
+	handler.Files = &MockFileHandler{OutputDir: output}
+	return handler, dir
+}
+
+func TestJobHandler_GetOutput(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, dir := newOutputHandler(assert)
+	defer func() { _ = os.RemoveAll(dir) }()
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "output", "report.html"), []byte("<script>alert(1)</script>"), 0666))
+
+	for _, test := range []struct {
+		Id          string
+		Path        string
+		StatusCode  int
+		ContentType string
+		Body        string
+	}{
+		{"abc", "", http.StatusBadRequest, "", "invalid job id 'abc'"},
+		{"999", "", http.StatusBadRequest, "", ""},
+		{"5", "result.json", http.StatusOK, "application/json", `{"value": 1}`},
+		{"5", "plots/data.txt", http.StatusOK, "text/plain; charset=utf-8", "0123456789"},
+		{"5", "report.html", http.StatusOK, "text/html; charset=utf-8", "<script>alert(1)</script>"},
+		{"5", "../secret.txt", http.StatusNotFound, "", ""},
+		{"5", "plots/../../secret.txt", http.StatusNotFound, "", ""},
+		{"5", "missing.txt", http.StatusNotFound, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/", nil, map[string]string{"id": test.Id, "*": test.Path})
+
+		handler.GetOutput()(w, r)
+		assert.Equal(test.StatusCode, w.Code, test.Path)
+		if test.StatusCode == http.StatusOK {
+			assert.Equal(test.ContentType, w.Header().Get("Content-Type"), test.Path)
+			assert.Equal(test.Body, w.Body.String())
+
+			// files written by tasks are never rendered by the browser
+			assert.Equal("nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal("sandbox", w.Header().Get("Content-Security-Policy"))
+			assert.Equal(`attachment; filename=`+filepath.Base(test.Path), w.Header().Get("Content-Disposition"))
+		} else if test.Body != "" {
+			assert.Contains(w.Body.String(), test.Body)
+		}
+	}
+}
+
+func TestJobHandler_GetOutput_Range(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, dir := newOutputHandler(assert)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"id": "5", "*": "plots/data.txt"})
+	r.Header.Set("Range", "bytes=2-5")
+
+	handler.GetOutput()(w, r)
+	assert.Equal(http.StatusPartialContent, w.Code)
+	assert.Equal("bytes 2-5/10", w.Header().Get("Content-Range"))
+	assert.Equal("2345", w.Body.String())
+}
+
+func TestJobHandler_GetOutput_Folder(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler, dir := newOutputHandler(assert)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// lists the folder recursively
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"id": "5"})
+	handler.GetOutput()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var files []*iofiles.OutputFile
+	assert.NoError(readJson(w, &files))
+	sizes := make(map[string]int64)
+	for _, f := range files {
+		sizes[f.Path] = f.Size
+	}
+	assert.Equal(map[string]int64{"plots": 0, "plots/data.txt": 10, "result.json": 12}, sizes)
+
+	// downloads a sub folder as a zip archive
+	w = httptest.NewRecorder()
+	r = NewTestRequest("GET", "/?archive=zip", nil, map[string]string{"id": "5", "*": "plots"})
+	handler.GetOutput()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(`attachment; filename="job-5-output-plots.zip"`, w.Header().Get("Content-Disposition"))
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(err)
+	assert.Len(zr.File, 1)
+	assert.Equal("data.txt", zr.File[0].Name)
+
+	for _, test := range []struct {
+		Archive    string
+		StatusCode int
+	}{
+		{"tar.gz", http.StatusOK},
+		{"rar", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/?archive="+test.Archive, nil, map[string]string{"id": "5"})
+
+		handler.GetOutput()(w, r)
+		assert.Equal(test.StatusCode, w.Code, test.Archive)
+	}
+}
+
+func TestJobHandler_GetOutput_Artifacts(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-artifacts")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// the output folder is gone so the output is read from the artifact store
+	handler := NewJobHandler()
+	handler.Files = &MockFileHandler{OutputDir: filepath.Join(dir, "missing")}
+	handler.Artifacts = artifact.NewLocal(dir)
+
+	job, err := handler.DB.GetJob(5)
+	assert.NoError(err)
+	prefix := artifact.OutputPrefix(job.SourceId, job.Id)
+	assert.NoError(handler.Artifacts.Put(prefix+"plots/data.txt", strings.NewReader("0123456789"), 10))
+
+	for _, test := range []struct {
+		Path       string
+		Range      string
+		StatusCode int
+		Body       string
+	}{
+		{"plots/data.txt", "", http.StatusOK, "0123456789"},
+		{"plots/data.txt", "bytes=7-", http.StatusPartialContent, "789"},
+		{"../../plots/data.txt", "", http.StatusOK, "0123456789"}, // cleaned to plots/data.txt
+		{"missing.txt", "", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := NewTestRequest("GET", "/", nil, map[string]string{"id": "5", "*": test.Path})
+		if test.Range != "" {
+			r.Header.Set("Range", test.Range)
+		}
+
+		handler.GetOutput()(w, r)
+		assert.Equal(test.StatusCode, w.Code, test.Path)
+		if test.Body != "" {
+			assert.Equal(test.Body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := NewTestRequest("GET", "/", nil, map[string]string{"id": "5"})
+	handler.GetOutput()(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var files []*iofiles.OutputFile
+	assert.NoError(readJson(w, &files))
+	assert.Len(files, 2)
+	assert.Equal("plots", files[0].Path)
+	assert.True(files[0].IsDir)
+	assert.Equal("plots/data.txt", files[1].Path)
+
+	// jobs without output folders or artifacts have no output
+	handler.Artifacts = nil
+	w = httptest.NewRecorder()
+	handler.GetOutput()(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"nidavellir/config"
+	"nidavellir/services/repo"
+)
+
+// Longest time the repository of a runtime validation may take to clone
+const validateTimeout = 2 * time.Minute
+
+type RuntimeHandler struct {
+	// access token used to clone private repositories
+	PAT config.PAT
+}
+
+// Validates a runtime config without running it. The runtime config can either be
+// given as raw yaml or be read from a repository at the specified commit
+func (h *RuntimeHandler) ValidateRuntime() http.HandlerFunc {
+	type RuntimeInput struct {
+		RepoUrl string `json:"repoUrl"`
+		Commit  string `json:"commit"`
+		Runtime string `json:"runtime"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input *RuntimeInput
+		if err := readJson(r, &input); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		input.RepoUrl = strings.TrimSpace(input.RepoUrl)
+		switch {
+		case input.Runtime != "" && input.RepoUrl != "":
+			http.Error(w, "specify either the repoUrl or the raw runtime but not both", 400)
+		case input.Runtime != "":
+			toJson(w, repo.ValidateRuntime("runtime", []byte(input.Runtime)))
+		case input.RepoUrl != "":
+			ctx, cancel := context.WithTimeout(r.Context(), validateTimeout)
+			defer cancel()
+
+			validation, err := repo.ValidateRemote(ctx, input.RepoUrl, input.Commit, h.PAT.Provider, h.PAT.Host, h.PAT.Token)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			toJson(w, validation)
+		default:
+			http.Error(w, "repoUrl or runtime must be specified", 400)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/server"
+	"nidavellir/services/repo"
+)
+
+const validRuntime = `
+setup:
+  image: python:3.7
+  timeout: 30m
+environment:
+  key: global
+steps:
+  - name: Extraction
+    retry:
+      attempts: 3
+      backoff: 10s
+    tasks:
+      - name: Extract A
+        cmd: python extract_a.py
+        environment:
+          key: task
+      - name: Extract B
+        cmd: python extract_b.py
+    branch:
+      - code: 1
+        step: Store
+  - name: Transformation
+    tasks:
+      - name: Transform
+        cmd: python transform.py
+  - name: Store
+    tasks:
+      - name: Save
+        cmd: python save.py
+`
+
+const graphRuntime = `
+setup:
+  image: python:3.7
+steps:
+  - name: Extraction
+    tasks:
+      - name: Extract A
+        cmd: python extract_a.py
+      - name: Extract B
+        cmd: python extract_b.py
+  - name: Transformation
+    tasks:
+      - name: Transform A
+        cmd: python transform_a.py
+        depends_on: [Extract A]
+      - name: Transform B
+        cmd: python transform_b.py
+`
+
+const invalidRuntime = `
+setup:
+  image: ""
+steps:
+  - name: Extraction
+    tasks:
+      - name: Extract
+        cmd: python extract.py
+    branch:
+      - code: 1
+        step: Missing
+  - name: Store
+    tasks:
+      - name: Save
+        cmd: python save.py
+    branch:
+      - code: 1
+        step: Extraction
+`
+
+const cyclicRuntime = `
+setup:
+  image: python:3.7
+steps:
+  - name: Extraction
+    tasks:
+      - name: Extract
+        cmd: python extract.py
+        depends_on: [Save]
+  - name: Store
+    tasks:
+      - name: Save
+        cmd: python save.py
+`
+
+func TestRuntimeHandler_ValidateRuntime(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := &RuntimeHandler{}
+
+	for _, test := range []struct {
+		Input      map[string]string
+		StatusCode int
+		Valid      bool
+		NumErrors  int
+	}{
+		{map[string]string{"runtime": validRuntime}, http.StatusOK, true, 0},
+		{map[string]string{"runtime": graphRuntime}, http.StatusOK, true, 0},
+		{map[string]string{"runtime": invalidRuntime}, http.StatusOK, false, 3},
+		{map[string]string{"runtime": cyclicRuntime}, http.StatusOK, false, 1},
+		{map[string]string{"runtime": "steps: ["}, http.StatusOK, false, 1},
+		{map[string]string{}, http.StatusBadRequest, false, 0},
+		{map[string]string{"runtime": validRuntime, "repoUrl": "https://github.com/a/b"}, http.StatusBadRequest, false, 0},
+		{map[string]string{"repoUrl": "github.com/a/b"}, http.StatusBadRequest, false, 0},
+		{map[string]string{"repoUrl": "file:///etc/project"}, http.StatusBadRequest, false, 0},
+	} {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(test.Input)
+		assert.NoError(err)
+
+		w := httptest.NewRecorder()
+		r := NewTestRequest("POST", "/", &buf, nil)
+		handler.ValidateRuntime()(w, r)
+		assert.Equal(test.StatusCode, w.Code)
+
+		if test.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var validation *repo.Validation
+		err = readJson(w, &validation)
+		assert.NoError(err)
+		assert.Equal(test.Valid, validation.Valid, validation.Errors)
+		assert.Len(validation.Errors, test.NumErrors, validation.Errors)
+		if test.Valid {
+			assert.NotNil(validation.Plan)
+		}
+	}
+}
+
+func TestRuntimeHandler_ValidateRuntime_ResolvesPlan(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	handler := &RuntimeHandler{}
+
+	for _, content := range []string{validRuntime, graphRuntime} {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(map[string]string{"runtime": content})
+		assert.NoError(err)
+
+		w := httptest.NewRecorder()
+		handler.ValidateRuntime()(w, NewTestRequest("POST", "/", &buf, nil))
+		assert.Equal(http.StatusOK, w.Code)
+
+		var validation *repo.Validation
+		assert.NoError(readJson(w, &validation))
+		plan := validation.Plan
+		assert.NotNil(plan)
+
+		if content == validRuntime {
+			assert.False(plan.Graph)
+			assert.Equal("30m0s", plan.Timeout)
+			assert.Len(plan.Steps, 3)
+			assert.Equal("task", plan.Steps[0].Tasks[0].Env["key"])
+			assert.Equal("global", plan.Steps[0].Tasks[1].Env["key"])
+			assert.Equal(3, plan.Steps[0].Tasks[1].Retry.Attempts)
+			assert.Equal("Store", plan.Steps[0].Branch[1])
+		} else {
+			assert.True(plan.Graph)
+			assert.Equal([]string{"Extract A"}, plan.Steps[1].Tasks[0].DependsOn)
+			// tasks without depends_on wait for the previous step
+			assert.Equal([]string{"Extract A", "Extract B"}, plan.Steps[1].Tasks[1].DependsOn)
+		}
+	}
+}
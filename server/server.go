@@ -13,7 +13,10 @@ import (
 
 	"nidavellir/config"
 	"nidavellir/server/authentication"
+	"nidavellir/server/authorization"
+	"nidavellir/services/artifact"
 	"nidavellir/services/scheduler"
+	"nidavellir/services/store"
 )
 
 var version string
@@ -45,6 +48,12 @@ type IStore interface {
 	ISourceStore
 	IJobStore
 	IAccountStore
+	INotificationStore
+	IAuditStore
+
+	// used to authenticate api tokens
+	GetApiToken(value string) (*store.ApiToken, error)
+	TouchApiToken(id int) error
 }
 
 func New(port int, store IStore, scheduler scheduler.IScheduler, conf *config.Config) (*http.Server, error) {
@@ -74,66 +83,128 @@ func attachMiddleware(r *chi.Mux) {
 	}).Handler)
 }
 
-func attachHandlers(r *chi.Mux, store IStore, scheduler scheduler.IScheduler, conf *config.Config) error {
+func attachHandlers(r *chi.Mux, db IStore, scheduler scheduler.IScheduler, conf *config.Config) error {
 	fileHandler, err := newFileHandler(conf.App.WorkDir)
 	if err != nil {
 		return err
 	}
 
+	artifacts, err := artifact.New(conf.Artifact)
+	if err != nil {
+		return err
+	}
+
 	r.Get("/healthcheck", HealthCheck)
 
+	// roles are only checked when authentication is used, except for account routes
+	// which always require authentication
+	authorizer := authorization.New(db, len(conf.Auth) > 0)
+	viewer := authorizer.Require(store.RoleViewer)
+	editor := authorizer.Require(store.RoleEditor)
+	admin := authorization.New(db, true).Require(store.RoleAdmin)
+	owner := authorization.New(db, true).RequireAccountOwner("id")
+
+	sourceOperator := authorizer.RequireForSource(store.RoleOperator, authorization.URLParam("sourceId"))
+	sourceEditor := authorizer.RequireForSource(store.RoleEditor, authorization.URLParam("sourceId"))
+
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/source", func(r chi.Router) {
-			r.Use(authentication.New(store, false, conf.Auth...))
-			handler := SourceHandler{DB: store}
-
-			r.Get("/", handler.GetSources())
-			r.Get("/{id}", handler.GetSource())
-			r.Post("/", handler.CreateSource())
-			r.Put("/", handler.UpdateSource())
-			r.Delete("/{id}", handler.DeleteSource())
-
-			r.Get("/{sourceId}/secret", handler.GetSecrets())
-			r.Post("/{sourceId}/secret", handler.AddSecret())
-			r.Put("/{sourceId}/secret", handler.UpdateSecret())
-			r.Delete("/{sourceId}/secret/{id}", handler.DeleteSecret())
+			r.Use(authentication.New(db, false, conf.Auth...))
+			handler := SourceHandler{DB: db, Audit: db, Networks: conf.Run.Networks}
+
+			r.With(viewer).Get("/", handler.GetSources())
+			r.With(viewer).Get("/{id}", handler.GetSource())
+			r.With(editor).Post("/", handler.CreateSource())
+			r.With(authorizer.RequireForSource(store.RoleEditor, authorization.JsonField("id"))).Put("/", handler.UpdateSource())
+			r.With(authorizer.RequireForSource(store.RoleEditor, authorization.URLParam("id"))).Delete("/{id}", handler.DeleteSource())
+
+			r.With(viewer).Get("/{sourceId}/secret", handler.GetSecrets())
+			r.With(sourceEditor).Post("/{sourceId}/secret", handler.AddSecret())
+			r.With(sourceEditor).Put("/{sourceId}/secret", handler.UpdateSecret())
+			r.With(sourceEditor).Delete("/{sourceId}/secret/{id}", handler.DeleteSecret())
+
+			notifications := NotificationHandler{DB: db, Audit: db}
+			r.With(viewer).Get("/{sourceId}/notification", notifications.GetNotifications())
+			r.With(sourceEditor).Post("/{sourceId}/notification", notifications.AddNotification())
+			r.With(sourceEditor).Put("/{sourceId}/notification", notifications.UpdateNotification())
+			r.With(sourceEditor).Delete("/{sourceId}/notification/{id}", notifications.DeleteNotification())
+			r.With(viewer).Get("/{sourceId}/notification/{id}/deliveries", notifications.GetDeliveries())
 		})
 
 		r.Route("/job", func(r chi.Router) {
-			r.Use(authentication.New(store, false, conf.Auth...))
-			handler := JobHandler{DB: store, Files: fileHandler, Scheduler: scheduler}
-
-			r.Get("/", handler.GetJobs())
-			r.Get("/{id}", handler.GetJobInfo())
-			r.Get("/trigger/{sourceId}", handler.InsertJob())
+			r.Use(authentication.New(db, false, conf.Auth...))
+			handler := JobHandler{DB: db, Files: fileHandler, Scheduler: scheduler, Audit: db, Artifacts: artifacts}
+
+			r.With(viewer).Get("/", handler.GetJobs())
+			r.With(viewer).Get("/{id}", handler.GetJobInfo())
+			r.With(viewer).Get("/{id}/tasks", handler.GetJobTasks())
+			r.With(viewer).Get("/{id}/logs/stream", handler.StreamLogs())
+			r.With(viewer).Get("/{id}/output", handler.GetOutput())
+			r.With(viewer).Get("/{id}/output/*", handler.GetOutput())
+			r.With(authorizer.RequireForSource(store.RoleOperator, authorization.JobURLParam(db, "id"))).Post("/{id}/cancel", handler.CancelJob())
+			r.With(sourceOperator).Get("/trigger/{sourceId}", handler.InsertJob())
 		})
 
 		r.Route("/account", func(r chi.Router) {
-			r.Use(authentication.New(store, false, config.BasicAuth))
-			handler := AccountHandler{DB: store}
+			r.Use(authentication.New(db, false, config.BasicAuth))
+			handler := AccountHandler{DB: db, Audit: db}
+
+			r.Group(func(r chi.Router) {
+				r.Use(admin)
 
-			r.Put("/", handler.UpdateAccount())
-			r.Post("/", handler.AddAccount())
-			r.Delete("/{id}", handler.RemoveAccount())
+				r.Put("/", handler.UpdateAccount())
+				r.Post("/", handler.AddAccount())
+				r.Delete("/{id}", handler.RemoveAccount())
+
+				r.Get("/{id}/grant", handler.GetSourceGrants())
+				r.Put("/{id}/grant", handler.SetSourceGrant())
+				r.Delete("/{id}/grant/{sourceId}", handler.RemoveSourceGrant())
+			})
+
+			// users manage their own api tokens. Tokens can not be used to create tokens
+			// as the account routes only accept BASIC auth
+			r.Group(func(r chi.Router) {
+				r.Use(owner)
+
+				r.Get("/{id}/tokens", handler.GetApiTokens())
+				r.Post("/{id}/tokens", handler.AddApiToken())
+				r.Delete("/{id}/tokens/{tokenId}", handler.RemoveApiToken())
+			})
+		})
+
+		r.Route("/audit", func(r chi.Router) {
+			r.Use(authentication.New(db, false, conf.Auth...))
+			r.Use(authorizer.Require(store.RoleAdmin))
+			handler := AuditHandler{DB: db}
+
+			r.Get("/", handler.GetAuditLogs())
 		})
 
 		r.Route("/validate", func(r chi.Router) {
 			r.Route("/account", func(r chi.Router) {
-				handler := AccountHandler{DB: store}
+				handler := AccountHandler{DB: db}
 				r.Post("/", handler.ValidateAccount())
 			})
 
 			r.Route("/source", func(r chi.Router) {
-				handler := SourceHandler{DB: store}
+				handler := SourceHandler{DB: db}
 
 				r.Post("/cron", handler.ValidateCron())
 				r.Get("/exists/{name}", handler.ValidateSourceName())
 			})
+
+			r.Route("/runtime", func(r chi.Router) {
+				// the repository is cloned with the application's access token, which can read
+				// private repositories, so only editors may validate repositories
+				r.Use(authentication.New(db, false, conf.Auth...))
+				r.Use(editor)
+				handler := RuntimeHandler{PAT: conf.App.PAT}
+
+				r.Post("/", handler.ValidateRuntime())
+			})
 		})
 	})
 
-	// TODO add file exposer
-
 	return nil
 }
 
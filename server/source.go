@@ -9,6 +9,7 @@ import (
 	"github.com/kantopark/cronexpr"
 	"github.com/pkg/errors"
 
+	"nidavellir/services/docker/dkspec"
 	"nidavellir/services/store"
 )
 
@@ -28,6 +29,10 @@ type ISourceStore interface {
 
 type SourceHandler struct {
 	DB ISourceStore
+	// records changes to sources and their secrets. Changes are not audited if nil
+	Audit IAuditStore
+	// host and named networks which sources may use
+	Networks []string
 }
 
 func (s *SourceHandler) GetSources() http.HandlerFunc {
@@ -39,6 +44,10 @@ func (s *SourceHandler) GetSources() http.HandlerFunc {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+
+		for _, source := range sources {
+			source.MaskSecrets()
+		}
 		toJson(w, sources)
 	}
 }
@@ -56,7 +65,7 @@ func (s *SourceHandler) GetSource() http.HandlerFunc {
 			http.Error(w, err.Error(), 400)
 			return
 		}
-		toJson(w, source)
+		toJson(w, source.MaskSecrets())
 	}
 }
 
@@ -68,6 +77,10 @@ func (s *SourceHandler) CreateSource() http.HandlerFunc {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+		if err := dkspec.Allowed(source.Network, s.Networks); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 
 		source, err = s.DB.AddSource(source)
 		if err != nil {
@@ -75,6 +88,8 @@ func (s *SourceHandler) CreateSource() http.HandlerFunc {
 			return
 		}
 
+		source.MaskSecrets()
+		audit(s.Audit, r, store.AuditCreate, store.AuditSource, source.Id, nil, source)
 		toJson(w, source)
 	}
 }
@@ -87,6 +102,10 @@ func (s *SourceHandler) UpdateSource() http.HandlerFunc {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+		if err := dkspec.Allowed(source.Network, s.Networks); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 
 		// to prevent concurrent updates when there is a job that is still updating
 		// as that may screw up secret injection
@@ -109,6 +128,8 @@ func (s *SourceHandler) UpdateSource() http.HandlerFunc {
 					return
 				}
 
+				source.MaskSecrets()
+				audit(s.Audit, r, store.AuditUpdate, store.AuditSource, source.Id, curr.MaskSecrets(), source)
 				toJson(w, source)
 				return
 
@@ -128,11 +149,20 @@ func (s *SourceHandler) DeleteSource() http.HandlerFunc {
 			http.Error(w, errors.Wrap(err, "invalid source id").Error(), 400)
 			return
 		}
+
+		before, err := s.DB.GetSource(id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
 		err = s.DB.RemoveSource(id)
 		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+
+		audit(s.Audit, r, store.AuditDelete, store.AuditSource, id, before.MaskSecrets(), nil)
 		ok(w)
 	}
 }
@@ -150,6 +180,11 @@ func (s *SourceHandler) GetSecrets() http.HandlerFunc {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+
+		// secret values are never returned by the api
+		for _, secret := range secrets {
+			secret.Mask()
+		}
 		toJson(w, secrets)
 	}
 }
@@ -178,9 +213,17 @@ func (s *SourceHandler) createAddUpdateSecretHandler(isCreate bool) http.Handler
 		}
 		secret.SourceId = sourceId
 
+		var before *store.Secret
+		action := store.AuditCreate
 		if isCreate {
 			secret, err = s.DB.AddSecret(secret)
 		} else {
+			action = store.AuditUpdate
+			before, err = s.getSourceSecret(sourceId, secret.Id)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
 			secret, err = s.DB.UpdateSecret(secret)
 		}
 
@@ -188,13 +231,17 @@ func (s *SourceHandler) createAddUpdateSecretHandler(isCreate bool) http.Handler
 			http.Error(w, err.Error(), 500)
 			return
 		}
+
+		// secret values are never audited
+		secret.Mask()
+		audit(s.Audit, r, action, store.AuditSecret, secret.Id, before, secret)
 		toJson(w, secret)
 	}
 }
 
 func (s *SourceHandler) DeleteSecret() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
+		sourceId, err := strconv.Atoi(chi.URLParam(r, "sourceId"))
 		if err != nil {
 			http.Error(w, errors.Wrap(err, "invalid source id").Error(), 400)
 			return
@@ -206,16 +253,39 @@ func (s *SourceHandler) DeleteSecret() http.HandlerFunc {
 			return
 		}
 
+		before, err := s.getSourceSecret(sourceId, id)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
 		err = s.DB.RemoveSecret(id)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
+		audit(s.Audit, r, store.AuditDelete, store.AuditSecret, id, before, nil)
 		ok(w)
 	}
 }
 
+// Gets the source's secret with its value masked. Returns an error if the secret does
+// not belong to the source
+func (s *SourceHandler) getSourceSecret(sourceId, id int) (*store.Secret, error) {
+	secrets, err := s.DB.GetSecrets(sourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, secret := range secrets {
+		if secret.Id == id {
+			return secret.Mask(), nil
+		}
+	}
+	return nil, errors.Errorf("source id %d has no secret with id %d", sourceId, id)
+}
+
 func (s *SourceHandler) ValidateCron() http.HandlerFunc {
 	type CronInput struct {
 		Expression string `json:"expression"`
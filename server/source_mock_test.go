@@ -66,9 +66,9 @@ func (m *MockSourceStore) GetSecrets(sourceId int) ([]*store.Secret, error) {
 	var secrets []*store.Secret
 	if source, exist := m.db[sourceId]; exist {
 		for _, s := range source.Secrets {
+			s := s
 			secrets = append(secrets, &s)
 		}
-	} else {
 	}
 	return secrets, nil
 }
@@ -140,6 +140,36 @@ func TestSourceHandler_CreateSource_WithFaultyJsonReturnsError(t *testing.T) {
 	assert.EqualValues(http.StatusBadRequest, w.Code)
 }
 
+func TestSourceHandler_CreateSource_Network(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Network    string
+		Allowed    []string
+		StatusCode int
+	}{
+		{"isolated", nil, http.StatusOK},
+		{"host", nil, http.StatusBadRequest},
+		{"host", []string{"host"}, http.StatusOK},
+		{"internal_db", []string{"host"}, http.StatusBadRequest},
+		{"internal_db", []string{"internal_db"}, http.StatusOK},
+	} {
+		handler := NewSourceHandler()
+		handler.Networks = test.Allowed
+
+		w := httptest.NewRecorder()
+		r := NewTestRequest("POST", "/", strings.NewReader(`{
+"name": "UniqueName",
+"repo_url": "https://git/repo/project.git",
+"network": "`+test.Network+`"
+}`), nil)
+
+		handler.CreateSource()(w, r)
+		assert.EqualValues(test.StatusCode, w.Code, test.Network)
+	}
+}
+
 // Tests errors out as id should not be specified
 func TestSourceHandler_CreateSource_WithInvalidKeyReturnsError(t *testing.T) {
 	t.Parallel()
@@ -263,6 +293,9 @@ func TestSourceHandler_GetSecrets(t *testing.T) {
 	assert.NoError(err)
 	assert.IsType([]*store.Secret{}, secrets)
 	assert.Len(secrets, 2)
+	for _, secret := range secrets {
+		assert.Equal(store.SecretMask, secret.Value)
+	}
 }
 
 func TestSourceHandler_UpdateSecret(t *testing.T) {
@@ -286,7 +319,7 @@ func TestSourceHandler_UpdateSecret(t *testing.T) {
 	assert.NoError(err)
 	assert.IsType(&store.Secret{}, secret)
 	assert.Equal(secret.Key, "NewKey")
-	assert.Equal(secret.Value, "NewValue")
+	assert.Equal(store.SecretMask, secret.Value)
 }
 
 func TestSourceHandler_DeleteSecret(t *testing.T) {
@@ -299,7 +332,8 @@ func TestSourceHandler_DeleteSecret(t *testing.T) {
 		StatusCode int
 	}{
 		{1, http.StatusOK},
-		{0, http.StatusInternalServerError},
+		// secret does not belong to the source
+		{3, http.StatusBadRequest},
 	} {
 		w := httptest.NewRecorder()
 		r := NewTestRequest("DELETE", "/", nil, map[string]string{"sourceId": "1", "id": strconv.Itoa(test.Id)})
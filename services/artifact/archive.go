@@ -0,0 +1,85 @@
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Writes the artifacts under the prefix into the writer as a zip archive. Entries are
+// named relative to the prefix
+func WriteZip(w io.Writer, store ArtifactStore, prefix string) error {
+	zw := zip.NewWriter(w)
+
+	err := walk(store, prefix, func(name string, obj *Object, r io.Reader) error {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: obj.ModTime}
+		header.SetMode(0644)
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, r)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not create zip archive")
+	}
+	return zw.Close()
+}
+
+// Writes the artifacts under the prefix into the writer as a gzipped tar archive.
+// Entries are named relative to the prefix
+func WriteTarGz(w io.Writer, store ArtifactStore, prefix string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := walk(store, prefix, func(name string, obj *Object, r io.Reader) error {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     obj.Size,
+			ModTime:  obj.ModTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.CopyN(tw, r, obj.Size)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not create tar archive")
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// Opens every artifact under the prefix in turn
+func walk(store ArtifactStore, prefix string, fn func(name string, obj *Object, r io.Reader) error) error {
+	objects, err := store.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	base := FolderPrefix(prefix)
+	for _, obj := range objects {
+		reader, _, err := store.Open(obj.Key)
+		if err != nil {
+			return errors.Wrapf(err, "could not open %s", obj.Key)
+		}
+		err = fn(strings.TrimPrefix(obj.Key, base), obj, reader)
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package artifact
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+	"nidavellir/services/iofiles"
+)
+
+// Returned when the artifact does not exist
+var ErrNotFound = errors.New("artifact does not exist")
+
+// Stores the artifacts of jobs. Keys are slash separated paths such as
+// "<sourceId>/<jobId>/output/result.csv"
+type ArtifactStore interface {
+	// Saves the size bytes read from the reader under the key
+	Put(key string, r io.Reader, size int64) error
+	// Opens the artifact for reading. Returns ErrNotFound if it does not exist
+	Open(key string) (Reader, *Object, error)
+	// Lists the artifacts under the folder-like prefix, such as "1/5/output/"
+	List(prefix string) ([]*Object, error)
+}
+
+type Reader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Creates the artifact store of the configured backend. Returns nil if no backend is
+// configured, in which case the artifacts are only kept in the job folders
+func New(conf config.ArtifactConfig) (ArtifactStore, error) {
+	switch conf.Backend {
+	case "":
+		return nil, nil
+	case config.ArtifactLocal:
+		if err := os.MkdirAll(conf.Dir, 0777); err != nil {
+			return nil, errors.Wrap(err, "could not create artifact folder")
+		}
+		return NewLocal(conf.Dir), nil
+	case config.ArtifactS3:
+		return NewS3(conf.S3), nil
+	default:
+		return nil, errors.Errorf("unknown artifact backend '%s'", conf.Backend)
+	}
+}
+
+// Prefix of every artifact of the job
+func JobPrefix(sourceId, jobId int) string {
+	return strconv.Itoa(sourceId) + "/" + strconv.Itoa(jobId) + "/"
+}
+
+// Prefix of the job's task output
+func OutputPrefix(sourceId, jobId int) string {
+	return JobPrefix(sourceId, jobId) + "output/"
+}
+
+// Cleans the slash separated path so that it can not escape the prefix it is joined to.
+// The result has no leading slash and is empty for the root
+func CleanKey(relPath string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(relPath, "\\", "/")), "/")
+}
+
+// Cleans the folder-like prefix so that it ends with a slash. The root is empty
+func FolderPrefix(prefix string) string {
+	if key := CleanKey(prefix); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+// Uploads the job's folder, which holds its logs and output, under the job's prefix
+func UploadJob(store ArtifactStore, appFolder string, sourceId, jobId int) error {
+	folder := filepath.Join(appFolder, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId))
+	files, err := iofiles.ListFiles(folder)
+	if err != nil {
+		return errors.Wrapf(err, "could not list files of job %d", jobId)
+	}
+
+	var errs error
+	prefix := JobPrefix(sourceId, jobId)
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		if err := upload(store, prefix+file.Path, filepath.Join(folder, filepath.FromSlash(file.Path))); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not upload %s of job %d", file.Path, jobId))
+		}
+	}
+	return errs
+}
+
+func upload(store ArtifactStore, key, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return store.Put(key, file, info.Size())
+}
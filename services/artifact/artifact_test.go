@@ -0,0 +1,206 @@
+package artifact_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/artifact"
+)
+
+func TestCleanKey(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Path     string
+		Expected string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"a/b.txt", "a/b.txt"},
+		{"/a//b/../c.txt", "a/c.txt"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"a\\..\\..\\b", "b"},
+	} {
+		assert.Equal(test.Expected, CleanKey(test.Path), test.Path)
+	}
+
+	assert.Equal("", FolderPrefix("/.."))
+	assert.Equal("1/5/output/", FolderPrefix("1/5/output"))
+	assert.Equal("1/5/output/", OutputPrefix(1, 5))
+}
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-artifact")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := NewLocal(filepath.Join(dir, "store"))
+	testStore(assert, store)
+
+	// keys can not escape the folder
+	assert.NoError(store.Put("../../escape.txt", strings.NewReader("x"), 1))
+	assert.FileExists(filepath.Join(dir, "store", "escape.txt"))
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0666))
+	assert.NoError(os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "store", "link.txt")))
+	_, _, err = store.Open("link.txt")
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestUploadJob(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-artifact")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	jobFolder := filepath.Join(dir, "app", "jobs", "2", "7")
+	assert.NoError(os.MkdirAll(filepath.Join(jobFolder, "output", "plots"), 0777))
+	assert.NoError(ioutil.WriteFile(filepath.Join(jobFolder, "logs.txt"), []byte("logs"), 0666))
+	assert.NoError(ioutil.WriteFile(filepath.Join(jobFolder, "output", "plots", "a.png"), []byte("png"), 0666))
+	assert.NoError(ioutil.WriteFile(filepath.Join(jobFolder, "output", "empty.txt"), nil, 0666))
+
+	store := NewLocal(filepath.Join(dir, "store"))
+	assert.NoError(UploadJob(store, filepath.Join(dir, "app"), 2, 7))
+
+	objects, err := store.List(JobPrefix(2, 7))
+	assert.NoError(err)
+	assert.Equal([]string{"2/7/logs.txt", "2/7/output/empty.txt", "2/7/output/plots/a.png"}, keys(objects))
+}
+
+func TestWriteZip(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	store := newTempStore(assert)
+	defer func() { _ = os.RemoveAll(store.root) }()
+
+	var buf bytes.Buffer
+	assert.NoError(WriteZip(&buf, store, "1/5/output"))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(err)
+		content, err := ioutil.ReadAll(rc)
+		assert.NoError(err)
+		_ = rc.Close()
+		contents[f.Name] = string(content)
+	}
+	assert.Equal(map[string]string{"a/b/deep.csv": "x,y\n1,2\n", "top.txt": "top"}, contents)
+}
+
+func TestWriteTarGz(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	store := newTempStore(assert)
+	defer func() { _ = os.RemoveAll(store.root) }()
+
+	var buf bytes.Buffer
+	assert.NoError(WriteTarGz(&buf, store, "1/5/output/"))
+
+	gr, err := gzip.NewReader(&buf)
+	assert.NoError(err)
+	tr := tar.NewReader(gr)
+
+	contents := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		content, err := ioutil.ReadAll(tr)
+		assert.NoError(err)
+		contents[header.Name] = string(content)
+	}
+	assert.Equal(map[string]string{"a/b/deep.csv": "x,y\n1,2\n", "top.txt": "top"}, contents)
+}
+
+// Checks the behaviour common to every store
+func testStore(assert *require.Assertions, store ArtifactStore) {
+	for key, content := range map[string]string{
+		"1/5/output/top.txt":      "top",
+		"1/5/output/a/b/deep.csv": "x,y\n1,2\n",
+		"1/5/logs.txt":            "some logs",
+		"1/50/logs.txt":           "other job",
+	} {
+		assert.NoError(store.Put(key, strings.NewReader(content), int64(len(content))))
+	}
+
+	objects, err := store.List("1/5/")
+	assert.NoError(err)
+	assert.Equal([]string{"1/5/logs.txt", "1/5/output/a/b/deep.csv", "1/5/output/top.txt"}, keys(objects))
+
+	objects, err = store.List("9/")
+	assert.NoError(err)
+	assert.Empty(objects)
+
+	reader, obj, err := store.Open("1/5/output/a/b/deep.csv")
+	assert.NoError(err)
+	assert.EqualValues(8, obj.Size)
+	assert.False(obj.ModTime.IsZero())
+
+	// seeks within the artifact
+	_, err = reader.Seek(4, io.SeekStart)
+	assert.NoError(err)
+	content, err := ioutil.ReadAll(reader)
+	assert.NoError(err)
+	assert.Equal("1,2\n", string(content))
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	assert.NoError(err)
+	assert.EqualValues(8, size)
+	assert.NoError(reader.Close())
+
+	_, _, err = store.Open("1/5/missing.txt")
+	assert.Equal(ErrNotFound, err)
+	_, _, err = store.Open("1/5/output/a")
+	assert.Equal(ErrNotFound, err)
+}
+
+type tempStore struct {
+	*Local
+	root string
+}
+
+// Creates a local store holding the output of job 5 of source 1
+func newTempStore(assert *require.Assertions) *tempStore {
+	dir, err := ioutil.TempDir("", "nida-artifact")
+	assert.NoError(err)
+
+	store := &tempStore{NewLocal(dir), dir}
+	assert.NoError(store.Put("1/5/output/top.txt", strings.NewReader("top"), 3))
+	assert.NoError(store.Put("1/5/output/a/b/deep.csv", strings.NewReader("x,y\n1,2\n"), 8))
+	assert.NoError(store.Put("1/5/logs.txt", strings.NewReader("logs"), 4))
+	return store
+}
+
+func keys(objects []*Object) []string {
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
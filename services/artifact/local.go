@@ -0,0 +1,79 @@
+package artifact
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/services/iofiles"
+)
+
+// Keeps the artifacts as files in a folder. Keys are paths relative to the folder
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+func (l *Local) Put(key string, r io.Reader, size int64) error {
+	target := filepath.Join(l.root, filepath.FromSlash(CleanKey(key)))
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return errors.Wrapf(err, "could not create folder for artifact %s", key)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return errors.Wrapf(err, "could not create artifact %s", key)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := io.CopyN(file, r, size); err != nil {
+		return errors.Wrapf(err, "could not write artifact %s", key)
+	}
+	return nil
+}
+
+func (l *Local) Open(key string) (Reader, *Object, error) {
+	target, err := iofiles.ResolvePath(l.root, key)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, nil, ErrNotFound
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not open artifact %s", key)
+	}
+	return file, &Object{Key: CleanKey(key), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) List(prefix string) ([]*Object, error) {
+	objects := make([]*Object, 0)
+
+	folder, err := iofiles.ResolvePath(l.root, prefix)
+	if err != nil {
+		// nothing has been saved under the prefix
+		return objects, nil
+	}
+
+	files, err := iofiles.ListFiles(folder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list artifacts under %s", prefix)
+	}
+
+	base := FolderPrefix(prefix)
+	for _, f := range files {
+		if !f.IsDir {
+			objects = append(objects, &Object{Key: base + f.Path, Size: f.Size, ModTime: f.ModTime})
+		}
+	}
+	return objects, nil
+}
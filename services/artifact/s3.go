@@ -0,0 +1,357 @@
+package artifact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+)
+
+const (
+	// payload hash of requests whose body is not signed
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// payload hash of requests without a body
+	emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Keeps the artifacts in an S3 compatible bucket. Requests are signed with AWS
+// signature version 4
+type S3 struct {
+	conf   config.S3Config
+	client *http.Client
+}
+
+func NewS3(conf config.S3Config) *S3 {
+	return &S3{conf: conf, client: &http.Client{Timeout: 30 * time.Minute}}
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64) error {
+	var body io.ReadCloser = http.NoBody
+	if size > 0 {
+		body = ioutil.NopCloser(io.LimitReader(r, size))
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectUrl(key), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return errors.Wrapf(err, "could not upload artifact %s", key)
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) Open(key string) (Reader, *Object, error) {
+	req, err := http.NewRequest(http.MethodHead, s.objectUrl(key), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = resp.Body.Close()
+
+	obj := &Object{Key: CleanKey(key), Size: resp.ContentLength}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = modTime
+	}
+	return &s3Reader{s3: s, key: key, size: obj.Size}, obj, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(prefix string) ([]*Object, error) {
+	objects := make([]*Object, 0)
+
+	base := FolderPrefix(prefix)
+	fullPrefix := s.fullKey(base)
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {fullPrefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.bucketUrl()
+		u.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, emptyPayload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list artifacts under %s", prefix)
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read artifact list")
+		}
+
+		for _, c := range result.Contents {
+			key := c.Key
+			if s.conf.Prefix != "" {
+				key = strings.TrimPrefix(key, s.conf.Prefix+"/")
+			}
+			objects = append(objects, &Object{Key: key, Size: c.Size, ModTime: c.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Signs and sends the request. Responses which are not successful are turned into
+// errors, and missing objects into ErrNotFound
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.Sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, errors.Errorf("s3 returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Signs the request with AWS signature version 4. The payload hash is the hex encoded
+// sha256 hash of the body or UNSIGNED-PAYLOAD
+func (s *S3) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// the root of virtual-hosted buckets has an empty path but is requested as "/"
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.conf.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexHash([]byte(canonicalRequest))
+
+	key := hmacSha256([]byte("AWS4"+s.conf.SecretKey), date)
+	for _, part := range []string{s.conf.Region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+// Url of the bucket. Path style buckets are addressed by the path and the rest by the
+// host name
+func (s *S3) bucketUrl() *url.URL {
+	u, _ := url.Parse(s.conf.Endpoint)
+	if s.conf.PathStyle {
+		u.Path = "/" + s.conf.Bucket
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+		u.Path = ""
+	}
+	u.RawPath = ""
+	return u
+}
+
+func (s *S3) objectUrl(key string) string {
+	u := s.bucketUrl()
+	u.Path += "/" + s.fullKey(CleanKey(key))
+	// the path is sent exactly as it is signed
+	u.RawPath = escape(u.Path, false)
+	return u.String()
+}
+
+func (s *S3) fullKey(key string) string {
+	if s.conf.Prefix == "" {
+		return key
+	}
+	return s.conf.Prefix + "/" + key
+}
+
+// Reads the object with ranged GET requests so that it can be seeked without
+// downloading the skipped bytes
+type s3Reader struct {
+	s3     *S3
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		req, err := http.NewRequest(http.MethodGet, r.s3.objectUrl(r.key), nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+
+		resp, err := r.s3.do(req, emptyPayload)
+		if err != nil {
+			return 0, errors.Wrapf(err, "could not download artifact %s", r.key)
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek to a negative position")
+	}
+
+	if offset != r.offset {
+		_ = r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Sorts and encodes the query as required by the canonical request
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Percent encodes every byte except the unreserved characters. Slashes are kept
+// unless encodeSlash is true
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
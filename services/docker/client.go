@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Version of the Engine API used by the client
+	APIVersion = "1.40"
+	// Address of the daemon when DOCKER_HOST is not set
+	DefaultHost = "unix:///var/run/docker.sock"
+)
+
+var (
+	defaultClient *Client
+	defaultLock   sync.Mutex
+)
+
+// Client of the Docker Engine API
+type Client struct {
+	http *http.Client
+	// url which the api paths are added to
+	base string
+}
+
+// Creates a client for the daemon at the host, such as "unix:///var/run/docker.sock",
+// "tcp://localhost:2375" or "http://localhost:2375"
+func NewClient(host string) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid docker host '%s'", host)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker/v" + APIVersion}, nil
+	case "tcp", "http":
+		return &Client{http: &http.Client{}, base: "http://" + u.Host + "/v" + APIVersion}, nil
+	case "https":
+		return &Client{http: &http.Client{}, base: "https://" + u.Host + "/v" + APIVersion}, nil
+	default:
+		return nil, errors.Errorf("unsupported docker host '%s'", host)
+	}
+}
+
+// Gets the client shared by the docker packages. It connects to DOCKER_HOST or, if
+// that is not set, to the default unix socket
+func Default() *Client {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	if defaultClient == nil {
+		host := os.Getenv("DOCKER_HOST")
+		if host == "" {
+			host = DefaultHost
+		}
+
+		client, err := NewClient(host)
+		if err != nil {
+			// requests will fail with a meaningful error against the default socket
+			client, _ = NewClient(DefaultHost)
+		}
+		defaultClient = client
+	}
+	return defaultClient
+}
+
+// Replaces the client shared by the docker packages
+func SetDefault(client *Client) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	defaultClient = client
+}
+
+// Error returned by the daemon
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker daemon returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Checks if the error is the daemon reporting that an object does not exist
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*APIError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Checks that the daemon is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not reach docker daemon")
+	}
+	return resp.Body.Close()
+}
+
+// Sends the request with the body encoded as json. Responses which are not successful
+// are turned into an APIError. The caller must close the response body
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var message struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &message) == nil && message.Message != "" {
+		apiErr.Message = message.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return nil, apiErr
+}
+
+// Sends the request and decodes the json response into result
+func (c *Client) doJson(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
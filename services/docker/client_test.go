@@ -0,0 +1,163 @@
+package docker_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/docker"
+	"nidavellir/services/docker/dkfake"
+)
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Host     string
+		HasError bool
+	}{
+		{"unix:///var/run/docker.sock", false},
+		{"tcp://localhost:2375", false},
+		{"http://localhost:2375", false},
+		{"https://localhost:2376", false},
+		{"npipe:////./pipe/docker_engine", true},
+		{"::bad", true},
+	} {
+		_, err := NewClient(test.Host)
+		if test.HasError {
+			assert.Error(err, test.Host)
+		} else {
+			assert.NoError(err, test.Host)
+		}
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-docker")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(err)
+
+	server := httptest.NewUnstartedServer(dkfake.New())
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := NewClient("unix://" + socket)
+	assert.NoError(err)
+	assert.NoError(client.Ping(context.Background()))
+}
+
+func TestClient_Containers(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	ctx := context.Background()
+
+	daemon := dkfake.New("alpine:3.11")
+	server, client := daemon.Start()
+	defer server.Close()
+
+	id, err := client.CreateContainer(ctx, "hello", &ContainerConfig{
+		Image: "alpine:3.11",
+		Cmd:   []string{"exit", "3"},
+		HostConfig: HostConfig{
+			PortBindings: map[string][]PortBinding{"80/tcp": {{HostPort: "8080"}}},
+		},
+	})
+	assert.NoError(err)
+	assert.NotEmpty(id)
+
+	// names are unique
+	_, err = client.CreateContainer(ctx, "hello", &ContainerConfig{Image: "alpine:3.11"})
+	assert.Error(err)
+
+	containers, err := client.ListContainers(ctx, true)
+	assert.NoError(err)
+	assert.Len(containers, 1)
+	assert.Equal([]string{"/hello"}, containers[0].Names)
+	assert.Equal(8080, containers[0].Ports[0].PublicPort)
+
+	assert.NoError(client.StartContainer(ctx, id))
+	code, err := client.WaitContainer(ctx, id)
+	assert.NoError(err)
+	assert.Equal(3, code)
+
+	var logs bytes.Buffer
+	assert.NoError(client.ContainerLogs(ctx, id, true, &logs))
+	assert.Equal("exit 3\n", logs.String())
+
+	info, err := client.InspectContainer(ctx, "hello")
+	assert.NoError(err)
+	assert.Equal(3, info.State.ExitCode)
+	assert.False(info.State.Running)
+
+	assert.NoError(client.RemoveContainer(ctx, id, false))
+	err = client.RemoveContainer(ctx, id, false)
+	assert.True(IsNotFound(err))
+
+	_, err = client.CreateContainer(ctx, "", &ContainerConfig{Image: "missing:1.0"})
+	assert.True(IsNotFound(err))
+}
+
+func TestClient_Images(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	ctx := context.Background()
+
+	daemon := dkfake.New()
+	daemon.Reclaimed = 2048
+	server, client := daemon.Start()
+	defer server.Close()
+
+	exists, err := client.ImageExists(ctx, "registry:5000/team/app")
+	assert.NoError(err)
+	assert.False(exists)
+
+	var progress bytes.Buffer
+	assert.NoError(client.PullImage(ctx, "registry:5000/team/app", &progress))
+	assert.Contains(progress.String(), "layer1: Pull complete")
+	assert.True(daemon.HasImage("registry:5000/team/app:latest"))
+
+	exists, err = client.ImageExists(ctx, "registry:5000/team/app")
+	assert.NoError(err)
+	assert.True(exists)
+
+	// failures are reported within the progress stream
+	assert.Error(client.PullImage(ctx, "unknown:1.0", nil))
+
+	reclaimed, err := client.PruneImages(ctx, true)
+	assert.NoError(err)
+	assert.EqualValues(2048, reclaimed)
+}
+
+func TestClient_Volumes(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	ctx := context.Background()
+
+	server, client := dkfake.New().Start()
+	defer server.Close()
+
+	exists, err := client.VolumeExists(ctx, "data")
+	assert.NoError(err)
+	assert.False(exists)
+
+	assert.NoError(client.CreateVolume(ctx, "data"))
+	exists, err = client.VolumeExists(ctx, "data")
+	assert.NoError(err)
+	assert.True(exists)
+}
@@ -0,0 +1,203 @@
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Configuration of a new container
+type ContainerConfig struct {
+	Image        string              `json:"Image"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	HostConfig   HostConfig          `json:"HostConfig"`
+	// user and optionally the group the command runs as, such as "1000:1000"
+	User string `json:"User,omitempty"`
+}
+
+// Host specific configuration of a new container
+type HostConfig struct {
+	// bind mounts and named volumes such as "/host/path:/container/path"
+	Binds []string `json:"Binds,omitempty"`
+	// host ports bound to the container ports, keyed by container port such as "5432/tcp"
+	PortBindings  map[string][]PortBinding `json:"PortBindings,omitempty"`
+	RestartPolicy RestartPolicy            `json:"RestartPolicy"`
+	NetworkMode   string                   `json:"NetworkMode,omitempty"`
+
+	// CPU quota in units of 1e-9 CPUs. 0 means no limit
+	NanoCpus int64 `json:"NanoCpus,omitempty"`
+	// memory limit in bytes. 0 means no limit
+	Memory int64 `json:"Memory,omitempty"`
+	// memory plus swap limit in bytes. -1 allows unlimited swap
+	MemorySwap int64 `json:"MemorySwap,omitempty"`
+	// maximum number of processes. 0 means no limit
+	PidsLimit int64 `json:"PidsLimit,omitempty"`
+	// size of /dev/shm in bytes. 0 uses the daemon default of 64MB
+	ShmSize int64 `json:"ShmSize,omitempty"`
+
+	ReadonlyRootfs bool `json:"ReadonlyRootfs,omitempty"`
+	// tmpfs mounts keyed by the container path with their mount options, such as "size=64m"
+	Tmpfs map[string]string `json:"Tmpfs,omitempty"`
+	// kernel capabilities removed from the container, such as "ALL" or "NET_RAW"
+	CapDrop []string `json:"CapDrop,omitempty"`
+	// security options, such as "no-new-privileges"
+	SecurityOpt []string `json:"SecurityOpt,omitempty"`
+}
+
+type PortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string `json:"HostPort"`
+}
+
+type RestartPolicy struct {
+	// "no", "always", "unless-stopped" or "on-failure"
+	Name string `json:"Name,omitempty"`
+}
+
+// Container as listed by the daemon
+type Container struct {
+	Id string `json:"Id"`
+	// names of the container, each starting with a slash
+	Names []string `json:"Names"`
+	Image string   `json:"Image"`
+	State string   `json:"State"`
+	Ports []Port   `json:"Ports"`
+}
+
+type Port struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// Details of a container
+type ContainerInfo struct {
+	Id    string         `json:"Id"`
+	Name  string         `json:"Name"`
+	State ContainerState `json:"State"`
+}
+
+type ContainerState struct {
+	Status    string `json:"Status"`
+	Running   bool   `json:"Running"`
+	ExitCode  int    `json:"ExitCode"`
+	OOMKilled bool   `json:"OOMKilled"`
+	Error     string `json:"Error"`
+}
+
+// Lists the running containers, or every container if all is true
+func (c *Client) ListContainers(ctx context.Context, all bool) ([]*Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+
+	var containers []*Container
+	if err := c.doJson(ctx, http.MethodGet, "/containers/json", query, nil, &containers); err != nil {
+		return nil, errors.Wrap(err, "could not list containers")
+	}
+	return containers, nil
+}
+
+// Creates the container and returns its id. An empty name lets the daemon pick a name
+func (c *Client) CreateContainer(ctx context.Context, name string, config *ContainerConfig) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var result struct {
+		Id string `json:"Id"`
+	}
+	if err := c.doJson(ctx, http.MethodPost, "/containers/create", query, config, &result); err != nil {
+		return "", err
+	}
+	return result.Id, nil
+}
+
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.doJson(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// Waits for the container to stop and returns its exit code
+func (c *Client) WaitContainer(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	query := url.Values{"condition": {"not-running"}}
+	if err := c.doJson(ctx, http.MethodPost, "/containers/"+id+"/wait", query, nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, errors.New(result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if err := c.doJson(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Writes the container's stdout and stderr into the writer. If follow is true, the logs
+// are streamed until the container stops
+func (c *Client) ContainerLogs(ctx context.Context, id string, follow bool, w io.Writer) error {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if follow {
+		query.Set("follow", "1")
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.Header.Get("Content-Type") == "application/vnd.docker.raw-stream" {
+		// containers with a tty send their output as is
+		_, err = io.Copy(w, resp.Body)
+		return err
+	}
+	return demux(w, resp.Body)
+}
+
+// Removes the container. Running containers are only removed if force is true
+func (c *Client) RemoveContainer(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	return c.doJson(ctx, http.MethodDelete, "/containers/"+id, query, nil, nil)
+}
+
+// Copies the frames of the multiplexed stdout and stderr stream into the writer. Each
+// frame has an 8 byte header holding the stream type and the frame size
+func demux(w io.Writer, r io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "could not read log frame header")
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return errors.Wrap(err, "could not read log frame")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package dkcontainer
+
+import (
+	"github.com/pkg/errors"
+
+	"nidavellir/services/docker"
+)
+
+// Exit code of a container killed by the kernel, which is also the code of a container
+// killed after exceeding its memory limit
+const ExitCodeKilled = 137
+
+// Resource limits of a container. A zero value means that there is no limit for the
+// resource
+type Resources struct {
+	// number of CPUs, such as 1.5
+	CPUs float64
+	// memory limit in bytes. The container is not allowed to swap beyond this limit
+	Memory int64
+	// maximum number of processes
+	Pids int64
+	// size of /dev/shm in bytes
+	ShmSize int64
+}
+
+func (r Resources) Validate() error {
+	switch {
+	case r.CPUs < 0:
+		return errors.Errorf("expected a non-negative number of cpus but got %g", r.CPUs)
+	case r.Memory < 0:
+		return errors.Errorf("expected a non-negative memory limit but got %d", r.Memory)
+	case r.Pids < 0:
+		return errors.Errorf("expected a non-negative pids limit but got %d", r.Pids)
+	case r.ShmSize < 0:
+		return errors.Errorf("expected a non-negative shm size but got %d", r.ShmSize)
+	}
+	return nil
+}
+
+// Returns the limits with the unset limits taken from the defaults
+func (r Resources) WithDefaults(defaults Resources) Resources {
+	if r.CPUs == 0 {
+		r.CPUs = defaults.CPUs
+	}
+	if r.Memory == 0 {
+		r.Memory = defaults.Memory
+	}
+	if r.Pids == 0 {
+		r.Pids = defaults.Pids
+	}
+	if r.ShmSize == 0 {
+		r.ShmSize = defaults.ShmSize
+	}
+	return r
+}
+
+// Returns the limits lowered to the caps. A limit which is not set is raised to its cap
+// as no limit is above every cap. Caps which are 0 are ignored
+func (r Resources) Cap(caps Resources) Resources {
+	if caps.CPUs > 0 && (r.CPUs == 0 || r.CPUs > caps.CPUs) {
+		r.CPUs = caps.CPUs
+	}
+	r.Memory = capInt(r.Memory, caps.Memory)
+	r.Pids = capInt(r.Pids, caps.Pids)
+	r.ShmSize = capInt(r.ShmSize, caps.ShmSize)
+	return r
+}
+
+func capInt(value, limit int64) int64 {
+	if limit > 0 && (value == 0 || value > limit) {
+		return limit
+	}
+	return value
+}
+
+func (r Resources) apply(conf *docker.HostConfig) {
+	conf.NanoCpus = int64(r.CPUs * 1e9)
+	conf.Memory = r.Memory
+	if r.Memory > 0 {
+		conf.MemorySwap = r.Memory
+	}
+	conf.PidsLimit = r.Pids
+	conf.ShmSize = r.ShmSize
+}
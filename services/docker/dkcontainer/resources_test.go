@@ -0,0 +1,38 @@
+package dkcontainer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/docker/dkcontainer"
+)
+
+func TestResources_Limits(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	defaults := Resources{CPUs: 1, Memory: 2 << 30}
+	caps := Resources{CPUs: 2, Memory: 4 << 30, Pids: 500}
+
+	for _, test := range []struct {
+		Task     Resources
+		Expected Resources
+	}{
+		// unset limits are taken from the defaults or raised to the caps
+		{Resources{}, Resources{CPUs: 1, Memory: 2 << 30, Pids: 500}},
+		{Resources{CPUs: 0.5, ShmSize: 1 << 20}, Resources{CPUs: 0.5, Memory: 2 << 30, Pids: 500, ShmSize: 1 << 20}},
+		// limits above the caps are lowered
+		{Resources{CPUs: 8, Memory: 16 << 30, Pids: 1000}, Resources{CPUs: 2, Memory: 4 << 30, Pids: 500}},
+	} {
+		assert.Equal(test.Expected, test.Task.WithDefaults(defaults).Cap(caps))
+	}
+
+	// limits without defaults or caps are left as they are
+	assert.Equal(Resources{CPUs: 3}, Resources{CPUs: 3}.WithDefaults(Resources{}).Cap(Resources{}))
+
+	assert.NoError(Resources{}.Validate())
+	assert.Error(Resources{CPUs: -1}.Validate())
+	assert.Error(Resources{Pids: -1}.Validate())
+	assert.Error(Resources{ShmSize: -1}.Validate())
+}
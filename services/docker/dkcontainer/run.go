@@ -1,14 +1,28 @@
 package dkcontainer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
+	"io"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"nidavellir/libs"
+	"nidavellir/services/docker"
+)
+
+const (
+	// Exit code when the container could not be created or started, as with `docker run`
+	ExitCodeRunError = 125
+	// Exit code when the container's command could not be invoked
+	ExitCodeNotExecutable = 126
+	// Exit code when the container's command could not be found
+	ExitCodeNotFound = 127
 )
 
 type RunOptions struct {
@@ -20,19 +34,31 @@ type RunOptions struct {
 	Env     map[string]string
 	Cmd     []string
 	Ports   map[int]int
+	// volume sources mapped to their container path. The path can be suffixed with
+	// mount options, such as "/repo:ro" for a read-only mount
 	Volumes map[string]string
 	Daemon  bool
 	Network string
+	// CPU, memory and process limits of the container
+	Resources Resources
+	// user, filesystem and privilege restrictions of the container
+	Security Security
 
 	// These are not docker container run specs specifically
 
-	// Working directory
+	// Working directory which relative volume sources, such as "./data", are resolved
+	// against. Sources which are not paths are named volumes
 	WorkDir string
+	// When specified, the container's stdout and stderr are written to Output as they
+	// are produced. The combined output is still returned in the RunResult
+	Output io.Writer
 }
 
 type RunResult struct {
 	ExitCode int
 	Logs     string
+	// true when the container was killed after exceeding its memory limit
+	OOMKilled bool
 }
 
 func (o *RunOptions) imageTag() (string, error) {
@@ -53,84 +79,144 @@ func (o *RunOptions) imageTag() (string, error) {
 	return fmt.Sprintf("%s:%s", o.Image, o.Tag), nil
 }
 
-func Run(options *RunOptions) (*RunResult, error) {
-	args := []string{"container", "run"}
-
-	if options.Daemon {
-		args = append(args, "-d")
+func (o *RunOptions) config(image string) *docker.ContainerConfig {
+	conf := &docker.ContainerConfig{
+		Image: image,
+		Cmd:   o.Cmd,
+		HostConfig: docker.HostConfig{
+			RestartPolicy: docker.RestartPolicy{Name: o.restart()},
+			NetworkMode:   strings.TrimSpace(o.Network),
+		},
 	}
+	o.Resources.apply(&conf.HostConfig)
+	o.Security.apply(conf)
 
-	for key, value := range options.Env {
-		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+	for key, value := range o.Env {
+		conf.Env = append(conf.Env, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	for src, dest := range options.Volumes {
-		args = append(args, "-v", fmt.Sprintf("%s:%s", src, dest))
+	for src, dest := range o.Volumes {
+		if strings.HasPrefix(src, ".") && !libs.IsEmptyOrWhitespace(o.WorkDir) {
+			src = filepath.Join(o.WorkDir, src)
+		}
+		conf.HostConfig.Binds = append(conf.HostConfig.Binds, fmt.Sprintf("%s:%s", src, dest))
 	}
 
-	for host, target := range options.Ports {
-		args = append(args, "-p", fmt.Sprintf("%d:%d", host, target))
+	if len(o.Ports) > 0 {
+		conf.ExposedPorts = make(map[string]struct{})
+		conf.HostConfig.PortBindings = make(map[string][]docker.PortBinding)
+		for host, target := range o.Ports {
+			port := strconv.Itoa(target) + "/tcp"
+			conf.ExposedPorts[port] = struct{}{}
+			conf.HostConfig.PortBindings[port] = []docker.PortBinding{{HostPort: strconv.Itoa(host)}}
+		}
 	}
 
-	if !libs.IsEmptyOrWhitespace(options.Name) {
-		args = append(args, "--name", options.Name)
+	return conf
+}
+
+func (o *RunOptions) restart() string {
+	if restart := strings.TrimSpace(o.Restart); restart != "" {
+		return restart
 	}
+	return "unless-stopped"
+}
 
-	if !libs.IsEmptyOrWhitespace(options.Network) {
-		args = append(args, "--network", options.Network)
+// Creates and starts the container. Daemon containers are left running and their id
+// is returned as the logs. Otherwise, Run waits for the container to exit and returns
+// its exit code and logs. Containers with the "no" restart policy are removed once they
+// exit. If the context is done before then, the container is removed and the context's
+// error is returned
+func Run(ctx context.Context, options *RunOptions) (*RunResult, error) {
+	image, err := options.imageTag()
+	if err != nil {
+		return &RunResult{ExitCode: ExitCodeRunError, Logs: image}, err
+	}
+	if err := options.Resources.Validate(); err != nil {
+		return &RunResult{ExitCode: ExitCodeRunError}, err
+	}
+	if err := options.Security.Validate(); err != nil {
+		return &RunResult{ExitCode: ExitCodeRunError}, err
 	}
 
-	if restart := strings.TrimSpace(options.Restart); restart == "" {
-		args = append(args, "--restart", "unless-stopped")
-	} else {
-		args = append(args, "--restart", restart)
-		if restart == "no" {
-			args = append(args, "--rm")
-		}
+	client := docker.Default()
+	id, err := create(ctx, client, options.Name, options.config(image))
+	if err != nil {
+		return &RunResult{ExitCode: ExitCodeRunError}, err
 	}
 
-	if imageLog, err := options.imageTag(); err != nil {
-		code, err := errorWithExitCode(err)
+	if err := client.StartContainer(ctx, id); err != nil {
+		_ = client.RemoveContainer(context.Background(), id, true)
+		return &RunResult{ExitCode: startExitCode(err)}, errors.Wrapf(err, "could not start container '%s'", options.Name)
+	}
 
-		return &RunResult{
-			ExitCode: code,
-			Logs:     imageLog,
-		}, err
-	} else {
-		args = append(args, imageLog)
+	if options.Daemon {
+		return &RunResult{ExitCode: 0, Logs: id}, nil
+	}
+	if options.restart() == "no" {
+		defer func() { _ = client.RemoveContainer(context.Background(), id, true) }()
 	}
 
-	args = append(args, options.Cmd...)
+	// the logs are streamed until the container stops
+	var output bytes.Buffer
+	var writer io.Writer = &output
+	if options.Output != nil {
+		writer = io.MultiWriter(&output, options.Output)
+	}
+	logErr := client.ContainerLogs(ctx, id, true, writer)
 
-	cmd := exec.Command("docker", args...)
-	if !libs.IsEmptyOrWhitespace(options.WorkDir) && libs.PathExists(options.WorkDir) {
-		cmd.Dir = options.WorkDir
+	if ctx.Err() != nil {
+		_ = client.RemoveContainer(context.Background(), id, true)
+		return &RunResult{ExitCode: ExitCodeRunError, Logs: output.String()}, ctx.Err()
 	}
 
-	output, err := cmd.CombinedOutput()
+	exitCode, err := client.WaitContainer(ctx, id)
 	if err != nil {
-		code, err := errorWithExitCode(err)
-
-		return &RunResult{
-			ExitCode: code,
-			Logs:     string(output),
-		}, err
+		return &RunResult{ExitCode: ExitCodeRunError, Logs: output.String()}, errors.Wrapf(err, "could not wait for container '%s'", options.Name)
+	}
+	if logErr != nil {
+		return &RunResult{ExitCode: exitCode, Logs: output.String()}, errors.Wrap(logErr, "could not read container logs")
+	}
+	if exitCode != 0 && oomKilled(client, id) {
+		return &RunResult{ExitCode: exitCode, Logs: output.String(), OOMKilled: true}, errors.Errorf("container '%s' was killed as it ran out of memory (exit code %d)", options.Name, exitCode)
+	}
+	if exitCode != 0 {
+		return &RunResult{ExitCode: exitCode, Logs: output.String()}, errors.Errorf("container '%s' exited with code %d", options.Name, exitCode)
 	}
 
-	return &RunResult{
-		ExitCode: 0,
-		Logs:     string(output),
-	}, nil
+	return &RunResult{ExitCode: 0, Logs: output.String()}, nil
 }
 
-func errorWithExitCode(err error) (int, error) {
-	if err == nil {
-		return 0, nil
+// Creates the container, pulling its image first if it does not exist locally
+func create(ctx context.Context, client *docker.Client, name string, conf *docker.ContainerConfig) (string, error) {
+	id, err := client.CreateContainer(ctx, name, conf)
+	if docker.IsNotFound(err) {
+		if err := client.PullImage(ctx, conf.Image, nil); err != nil {
+			return "", err
+		}
+		id, err = client.CreateContainer(ctx, name, conf)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create container '%s'", name)
 	}
+	return id, nil
+}
+
+// Checks if the container was killed by the kernel for exceeding its memory limit
+func oomKilled(client *docker.Client, id string) bool {
+	info, err := client.InspectContainer(context.Background(), id)
+	return err == nil && info.State.OOMKilled
+}
 
-	if err, ok := err.(*exec.ExitError); ok {
-		return err.ExitCode(), err
-	} else {
-		return 999, err // default exit code
+// Exit code of a container which could not be started, following the codes of `docker run`
+func startExitCode(err error) int {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "executable file not found"), strings.Contains(message, "no such file or directory"):
+		return ExitCodeNotFound
+	case strings.Contains(message, "permission denied"):
+		return ExitCodeNotExecutable
+	default:
+		return ExitCodeRunError
 	}
 }
@@ -0,0 +1,251 @@
+package dkcontainer_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/services/docker"
+	. "nidavellir/services/docker/dkcontainer"
+	"nidavellir/services/docker/dkfake"
+	"nidavellir/services/docker/dknetwork"
+)
+
+var daemon *dkfake.Daemon
+
+func TestMain(m *testing.M) {
+	daemon = dkfake.New("alpine:3.11")
+	server, client := daemon.Start()
+	docker.SetDefault(client)
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Name     string
+		Image    string
+		Cmd      []string
+		ExitCode int
+		Logs     string
+		HasError bool
+	}{
+		{"run-ok", "alpine", []string{"echo", "hello"}, 0, "echo hello\n", false},
+		{"run-exit", "alpine", []string{"exit", "3"}, 3, "exit 3\n", true},
+		{"run-missing-cmd", "alpine", []string{"missing"}, ExitCodeNotFound, "", true},
+		{"run-unknown-image", "unknown", []string{"echo"}, ExitCodeRunError, "", true},
+		{"run-no-image", "", []string{"echo"}, ExitCodeRunError, "", true},
+	} {
+		var output bytes.Buffer
+		result, err := Run(context.Background(), &RunOptions{
+			Image:   test.Image,
+			Tag:     "3.11",
+			Name:    test.Name,
+			Restart: "no",
+			Cmd:     test.Cmd,
+			Output:  &output,
+		})
+
+		if test.HasError {
+			assert.Error(err, test.Name)
+		} else {
+			assert.NoError(err, test.Name)
+		}
+		assert.Equal(test.ExitCode, result.ExitCode, test.Name)
+		assert.Equal(test.Logs, result.Logs, test.Name)
+		assert.Equal(test.Logs, output.String(), test.Name)
+
+		// containers which are not restarted are removed
+		assert.Nil(daemon.Container(test.Name), test.Name)
+	}
+}
+
+func TestRun_Daemon(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	result, err := Run(context.Background(), &RunOptions{
+		Image:   "alpine",
+		Tag:     "3.11",
+		Name:    "run-daemon",
+		Env:     map[string]string{"KEY": "value"},
+		Cmd:     []string{"sleep"},
+		Ports:   map[int]int{7432: 5432},
+		Volumes: map[string]string{"./data": "/data", "named": "/named"},
+		Daemon:  true,
+		WorkDir: "/repo",
+	})
+	assert.NoError(err)
+	assert.NotEmpty(result.Logs)
+
+	conf := daemon.Container("run-daemon")
+	assert.NotNil(conf)
+	assert.Equal("alpine:3.11", conf.Image)
+	assert.Equal([]string{"KEY=value"}, conf.Env)
+	assert.Equal("unless-stopped", conf.HostConfig.RestartPolicy.Name)
+	assert.Equal("7432", conf.HostConfig.PortBindings["5432/tcp"][0].HostPort)
+
+	binds := conf.HostConfig.Binds
+	sort.Strings(binds)
+	assert.Equal([]string{"/repo/data:/data", "named:/named"}, binds)
+
+	// containers are found by their name or published port
+	ids, err := Search(context.Background(), &SearchOptions{Port: 7432})
+	assert.NoError(err)
+	assert.Equal([]string{result.Logs}, ids)
+
+	logs, err := Stop(context.Background(), &StopOptions{Name: "run-daemon"})
+	assert.NoError(err)
+	assert.Equal(result.Logs, logs)
+	assert.Nil(daemon.Container("run-daemon"))
+}
+
+func TestRun_Resources(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	result, err := Run(context.Background(), &RunOptions{
+		Image:     "alpine",
+		Tag:       "3.11",
+		Name:      "run-resources",
+		Cmd:       []string{"sleep"},
+		Daemon:    true,
+		Resources: Resources{CPUs: 1.5, Memory: 1 << 30, Pids: 100, ShmSize: 256 << 20},
+	})
+	assert.NoError(err)
+	defer func() { _, _ = Stop(context.Background(), &StopOptions{Name: "run-resources"}) }()
+	assert.NotEmpty(result.Logs)
+
+	host := daemon.Container("run-resources").HostConfig
+	assert.EqualValues(1500000000, host.NanoCpus)
+	assert.EqualValues(1<<30, host.Memory)
+	assert.EqualValues(1<<30, host.MemorySwap)
+	assert.EqualValues(100, host.PidsLimit)
+	assert.EqualValues(256<<20, host.ShmSize)
+
+	_, err = Run(context.Background(), &RunOptions{
+		Image:     "alpine",
+		Tag:       "3.11",
+		Name:      "run-invalid-resources",
+		Cmd:       []string{"echo"},
+		Resources: Resources{Memory: -1},
+	})
+	assert.Error(err)
+	assert.Nil(daemon.Container("run-invalid-resources"))
+}
+
+func TestRun_Network(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	options := &RunOptions{
+		Image:   "alpine",
+		Tag:     "3.11",
+		Name:    "run-network",
+		Restart: "no",
+		Cmd:     []string{"echo"},
+		Network: "nida_job_network",
+	}
+	_, err := Run(context.Background(), options)
+	assert.Error(err, "network must exist")
+
+	assert.NoError(dknetwork.Create(context.Background(), options.Network))
+	result, err := Run(context.Background(), options)
+	assert.NoError(err)
+	assert.Equal(0, result.ExitCode)
+
+	// the network can be removed once the container is removed
+	assert.NoError(dknetwork.Remove(context.Background(), options.Network))
+}
+
+func TestRun_Security(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	options := &RunOptions{
+		Image:   "alpine",
+		Tag:     "3.11",
+		Name:    "run-security",
+		Cmd:     []string{"sleep"},
+		Volumes: map[string]string{"/repos/project": "/repo:ro"},
+		Daemon:  true,
+		Security: Security{
+			User:            "1000:1000",
+			ReadOnlyRootfs:  true,
+			Tmpfs:           map[string]string{"/tmp": "rw,size=1024"},
+			CapDrop:         []string{"ALL"},
+			NoNewPrivileges: true,
+		},
+	}
+	_, err := Run(context.Background(), options)
+	assert.NoError(err)
+	defer func() { _, _ = Stop(context.Background(), &StopOptions{Name: "run-security"}) }()
+
+	conf := daemon.Container("run-security")
+	assert.Equal("1000:1000", conf.User)
+	assert.Equal([]string{"/repos/project:/repo:ro"}, conf.HostConfig.Binds)
+	assert.True(conf.HostConfig.ReadonlyRootfs)
+	assert.Equal(map[string]string{"/tmp": "rw,size=1024"}, conf.HostConfig.Tmpfs)
+	assert.Equal([]string{"ALL"}, conf.HostConfig.CapDrop)
+	assert.Equal([]string{"no-new-privileges"}, conf.HostConfig.SecurityOpt)
+
+	for _, sec := range []Security{
+		{User: "root user"},
+		{CapDrop: []string{"net_raw"}},
+		{Tmpfs: map[string]string{"tmp": ""}},
+	} {
+		options.Name = "run-invalid-security"
+		options.Security = sec
+		_, err := Run(context.Background(), options)
+		assert.Error(err)
+		assert.Nil(daemon.Container("run-invalid-security"))
+	}
+}
+
+func TestRun_OOMKilled(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	result, err := Run(context.Background(), &RunOptions{
+		Image:     "alpine",
+		Tag:       "3.11",
+		Name:      "run-oom",
+		Restart:   "no",
+		Cmd:       []string{"oom"},
+		Resources: Resources{Memory: 4 << 20},
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), "ran out of memory")
+	assert.Equal(ExitCodeKilled, result.ExitCode)
+	assert.True(result.OOMKilled)
+}
+
+func TestRun_Cancel(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Run(ctx, &RunOptions{
+		Image:   "alpine",
+		Tag:     "3.11",
+		Name:    "run-cancel",
+		Restart: "no",
+		Cmd:     []string{"sleep"},
+	})
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.True(time.Since(start) < 5*time.Second)
+	assert.Nil(daemon.Container("run-cancel"))
+}
@@ -1,13 +1,10 @@
 package dkcontainer
 
 import (
-	"os/exec"
-	"strconv"
+	"context"
 	"strings"
 
-	"github.com/pkg/errors"
-
-	"nidavellir/services/docker/dkutils"
+	"nidavellir/services/docker"
 )
 
 type SearchOptions struct {
@@ -15,40 +12,38 @@ type SearchOptions struct {
 	Port int
 }
 
-func Search(options *SearchOptions) ([]string, error) {
-	sep := "::"
-	cmd := exec.Command("docker", "container", "list", "-a", "--format", "{{.Names}}"+sep+"{{.Ports}}"+sep+"{{.ID}}")
-	output, err := cmd.CombinedOutput()
+// Gets the ids of the containers, running or not, which have the name or publish the
+// port on the host
+func Search(ctx context.Context, options *SearchOptions) ([]string, error) {
+	containers, err := docker.Default().ListContainers(ctx, true)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not get list of containers")
+		return nil, err
 	}
 
-	idMap := make(map[string]int)
-	for _, namesPorts := range dkutils.SplitOutput(output) {
-		parts := strings.Split(namesPorts, "::")
-		id := parts[2]
-
-		for _, name := range strings.Split(parts[0], ",") {
-			if options.Name != "" && name == options.Name {
-				idMap[id] = 0
-			}
+	var ids []string
+	for _, c := range containers {
+		if matches(c, options) {
+			ids = append(ids, c.Id)
 		}
+	}
+	return ids, nil
+}
 
-		for _, fullAddress := range strings.Split(parts[1], ",") {
-			if addresses := strings.Split(fullAddress, "->"); len(addresses) == 2 {
-				if _parts := strings.Split(addresses[0], ":"); len(_parts) == 2 {
-					if port, err := strconv.Atoi(_parts[1]); err == nil && options.Port == port {
-						idMap[id] = 0
-					}
-				}
+func matches(c *docker.Container, options *SearchOptions) bool {
+	if options.Name != "" {
+		for _, name := range c.Names {
+			if strings.TrimPrefix(name, "/") == options.Name {
+				return true
 			}
 		}
 	}
 
-	var ids []string
-	for k := range idMap {
-		ids = append(ids, k)
+	if options.Port != 0 {
+		for _, port := range c.Ports {
+			if port.PublicPort == options.Port {
+				return true
+			}
+		}
 	}
-
-	return ids, nil
+	return false
 }
@@ -0,0 +1,82 @@
+package dkcontainer
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/services/docker"
+	"nidavellir/services/docker/dkspec"
+)
+
+// Hardening options of a container. The zero value runs the container with docker's
+// defaults
+type Security struct {
+	// user and optionally the group the command runs as, such as "1000:1000". Empty
+	// uses the user of the image
+	User string
+	// mounts the container's root filesystem as read-only
+	ReadOnlyRootfs bool
+	// tmpfs mounts keyed by the container path with their mount options, such as
+	// "size=64m". These give containers with a read-only root filesystem a scratch space
+	Tmpfs map[string]string
+	// kernel capabilities removed from the container, such as "ALL" or "NET_RAW"
+	CapDrop []string
+	// stops the command from gaining privileges, such as through setuid binaries
+	NoNewPrivileges bool
+}
+
+func (s Security) Validate() error {
+	if s.User != "" {
+		if err := dkspec.ValidateUser(s.User); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range s.CapDrop {
+		if err := dkspec.ValidateCapability(c); err != nil {
+			return err
+		}
+	}
+
+	for path := range s.Tmpfs {
+		if !strings.HasPrefix(path, "/") {
+			return errors.Errorf("expected tmpfs path '%s' to be absolute", path)
+		}
+	}
+	return nil
+}
+
+// Returns the settings tightened by the other settings. Flags set in either are set
+// and the capabilities dropped by either are dropped. The other's user is only used if
+// it is given and is neither root nor in the root group
+func (s Security) Tighten(o Security) Security {
+	if o.User != "" && !dkspec.IsRootUser(o.User) {
+		s.User = o.User
+	}
+	s.ReadOnlyRootfs = s.ReadOnlyRootfs || o.ReadOnlyRootfs
+	s.NoNewPrivileges = s.NoNewPrivileges || o.NoNewPrivileges
+
+	capDrop := make([]string, 0, len(s.CapDrop)+len(o.CapDrop))
+	seen := make(map[string]bool)
+	for _, c := range append(append([]string{}, s.CapDrop...), o.CapDrop...) {
+		if !seen[c] {
+			seen[c] = true
+			capDrop = append(capDrop, c)
+		}
+	}
+	if len(capDrop) > 0 {
+		s.CapDrop = capDrop
+	}
+	return s
+}
+
+func (s Security) apply(conf *docker.ContainerConfig) {
+	conf.User = s.User
+	conf.HostConfig.ReadonlyRootfs = s.ReadOnlyRootfs
+	conf.HostConfig.Tmpfs = s.Tmpfs
+	conf.HostConfig.CapDrop = s.CapDrop
+	if s.NoNewPrivileges {
+		conf.HostConfig.SecurityOpt = append(conf.HostConfig.SecurityOpt, "no-new-privileges")
+	}
+}
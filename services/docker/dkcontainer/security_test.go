@@ -0,0 +1,32 @@
+package dkcontainer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/docker/dkcontainer"
+)
+
+func TestSecurity_Tighten(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	base := Security{User: "1000:1000", ReadOnlyRootfs: true, CapDrop: []string{"NET_RAW"}, NoNewPrivileges: true}
+
+	for _, test := range []struct {
+		Name     string
+		Other    Security
+		Expected Security
+	}{
+		{"nothing given", Security{}, base},
+		{"flags are never turned off", Security{User: "2000"}, Security{User: "2000", ReadOnlyRootfs: true, CapDrop: []string{"NET_RAW"}, NoNewPrivileges: true}},
+		{"root is ignored", Security{User: "0:0"}, base},
+		{"root group is ignored", Security{User: "2000:0"}, base},
+		{"capabilities are combined", Security{CapDrop: []string{"ALL", "NET_RAW"}}, Security{User: "1000:1000", ReadOnlyRootfs: true, CapDrop: []string{"NET_RAW", "ALL"}, NoNewPrivileges: true}},
+	} {
+		assert.Equal(test.Expected, base.Tighten(test.Other), test.Name)
+	}
+
+	assert.Equal(Security{ReadOnlyRootfs: true, NoNewPrivileges: true}, Security{}.Tighten(Security{ReadOnlyRootfs: true, NoNewPrivileges: true}))
+}
@@ -1,10 +1,12 @@
 package dkcontainer
 
 import (
-	"os/exec"
+	"context"
 	"strings"
 
 	"github.com/pkg/errors"
+
+	"nidavellir/services/docker"
 )
 
 type StopOptions struct {
@@ -13,8 +15,9 @@ type StopOptions struct {
 	IgnoreNotFoundError bool
 }
 
-func Stop(options *StopOptions) (logs string, err error) {
-	containers, err := Search(&SearchOptions{
+// Removes the containers which match the options. Returns the ids of the removed containers
+func Stop(ctx context.Context, options *StopOptions) (logs string, err error) {
+	containers, err := Search(ctx, &SearchOptions{
 		Name: options.Name,
 		Port: options.Port,
 	})
@@ -27,15 +30,15 @@ func Stop(options *StopOptions) (logs string, err error) {
 
 	var stopped []string
 	for _, id := range containers {
-		cmd := exec.Command("docker", "container", "rm", "-f", id)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
+		err := docker.Default().RemoveContainer(ctx, id, true)
+		if docker.IsNotFound(err) {
+			// the container was removed after it was found
+			continue
+		} else if err != nil {
 			return "", errors.Wrapf(err, "could not stop container '%s'", id)
 		}
-		stopped = append(stopped, string(output))
-		logs += string(output)
+		stopped = append(stopped, id)
 	}
 
-	logs = strings.Join(stopped, ", ")
-	return
+	return strings.Join(stopped, ", "), nil
 }
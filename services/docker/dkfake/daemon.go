@@ -0,0 +1,466 @@
+// Package dkfake is an in-memory stand-in for the Docker Engine API used to test the
+// docker packages without a docker daemon
+package dkfake
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nidavellir/services/docker"
+)
+
+// Containers run by the daemon print their command and exit with 0, unless the command is
+//   - "exit <code>", which exits with the code
+//   - "sleep", which runs until the container is removed
+//   - "oom", which is killed for running out of memory
+//   - "missing", which can not be started as the executable does not exist
+type Daemon struct {
+	lock       sync.Mutex
+	nextId     int
+	containers map[string]*container
+	images     map[string]bool
+	volumes    map[string]bool
+	networks   map[string]*docker.Network
+	// number of bytes reported as reclaimed by image prunes
+	Reclaimed uint64
+}
+
+type container struct {
+	docker.Container
+	config    docker.ContainerConfig
+	exitCode  int
+	oomKilled bool
+	logs      string
+	// closed once the container stops
+	stopped chan struct{}
+}
+
+func New(images ...string) *Daemon {
+	d := &Daemon{
+		containers: make(map[string]*container),
+		images:     make(map[string]bool),
+		volumes:    make(map[string]bool),
+		networks:   make(map[string]*docker.Network),
+	}
+	for _, image := range images {
+		d.images[normalize(image)] = true
+	}
+	return d
+}
+
+// Starts a server for the daemon and returns a client connected to it. The server must
+// be closed once done
+func (d *Daemon) Start() (*httptest.Server, *docker.Client) {
+	server := httptest.NewServer(d)
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		panic(err)
+	}
+	return server, client
+}
+
+// Checks if the image has been pulled
+func (d *Daemon) HasImage(image string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.images[normalize(image)]
+}
+
+// Gets the config of the container with the name. Returns nil if it does not exist
+func (d *Daemon) Container(name string) *docker.ContainerConfig {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, c := range d.containers {
+		if c.Names[0] == "/"+name {
+			conf := c.config
+			return &conf
+		}
+	}
+	return nil
+}
+
+// Gets the network with the name. Returns nil if it does not exist
+func (d *Daemon) Network(name string) *docker.Network {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if n, exists := d.networks[name]; exists {
+		network := *n
+		return &network
+	}
+	return nil
+}
+
+// Number of containers which have not been removed
+func (d *Daemon) NumContainers() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.containers)
+}
+
+var (
+	containerPath = regexp.MustCompile(`^/containers/([^/]+)(/[a-z]+)?$`)
+	imagePath     = regexp.MustCompile(`^/images/(.+)/json$`)
+	volumePath    = regexp.MustCompile(`^/volumes/([^/]+)$`)
+	networkPath   = regexp.MustCompile(`^/networks/([^/]+)$`)
+)
+
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v"+docker.APIVersion)
+
+	switch {
+	case path == "/_ping":
+		_, _ = w.Write([]byte("OK"))
+	case path == "/containers/json" && r.Method == http.MethodGet:
+		d.listContainers(w)
+	case path == "/containers/create" && r.Method == http.MethodPost:
+		d.createContainer(w, r)
+	case containerPath.MatchString(path):
+		m := containerPath.FindStringSubmatch(path)
+		d.handleContainer(w, r, m[1], m[2])
+	case path == "/images/create" && r.Method == http.MethodPost:
+		d.pullImage(w, r)
+	case path == "/images/prune" && r.Method == http.MethodPost:
+		writeJson(w, map[string]uint64{"SpaceReclaimed": d.Reclaimed})
+	case imagePath.MatchString(path):
+		d.lock.Lock()
+		exists := d.images[normalize(imagePath.FindStringSubmatch(path)[1])]
+		d.lock.Unlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, "No such image")
+			return
+		}
+		writeJson(w, map[string]string{})
+	case path == "/volumes/create" && r.Method == http.MethodPost:
+		var body struct{ Name string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		d.lock.Lock()
+		d.volumes[body.Name] = true
+		d.lock.Unlock()
+		writeJson(w, body)
+	case volumePath.MatchString(path):
+		d.lock.Lock()
+		exists := d.volumes[volumePath.FindStringSubmatch(path)[1]]
+		d.lock.Unlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, "no such volume")
+			return
+		}
+		writeJson(w, map[string]string{})
+	case path == "/networks" && r.Method == http.MethodGet:
+		d.listNetworks(w, r)
+	case path == "/networks/create" && r.Method == http.MethodPost:
+		d.createNetwork(w, r)
+	case networkPath.MatchString(path):
+		d.handleNetwork(w, r, networkPath.FindStringSubmatch(path)[1])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (d *Daemon) listContainers(w http.ResponseWriter) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	list := make([]docker.Container, 0, len(d.containers))
+	for _, c := range d.containers {
+		list = append(list, c.Container)
+	}
+	writeJson(w, list)
+}
+
+func (d *Daemon) createContainer(w http.ResponseWriter, r *http.Request) {
+	var conf docker.ContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&conf); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.images[normalize(conf.Image)] {
+		writeError(w, http.StatusNotFound, "No such image: "+conf.Image)
+		return
+	}
+
+	switch mode := conf.HostConfig.NetworkMode; mode {
+	case "", "default", "bridge", "none", "host":
+	default:
+		if _, exists := d.networks[mode]; !exists {
+			writeError(w, http.StatusNotFound, "network "+mode+" not found")
+			return
+		}
+	}
+
+	name := r.URL.Query().Get("name")
+	for _, c := range d.containers {
+		if name != "" && c.Names[0] == "/"+name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("container name \"/%s\" is already in use", name))
+			return
+		}
+	}
+
+	d.nextId++
+	id := fmt.Sprintf("%064d", d.nextId)
+	if name == "" {
+		name = "container_" + strconv.Itoa(d.nextId)
+	}
+
+	c := &container{
+		Container: docker.Container{Id: id, Names: []string{"/" + name}, Image: conf.Image, State: "created"},
+		config:    conf,
+		stopped:   make(chan struct{}),
+	}
+	for port, bindings := range conf.HostConfig.PortBindings {
+		private, _ := strconv.Atoi(strings.Split(port, "/")[0])
+		for _, b := range bindings {
+			public, _ := strconv.Atoi(b.HostPort)
+			c.Ports = append(c.Ports, docker.Port{PrivatePort: private, PublicPort: public, Type: "tcp"})
+		}
+	}
+	d.containers[id] = c
+
+	w.WriteHeader(http.StatusCreated)
+	writeJson(w, map[string]string{"Id": id})
+}
+
+func (d *Daemon) handleContainer(w http.ResponseWriter, r *http.Request, idOrName, action string) {
+	d.lock.Lock()
+	c := d.find(idOrName)
+	d.lock.Unlock()
+
+	if c == nil {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+
+	switch {
+	case action == "/start" && r.Method == http.MethodPost:
+		d.start(w, c)
+	case action == "/wait" && r.Method == http.MethodPost:
+		select {
+		case <-c.stopped:
+		case <-r.Context().Done():
+			return
+		}
+		writeJson(w, map[string]int{"StatusCode": c.exitCode})
+	case action == "/logs" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("follow") == "1" {
+			select {
+			case <-c.stopped:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+		writeFrame(w, 1, c.logs)
+	case action == "/json" && r.Method == http.MethodGet:
+		d.lock.Lock()
+		info := docker.ContainerInfo{Id: c.Id, Name: c.Names[0], State: docker.ContainerState{
+			Status:    c.State,
+			Running:   c.State == "running",
+			ExitCode:  c.exitCode,
+			OOMKilled: c.oomKilled,
+		}}
+		d.lock.Unlock()
+		writeJson(w, info)
+	case action == "" && r.Method == http.MethodDelete:
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		if c.State == "running" && r.URL.Query().Get("force") != "1" {
+			writeError(w, http.StatusConflict, "You cannot remove a running container")
+			return
+		}
+		if c.State == "running" {
+			c.State = "exited"
+			c.exitCode = 137
+			close(c.stopped)
+		}
+		delete(d.containers, c.Id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+// Runs the container's command
+func (d *Daemon) start(w http.ResponseWriter, c *container) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	cmd := c.config.Cmd
+	switch {
+	case len(cmd) > 0 && cmd[0] == "missing":
+		writeError(w, http.StatusBadRequest, `OCI runtime create failed: exec: "missing": executable file not found in $PATH`)
+		return
+	case len(cmd) > 0 && cmd[0] == "sleep":
+		c.State = "running"
+	case len(cmd) > 0 && cmd[0] == "oom":
+		c.State = "exited"
+		c.exitCode = 137
+		c.oomKilled = true
+		close(c.stopped)
+	case len(cmd) > 1 && cmd[0] == "exit":
+		c.exitCode, _ = strconv.Atoi(cmd[1])
+		fallthrough
+	default:
+		c.logs = strings.Join(cmd, " ") + "\n"
+		c.State = "exited"
+		close(c.stopped)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *Daemon) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var conf docker.NetworkConfig
+	if err := json.NewDecoder(r.Body).Decode(&conf); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, exists := d.networks[conf.Name]; exists {
+		writeError(w, http.StatusConflict, fmt.Sprintf("network with name %s already exists", conf.Name))
+		return
+	}
+
+	d.nextId++
+	id := fmt.Sprintf("%064d", d.nextId)
+	d.networks[conf.Name] = &docker.Network{
+		Id:       id,
+		Name:     conf.Name,
+		Driver:   conf.Driver,
+		Internal: conf.Internal,
+		Labels:   conf.Labels,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	writeJson(w, map[string]string{"Id": id})
+}
+
+func (d *Daemon) listNetworks(w http.ResponseWriter, r *http.Request) {
+	var filters struct {
+		Label []string `json:"label"`
+	}
+	if f := r.URL.Query().Get("filters"); f != "" {
+		if err := json.Unmarshal([]byte(f), &filters); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	list := make([]docker.Network, 0, len(d.networks))
+outer:
+	for _, n := range d.networks {
+		for _, label := range filters.Label {
+			parts := strings.SplitN(label, "=", 2)
+			value, exists := n.Labels[parts[0]]
+			if !exists || (len(parts) == 2 && value != parts[1]) {
+				continue outer
+			}
+		}
+		list = append(list, *n)
+	}
+	writeJson(w, list)
+}
+
+func (d *Daemon) handleNetwork(w http.ResponseWriter, r *http.Request, name string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	network, exists := d.networks[name]
+	if !exists {
+		writeError(w, http.StatusNotFound, "network "+name+" not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, network)
+	case http.MethodDelete:
+		for _, c := range d.containers {
+			if c.config.HostConfig.NetworkMode == name {
+				writeError(w, http.StatusForbidden, "error while removing network: network "+name+" has active endpoints")
+				return
+			}
+		}
+		delete(d.networks, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (d *Daemon) pullImage(w http.ResponseWriter, r *http.Request) {
+	image := r.URL.Query().Get("fromImage")
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		image += ":" + tag
+	}
+
+	encoder := json.NewEncoder(w)
+	_ = encoder.Encode(map[string]string{"status": "Pulling from " + image})
+	if strings.Contains(image, "unknown") {
+		_ = encoder.Encode(map[string]string{"error": "manifest for " + image + " not found"})
+		return
+	}
+
+	d.lock.Lock()
+	d.images[image] = true
+	d.lock.Unlock()
+	_ = encoder.Encode(map[string]string{"id": "layer1", "status": "Pull complete"})
+	_ = encoder.Encode(map[string]string{"status": "Downloaded newer image for " + image})
+}
+
+// Adds the latest tag to images without a tag
+func normalize(image string) string {
+	if strings.LastIndex(image, ":") > strings.LastIndex(image, "/") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// Finds the container by its id or name
+func (d *Daemon) find(idOrName string) *container {
+	if c, exists := d.containers[idOrName]; exists {
+		return c
+	}
+	for _, c := range d.containers {
+		if c.Names[0] == "/"+idOrName {
+			return c
+		}
+	}
+	return nil
+}
+
+// Writes the content as a frame of the multiplexed log stream
+func writeFrame(w http.ResponseWriter, stream byte, content string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+	_, _ = w.Write(header)
+	_, _ = w.Write([]byte(content))
+}
+
+func writeJson(w http.ResponseWriter, object interface{}) {
+	_ = json.NewEncoder(w).Encode(object)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJson(w, map[string]string{"message": message})
+}
@@ -1,21 +1,45 @@
 package dkimage
 
 import (
-	"os/exec"
+	"context"
+	"fmt"
 	"strings"
 
-	"github.com/pkg/errors"
+	"nidavellir/services/docker"
 )
 
-func Pull(name string) (string, error) {
-	name = strings.TrimSpace(name)
-	args := []string{"dkimage", "pull", name}
-	cmd := exec.Command("docker", args...)
+// Pulls the image. Returns the progress of the pull
+func Pull(ctx context.Context, name string) (string, error) {
+	var logs strings.Builder
+	if err := docker.Default().PullImage(ctx, strings.TrimSpace(name), &logs); err != nil {
+		return logs.String(), err
+	}
+	return logs.String(), nil
+}
+
+// Checks if the image exists locally
+func Exists(ctx context.Context, name string) (bool, error) {
+	return docker.Default().ImageExists(ctx, strings.TrimSpace(name))
+}
 
-	output, err := cmd.CombinedOutput()
+// Removes dangling images, which are left behind when task images are rebuilt with the
+// same tag. Returns the reclaimed space, such as "1.2GB"
+func PruneDangling() (string, error) {
+	reclaimed, err := docker.Default().PruneImages(context.Background(), true)
 	if err != nil {
-		return "", errors.Wrapf(err, "error encountered when pulling dkimage: %s", name)
+		return "", err
 	}
+	return HumanSize(reclaimed), nil
+}
 
-	return string(output), nil
+// Formats the size in decimal units as docker does, such as "1.2GB"
+func HumanSize(size uint64) string {
+	value := float64(size)
+	for _, unit := range []string{"B", "kB", "MB", "GB", "TB"} {
+		if value < 1000 || unit == "TB" {
+			return fmt.Sprintf("%.4g%s", value, unit)
+		}
+		value /= 1000
+	}
+	return ""
 }
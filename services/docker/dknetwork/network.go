@@ -0,0 +1,73 @@
+// Package dknetwork manages the isolated networks created for jobs. The network modes
+// of task containers are in dkspec
+package dknetwork
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+
+	"nidavellir/services/docker"
+)
+
+// Label given to the networks which are created and removed by the application
+const ManagedLabel = "nidavellir.managed"
+
+// Name of the isolated network of the job
+func JobNetwork(jobId int) string {
+	return fmt.Sprintf("nida_job_%d", jobId)
+}
+
+// Creates an isolated network with the name. The network is internal and labelled as
+// managed by the application
+func Create(ctx context.Context, name string) error {
+	_, err := docker.Default().CreateNetwork(ctx, &docker.NetworkConfig{
+		Name:           name,
+		Driver:         "bridge",
+		Internal:       true,
+		Labels:         map[string]string{ManagedLabel: "true"},
+		CheckDuplicate: true,
+	})
+	return err
+}
+
+// Removes the network. Networks which do not exist are ignored
+func Remove(ctx context.Context, name string) error {
+	err := docker.Default().RemoveNetwork(ctx, name)
+	if docker.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func Exists(ctx context.Context, name string) (bool, error) {
+	_, err := docker.Default().InspectNetwork(ctx, name)
+	if docker.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Removes the networks created by the application. This should only be called when no
+// job is running, such as to clean up after jobs which were interrupted. Returns the
+// number of networks removed
+func Prune(ctx context.Context) (int, error) {
+	networks, err := docker.Default().ListNetworks(ctx, ManagedLabel)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs error
+	count := 0
+	for _, n := range networks {
+		if err := Remove(ctx, n.Name); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		count++
+	}
+	return count, errs
+}
@@ -0,0 +1,72 @@
+package dknetwork_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/services/docker"
+	"nidavellir/services/docker/dkfake"
+	. "nidavellir/services/docker/dknetwork"
+)
+
+var daemon *dkfake.Daemon
+
+func TestMain(m *testing.M) {
+	daemon = dkfake.New()
+	server, client := daemon.Start()
+	docker.SetDefault(client)
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+	ctx := context.Background()
+
+	name := JobNetwork(1)
+	assert.NoError(Create(ctx, name))
+	assert.Error(Create(ctx, name))
+
+	network := daemon.Network(name)
+	assert.NotNil(network)
+	assert.True(network.Internal)
+	assert.Equal("true", network.Labels[ManagedLabel])
+
+	exists, err := Exists(ctx, name)
+	assert.NoError(err)
+	assert.True(exists)
+
+	assert.NoError(Remove(ctx, name))
+	exists, err = Exists(ctx, name)
+	assert.NoError(err)
+	assert.False(exists)
+
+	// networks which do not exist are ignored
+	assert.NoError(Remove(ctx, name))
+}
+
+// Not parallel as it removes the networks of the other tests
+func TestPrune(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	// networks which were not created by the application are kept
+	_, err := docker.Default().CreateNetwork(ctx, &docker.NetworkConfig{Name: "prune_other"})
+	assert.NoError(err)
+	for _, id := range []int{101, 102} {
+		assert.NoError(Create(ctx, JobNetwork(id)))
+	}
+
+	count, err := Prune(ctx)
+	assert.NoError(err)
+	assert.Equal(2, count)
+	assert.Nil(daemon.Network(JobNetwork(101)))
+	assert.Nil(daemon.Network(JobNetwork(102)))
+	assert.NotNil(daemon.Network("prune_other"))
+}
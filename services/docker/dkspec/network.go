@@ -0,0 +1,67 @@
+// Package dkspec validates the settings of task containers. It does not depend on the
+// docker client so that the settings can be validated where docker is not used, such as
+// in the store
+package dkspec
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Containers use docker's default bridge network. This is the default mode
+	ModeBridge = "bridge"
+	// Containers have no network interface besides the loopback
+	ModeNone = "none"
+	// Containers of the job share a network which is created for the job. The network
+	// is internal, so the containers can reach each other but nothing outside of it
+	ModeIsolated = "isolated"
+	// Containers share the host's network stack
+	ModeHost = "host"
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Formats and validates the network mode. Besides the bridge, none and isolated modes,
+// the host mode and existing networks given by their name are allowed if named is
+// true. An empty mode is left empty
+func Validate(mode string, named bool) (string, error) {
+	mode = strings.TrimSpace(mode)
+	switch strings.ToLower(mode) {
+	case "", ModeBridge, ModeNone, ModeIsolated:
+		return strings.ToLower(mode), nil
+	case ModeHost:
+		if named {
+			return ModeHost, nil
+		}
+	default:
+		if named && namePattern.MatchString(mode) {
+			return mode, nil
+		}
+	}
+
+	if named {
+		return "", errors.Errorf("'%s' is not a valid network mode or network name", mode)
+	}
+	return "", errors.Errorf("expected network mode to be one of %s, %s or %s but got '%s'", ModeBridge, ModeNone, ModeIsolated, mode)
+}
+
+// Checks that a source may use the network mode. The bridge, none and isolated modes
+// are always allowed while the host mode and named networks must be in the allowed list
+// set by the administrators
+func Allowed(mode string, allowed []string) error {
+	mode = strings.TrimSpace(mode)
+	switch strings.ToLower(mode) {
+	case "", ModeBridge, ModeNone, ModeIsolated:
+		return nil
+	}
+
+	for _, a := range allowed {
+		if a == mode || (strings.EqualFold(a, ModeHost) && strings.EqualFold(mode, ModeHost)) {
+			return nil
+		}
+	}
+	return errors.Errorf("network '%s' is not in the networks allowed by the administrators", mode)
+}
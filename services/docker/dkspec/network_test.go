@@ -0,0 +1,65 @@
+package dkspec_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/docker/dkspec"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Mode     string
+		Named    bool
+		Expected string
+		HasError bool
+	}{
+		{"", false, "", false},
+		{" Isolated ", false, ModeIsolated, false},
+		{"none", false, ModeNone, false},
+		{"bridge", false, ModeBridge, false},
+		{"host", false, "", true},
+		{"internal_db", false, "", true},
+		{"host", true, ModeHost, false},
+		{"internal_db", true, "internal_db", false},
+		{"-bad name", true, "", true},
+	} {
+		mode, err := Validate(test.Mode, test.Named)
+		if test.HasError {
+			assert.Error(err, test.Mode)
+		} else {
+			assert.NoError(err, test.Mode)
+			assert.Equal(test.Expected, mode)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Mode     string
+		Allowed  []string
+		HasError bool
+	}{
+		{"", nil, false},
+		{"isolated", nil, false},
+		{"none", nil, false},
+		{"host", nil, true},
+		{"host", []string{"HOST"}, false},
+		{"internal_db", []string{"host"}, true},
+		{"internal_db", []string{"internal_db"}, false},
+	} {
+		err := Allowed(test.Mode, test.Allowed)
+		if test.HasError {
+			assert.Error(err, test.Mode)
+		} else {
+			assert.NoError(err, test.Mode)
+		}
+	}
+}
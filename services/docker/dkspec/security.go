@@ -0,0 +1,49 @@
+package dkspec
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	userPattern       = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(:[a-zA-Z0-9_.-]+)?$`)
+	capabilityPattern = regexp.MustCompile(`^(CAP_)?[A-Z_]+$`)
+)
+
+// Checks that the user, and optionally the group, a container runs as is well formed
+func ValidateUser(user string) error {
+	if !userPattern.MatchString(user) {
+		return errors.Errorf("'%s' is not a valid user. Expected a user such as 'nobody' or '1000:1000'", user)
+	}
+	return nil
+}
+
+// Checks that the kernel capability, such as "ALL" or "NET_RAW", is well formed
+func ValidateCapability(capability string) error {
+	if !capabilityPattern.MatchString(capability) {
+		return errors.Errorf("'%s' is not a valid capability", capability)
+	}
+	return nil
+}
+
+// Checks if the user, such as "root" or "0", is the root user or is in the root group,
+// such as "1000:0"
+func IsRootUser(user string) bool {
+	for _, name := range strings.SplitN(strings.TrimSpace(user), ":", 2) {
+		if isRoot(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the user or group name or id is that of root
+func isRoot(name string) bool {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id == 0
+	}
+	return name == "root"
+}
@@ -0,0 +1,29 @@
+package dkspec_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/docker/dkspec"
+)
+
+func TestIsRootUser(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for user, expected := range map[string]bool{
+		"root":      true,
+		"root:root": true,
+		"0":         true,
+		"0:1000":    true,
+		"000":       true,
+		"1000:0":    true,
+		"1000:root": true,
+		"1000:1000": false,
+		"nobody":    false,
+		"rooted":    false,
+	} {
+		assert.Equal(expected, IsRootUser(user), user)
+	}
+}
@@ -1,35 +1,15 @@
 package dkvolume
 
 import (
-	"os/exec"
+	"context"
 
-	"github.com/pkg/errors"
-
-	"nidavellir/services/docker/dkutils"
+	"nidavellir/services/docker"
 )
 
-func Create(name string) (logs string, err error) {
-	cmd := exec.Command("docker", "volume", "create", name)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", errors.Wrapf(err, "could not create volume '%s'", name)
-	}
-
-	return string(output), nil
+func Create(ctx context.Context, name string) error {
+	return docker.Default().CreateVolume(ctx, name)
 }
 
-func Exists(name string) (bool, error) {
-	cmd := exec.Command("docker", "volume", "list", "--format", "{{.Name}}")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false, errors.Wrap(err, "could not get list of volume names")
-	}
-
-	for _, volume := range dkutils.SplitOutput(output) {
-		if volume == name {
-			return true, nil
-		}
-	}
-
-	return false, nil
+func Exists(ctx context.Context, name string) (bool, error) {
+	return docker.Default().VolumeExists(ctx, name)
 }
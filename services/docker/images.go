@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Checks if the image exists locally
+func (c *Client) ImageExists(ctx context.Context, image string) (bool, error) {
+	err := c.doJson(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "could not inspect image '%s'", image)
+	}
+	return true, nil
+}
+
+// Pulls the image, writing the progress of each layer into the writer. Images without
+// a tag or digest are pulled with the latest tag
+func (c *Client) PullImage(ctx context.Context, image string, w io.Writer) error {
+	name, tag := splitImage(image)
+	query := url.Values{"fromImage": {name}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not pull image '%s'", image)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// the progress is a stream of json messages. Failures are reported in the stream
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Id     string `json:"id"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "could not read progress of pulling image '%s'", image)
+		}
+
+		if message.Error != "" {
+			return errors.Errorf("could not pull image '%s': %s", image, message.Error)
+		}
+		if w != nil && message.Status != "" {
+			if message.Id != "" {
+				_, _ = fmt.Fprintf(w, "%s: %s\n", message.Id, message.Status)
+			} else {
+				_, _ = fmt.Fprintln(w, message.Status)
+			}
+		}
+	}
+}
+
+// Removes unused images. If dangling is true, only untagged images are removed.
+// Returns the number of bytes reclaimed
+func (c *Client) PruneImages(ctx context.Context, dangling bool) (uint64, error) {
+	query := url.Values{}
+	filter := "false"
+	if dangling {
+		filter = "true"
+	}
+	query.Set("filters", `{"dangling":["`+filter+`"]}`)
+
+	var result struct {
+		SpaceReclaimed uint64 `json:"SpaceReclaimed"`
+	}
+	if err := c.doJson(ctx, http.MethodPost, "/images/prune", query, nil, &result); err != nil {
+		return 0, errors.Wrap(err, "could not prune images")
+	}
+	return result.SpaceReclaimed, nil
+}
+
+// Splits the image into its name and tag. The tag is "latest" if the image has neither
+// a tag nor a digest, and empty if the image has a digest
+func splitImage(image string) (name, tag string) {
+	image = strings.TrimSpace(image)
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	// colons before the last slash belong to the registry's port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+type NetworkConfig struct {
+	Name   string `json:"Name"`
+	Driver string `json:"Driver,omitempty"`
+	// internal networks have no route out of the network, not even to the host
+	Internal bool              `json:"Internal"`
+	Labels   map[string]string `json:"Labels,omitempty"`
+	// fails the creation if a network with the same name exists
+	CheckDuplicate bool `json:"CheckDuplicate"`
+}
+
+type Network struct {
+	Id       string            `json:"Id"`
+	Name     string            `json:"Name"`
+	Driver   string            `json:"Driver"`
+	Internal bool              `json:"Internal"`
+	Labels   map[string]string `json:"Labels"`
+}
+
+// Creates the network and returns its id
+func (c *Client) CreateNetwork(ctx context.Context, conf *NetworkConfig) (string, error) {
+	var result struct {
+		Id string `json:"Id"`
+	}
+	if err := c.doJson(ctx, http.MethodPost, "/networks/create", nil, conf, &result); err != nil {
+		return "", errors.Wrapf(err, "could not create network '%s'", conf.Name)
+	}
+	return result.Id, nil
+}
+
+// Lists the networks which have every label. Labels are given either as a key or as
+// "key=value"
+func (c *Client) ListNetworks(ctx context.Context, labels ...string) ([]*Network, error) {
+	query := url.Values{}
+	if len(labels) > 0 {
+		filters, err := json.Marshal(map[string][]string{"label": labels})
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(filters))
+	}
+
+	var networks []*Network
+	if err := c.doJson(ctx, http.MethodGet, "/networks", query, nil, &networks); err != nil {
+		return nil, errors.Wrap(err, "could not list networks")
+	}
+	return networks, nil
+}
+
+// Gets the network by its id or name
+func (c *Client) InspectNetwork(ctx context.Context, idOrName string) (*Network, error) {
+	var network Network
+	if err := c.doJson(ctx, http.MethodGet, "/networks/"+url.PathEscape(idOrName), nil, nil, &network); err != nil {
+		return nil, errors.Wrapf(err, "could not inspect network '%s'", idOrName)
+	}
+	return &network, nil
+}
+
+// Removes the network by its id or name
+func (c *Client) RemoveNetwork(ctx context.Context, idOrName string) error {
+	if err := c.doJson(ctx, http.MethodDelete, "/networks/"+url.PathEscape(idOrName), nil, nil, nil); err != nil {
+		return errors.Wrapf(err, "could not remove network '%s'", idOrName)
+	}
+	return nil
+}
@@ -1,28 +1,14 @@
 package docker
 
 import (
-	"errors"
-	"os/exec"
-	"strings"
+	"context"
+	"time"
 )
 
+// Checks that the docker daemon is reachable
 func SystemCheck() error {
-	if _, err := exec.LookPath("docker"); err != nil {
-		return errors.New("docker is required")
-	}
-	return nil
-}
-
-func SplitOutput(output []byte) []string {
-	var results []string
-	raw := strings.TrimSpace(string(output))
-	if len(raw) == 0 {
-		return nil
-	}
-
-	for _, r := range strings.Split(raw, "\n") {
-		results = append(results, strings.TrimSpace(r))
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	return results
+	return Default().Ping(ctx)
 }
@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+func (c *Client) CreateVolume(ctx context.Context, name string) error {
+	body := map[string]string{"Name": name}
+	if err := c.doJson(ctx, http.MethodPost, "/volumes/create", nil, body, nil); err != nil {
+		return errors.Wrapf(err, "could not create volume '%s'", name)
+	}
+	return nil
+}
+
+func (c *Client) VolumeExists(ctx context.Context, name string) (bool, error) {
+	err := c.doJson(ctx, http.MethodGet, "/volumes/"+name, nil, nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "could not inspect volume '%s'", name)
+	}
+	return true, nil
+}
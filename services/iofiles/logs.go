@@ -1,11 +1,13 @@
 package iofiles
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -41,10 +43,17 @@ func NewImageLogFile(appFolder string, sourceId, jobId int, readonly bool) (*Log
 	return &LogFile{file: file, readonly: readonly}, nil
 }
 
+// Gets the path of the job's log file
+func GetLogFilePath(appFolder string, sourceId, jobId int) string {
+	return filepath.Join(appFolder, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId), "logs.txt")
+}
+
 // LogFile helper instance for reading and writing log data
 type LogFile struct {
 	file     *os.File
 	readonly bool
+	// guards writes as tasks running in parallel write to the same file
+	lock sync.Mutex
 }
 
 // Writes the error or logs into the log file and into the standard output
@@ -52,6 +61,9 @@ func (l *LogFile) Write(content interface{}) error {
 	if l.readonly {
 		return errors.New("cannot append content when file is readonly")
 	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
 	mw := io.MultiWriter(os.Stdout, l.file)
 	logger := log.New()
 	logger.SetOutput(mw)
@@ -60,6 +72,74 @@ func (l *LogFile) Write(content interface{}) error {
 	return nil
 }
 
+// Creates a writer which appends each line written to it into the log file with the
+// prefix in front. Incomplete lines are held until the line ends or Flush is called
+func (l *LogFile) PrefixWriter(prefix string) *PrefixWriter {
+	return &PrefixWriter{log: l, prefix: prefix}
+}
+
+// Writes lines into a LogFile with a prefix in front of each line
+type PrefixWriter struct {
+	log    *LogFile
+	prefix string
+	buffer []byte
+	lock   sync.Mutex
+}
+
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buffer = append(w.buffer, p...)
+	index := bytes.LastIndexByte(w.buffer, '\n')
+	if index < 0 {
+		return len(p), nil
+	}
+
+	lines := w.buffer[:index+1]
+	if err := w.writeLines(lines); err != nil {
+		return 0, err
+	}
+	w.buffer = append(w.buffer[:0], w.buffer[index+1:]...)
+
+	return len(p), nil
+}
+
+// Writes any incomplete line held by the writer into the log file
+func (w *PrefixWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	err := w.writeLines(append(w.buffer, '\n'))
+	w.buffer = w.buffer[:0]
+	return err
+}
+
+func (w *PrefixWriter) writeLines(lines []byte) error {
+	if w.log.readonly {
+		return errors.New("cannot append content when file is readonly")
+	}
+
+	var content bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) > 0 {
+			content.WriteString(w.prefix)
+			content.Write(line)
+		}
+	}
+
+	w.log.lock.Lock()
+	defer w.log.lock.Unlock()
+	if _, err := w.log.file.Write(content.Bytes()); err != nil {
+		return errors.Wrap(err, "could not write to log file")
+	}
+	return nil
+}
+
 // Closes the LogFile, rendering it unusable anymore
 func (l *LogFile) Close() {
 	_ = l.file.Close()
@@ -0,0 +1,40 @@
+package iofiles_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/iofiles"
+)
+
+func TestLogFile_PrefixWriter(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-logs")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	logFile, err := NewLogFile(dir, 1, 1, false)
+	assert.NoError(err)
+	defer logFile.Close()
+
+	a := logFile.PrefixWriter("[A] ")
+	b := logFile.PrefixWriter("[B] ")
+
+	_, err = a.Write([]byte("first line\nsecond "))
+	assert.NoError(err)
+	_, err = b.Write([]byte("other line\n"))
+	assert.NoError(err)
+	_, err = a.Write([]byte("line\nincomplete"))
+	assert.NoError(err)
+	assert.NoError(a.Flush())
+	assert.NoError(b.Flush())
+
+	content, err := ioutil.ReadFile(GetLogFilePath(dir, 1, 1))
+	assert.NoError(err)
+	assert.Equal("[A] first line\n[B] other line\n[A] second line\n[A] incomplete\n", string(content))
+}
@@ -1,20 +1,97 @@
 package iofiles
 
 import (
+	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Creates the folder to store the output from the tasks
 func GetOutputDir(appFolder string, sourceId, jobId int) (string, error) {
-	folder, err := createFolder(appFolder, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId), "output")
+	folder, err := createFolder(GetOutputDirPath(appFolder, sourceId, jobId))
 	if err != nil {
 		return "", err
 	}
 	return folder, nil
 }
 
+// Gets the path of the folder storing the output from the tasks without creating it
+func GetOutputDirPath(appFolder string, sourceId, jobId int) string {
+	return filepath.Join(appFolder, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId), "output")
+}
+
 // Gets the meta file path
 func GetMetaFilePath(appFolder string, sourceId, jobId int) string {
 	return filepath.Join(appFolder, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId), "meta.json")
 }
+
+// A file or folder in the output folder
+type OutputFile struct {
+	// slash separated path relative to the output folder
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// Resolves the slash separated path relative to the root folder. Returns an error if
+// the path, after following symbolic links, is outside the root folder
+func ResolvePath(root, relPath string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", errors.Wrap(err, "output folder does not exist")
+	}
+
+	// cleaning the path as an absolute path removes every leading ".."
+	clean := path.Clean("/" + strings.ReplaceAll(relPath, "\\", "/"))
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(clean)))
+	if err != nil {
+		return "", errors.Errorf("'%s' does not exist", relPath)
+	}
+
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", errors.Errorf("'%s' is outside the output folder", relPath)
+	}
+	return resolved, nil
+}
+
+// Lists the files and folders in the folder recursively. Paths are relative to the
+// folder. Symbolic links are skipped as they may point outside the folder
+func ListFiles(folder string) ([]*OutputFile, error) {
+	files := make([]*OutputFile, 0)
+	err := walk(folder, func(relPath string, info os.FileInfo) error {
+		file := &OutputFile{Path: relPath, ModTime: info.ModTime(), IsDir: info.IsDir()}
+		if !info.IsDir() {
+			file.Size = info.Size()
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Walks the folder's regular files and folders, skipping the folder itself and any
+// symbolic links
+func walk(folder string, fn func(relPath string, info os.FileInfo) error) error {
+	return filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if path == folder || !(info.Mode().IsRegular() || info.IsDir()) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(relPath), info)
+	})
+}
@@ -0,0 +1,81 @@
+package iofiles_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/iofiles"
+)
+
+// Creates an output folder with nested files and a symbolic link pointing outside it
+func newOutputFolder(assert *require.Assertions) (root, outside string) {
+	dir, err := ioutil.TempDir("", "nida-output")
+	assert.NoError(err)
+
+	root = filepath.Join(dir, "output")
+	outside = filepath.Join(dir, "secret.txt")
+	assert.NoError(os.MkdirAll(filepath.Join(root, "a", "b"), 0777))
+	assert.NoError(ioutil.WriteFile(filepath.Join(root, "top.txt"), []byte("top"), 0666))
+	assert.NoError(ioutil.WriteFile(filepath.Join(root, "a", "b", "deep.csv"), []byte("x,y\n1,2\n"), 0666))
+	assert.NoError(ioutil.WriteFile(outside, []byte("secret"), 0666))
+	assert.NoError(os.Symlink(outside, filepath.Join(root, "link.txt")))
+
+	return root, outside
+}
+
+func TestResolvePath(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	root, _ := newOutputFolder(assert)
+	defer func() { _ = os.RemoveAll(filepath.Dir(root)) }()
+	realRoot, err := filepath.EvalSymlinks(root)
+	assert.NoError(err)
+
+	for _, test := range []struct {
+		Path     string
+		Expected string
+		HasError bool
+	}{
+		{"", realRoot, false},
+		{"top.txt", filepath.Join(realRoot, "top.txt"), false},
+		{"/a/b/deep.csv", filepath.Join(realRoot, "a", "b", "deep.csv"), false},
+		{"a/../top.txt", filepath.Join(realRoot, "top.txt"), false},
+		{"../secret.txt", "", true}, // cleaned to /secret.txt which does not exist
+		{"../../etc", "", true},     // cleaned to /etc which does not exist in the root
+		{"link.txt", "", true},      // points outside the root
+		{"a\\..\\..\\secret.txt", "", true},
+		{"missing.txt", "", true},
+	} {
+		path, err := ResolvePath(root, test.Path)
+		if test.HasError {
+			assert.Error(err, test.Path)
+		} else {
+			assert.NoError(err, test.Path)
+			assert.Equal(test.Expected, path)
+		}
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	root, _ := newOutputFolder(assert)
+	defer func() { _ = os.RemoveAll(filepath.Dir(root)) }()
+
+	files, err := ListFiles(root)
+	assert.NoError(err)
+
+	sizes := make(map[string]int64)
+	for _, f := range files {
+		sizes[f.Path] = f.Size
+		assert.False(f.ModTime.IsZero())
+		assert.Equal(f.Path == "a" || f.Path == "a/b", f.IsDir, f.Path)
+	}
+	assert.Equal(map[string]int64{"a": 0, "a/b": 0, "a/b/deep.csv": 8, "top.txt": 3}, sizes)
+}
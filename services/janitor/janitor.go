@@ -0,0 +1,362 @@
+package janitor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"nidavellir/config"
+	"nidavellir/libs"
+	"nidavellir/services/docker/dkimage"
+	"nidavellir/services/repo"
+	"nidavellir/services/store"
+)
+
+type IStore interface {
+	GetSources(options *store.GetSourceOption) ([]*store.Source, error)
+	GetJobs(options *store.ListJobOption) ([]*store.Job, error)
+	RemoveJobs(ids []int) error
+}
+
+// What a clean up removed
+type Report struct {
+	Jobs int
+	// bytes removed from the job folders
+	JobBytes int64
+	Repos    int
+	// space reclaimed from dangling images as reported by docker
+	Images string
+}
+
+// Janitor periodically removes ended jobs according to the retention policy together
+// with their files, the repos of removed sources and dangling images
+type Janitor struct {
+	ctx        context.Context
+	cancelFunc func()
+	db         IStore
+	appFolder  string
+	conf       config.RetentionConfig
+	// removes dangling images. Nil if images are not pruned
+	pruneImages func() (string, error)
+}
+
+func New(db IStore, conf *config.Config) *Janitor {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	j := &Janitor{
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+		db:         db,
+		appFolder:  conf.App.WorkDir,
+		conf:       conf.Retention,
+	}
+	if conf.Retention.PruneImages {
+		j.pruneImages = dkimage.PruneDangling
+	}
+	return j
+}
+
+// Cleans up at every interval until the janitor is closed
+func (j *Janitor) Start() {
+	ticker := time.NewTicker(j.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := j.Run()
+		if err != nil {
+			log.Error(errors.Wrap(err, "errors occurred during clean up"))
+		}
+		log.WithFields(log.Fields{
+			"jobs":      report.Jobs,
+			"job-bytes": report.JobBytes,
+			"repos":     report.Repos,
+			"images":    report.Images,
+		}).Info("Clean up done")
+
+		select {
+		case <-j.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Janitor) Close() {
+	j.cancelFunc()
+}
+
+// Removes the ended jobs which are not retained, followed by the folders of removed
+// sources and finally the dangling images. Errors do not stop the clean up
+func (j *Janitor) Run() (*Report, error) {
+	report := &Report{}
+
+	sources, err := j.db.GetSources(nil)
+	if err != nil {
+		return report, err
+	}
+
+	var errs error
+	if err := j.pruneJobs(sources, report); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := j.pruneRemovedSources(sources, report); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if j.pruneImages != nil {
+		reclaimed, err := j.pruneImages()
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		report.Images = reclaimed
+	}
+
+	return report, errs
+}
+
+type jobFolder struct {
+	job  *store.Job
+	path string
+	size int64
+}
+
+func (j *Janitor) pruneJobs(sources []*store.Source, report *Report) error {
+	var expired, retained []*jobFolder
+
+	for _, source := range sources {
+		jobs, err := j.db.GetJobs(&store.ListJobOption{
+			SourceId:   source.Id,
+			State:      []string{store.JobSuccess, store.JobFailure, store.JobCancelled},
+			SortBy:     store.JobSortId,
+			Descending: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		keepJobs, keepDays := j.conf.KeepJobs, j.conf.KeepDays
+		if source.KeepJobs > 0 {
+			keepJobs = source.KeepJobs
+		}
+		if source.KeepDays > 0 {
+			keepDays = source.KeepDays
+		}
+		cutoff := time.Now().AddDate(0, 0, -keepDays)
+
+		for i, job := range jobs {
+			folder := &jobFolder{job: job, path: j.jobPath(job)}
+			if (keepJobs > 0 && i >= keepJobs) || (keepDays > 0 && job.EndTime.Before(cutoff)) {
+				expired = append(expired, folder)
+			} else {
+				retained = append(retained, folder)
+			}
+		}
+	}
+
+	if maxSize := j.conf.MaxSizeBytes(); maxSize > 0 {
+		total, err := dirSize(filepath.Join(j.appFolder, "jobs"))
+		if err != nil {
+			return err
+		}
+		for _, f := range expired {
+			if f.size, err = dirSize(f.path); err != nil {
+				return err
+			}
+			total -= f.size
+		}
+
+		// the oldest jobs are removed first until the folders fit
+		sort.Slice(retained, func(a, b int) bool {
+			return retained[a].job.EndTime.Before(retained[b].job.EndTime)
+		})
+		for _, f := range retained {
+			if total <= maxSize {
+				break
+			}
+			if f.size, err = dirSize(f.path); err != nil {
+				return err
+			}
+			total -= f.size
+			expired = append(expired, f)
+		}
+	}
+
+	return j.removeJobs(expired, report)
+}
+
+// Removes the job rows before their folders so that jobs are never listed without
+// their files
+func (j *Janitor) removeJobs(folders []*jobFolder, report *Report) error {
+	if len(folders) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(folders))
+	for i, f := range folders {
+		ids[i] = f.job.Id
+	}
+	if err := j.db.RemoveJobs(ids); err != nil {
+		return err
+	}
+	report.Jobs += len(ids)
+
+	var errs error
+	for _, f := range folders {
+		size, err := dirSize(f.path)
+		if err == nil {
+			err = os.RemoveAll(f.path)
+		}
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not remove folder of job %d", f.job.Id))
+			continue
+		}
+		report.JobBytes += size
+	}
+	return errs
+}
+
+// Removes the job folders, repos and worktrees of sources which no longer exist
+func (j *Janitor) pruneRemovedSources(sources []*store.Source, report *Report) error {
+	ids := make(map[string]bool, len(sources))
+	names := make(map[string]bool, len(sources))
+	for _, s := range sources {
+		ids[strconv.Itoa(s.Id)] = true
+		names[s.UniqueName] = true
+	}
+
+	var errs error
+	jobsFolder := filepath.Join(j.appFolder, "jobs")
+	var orphans []string
+	for _, name := range subFolders(jobsFolder) {
+		if !ids[name] {
+			orphans = append(orphans, name)
+		}
+	}
+
+	// a source created after the sources were listed may already have running jobs. As
+	// sources are saved before their folders are made, listing the sources again after
+	// reading the folders finds all of them
+	if len(orphans) > 0 {
+		current, err := j.db.GetSources(nil)
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrap(err, "could not check if the sources of the job folders exist"))
+			orphans = nil
+		}
+		for _, s := range current {
+			ids[strconv.Itoa(s.Id)] = true
+		}
+	}
+
+	for _, name := range orphans {
+		if ids[name] {
+			continue
+		}
+
+		path := filepath.Join(jobsFolder, name)
+		size, err := dirSize(path)
+		if err == nil {
+			err = os.RemoveAll(path)
+		}
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not remove job folders of source %s", name))
+			continue
+		}
+		report.JobBytes += size
+	}
+
+	// the worktrees are left behind by jobs which were interrupted
+	var removed []string
+	for _, folder := range []string{"repos", "worktrees"} {
+		for _, name := range subFolders(filepath.Join(j.appFolder, folder)) {
+			if !names[name] && !libs.IsIn(name, removed) {
+				removed = append(removed, name)
+			}
+		}
+	}
+	for _, name := range removed {
+		if err := j.removeRepo(name, report); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Removes the bare clone and the worktrees of the repo while holding the repo lock. The
+// repo is kept if its source was added again after the sources were listed
+func (j *Janitor) removeRepo(name string, report *Report) error {
+	unlock := repo.LockRepo(j.appFolder, name)
+	defer unlock()
+
+	sources, err := j.db.GetSources(nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not check if the source of repo %s exists", name)
+	}
+	for _, s := range sources {
+		if s.UniqueName == name {
+			return nil
+		}
+	}
+
+	gitDir := filepath.Join(j.appFolder, "repos", name)
+	if libs.PathExists(gitDir) {
+		if err := os.RemoveAll(gitDir); err != nil {
+			return errors.Wrapf(err, "could not remove repo %s", name)
+		}
+		report.Repos++
+	}
+
+	if err := os.RemoveAll(filepath.Join(j.appFolder, "worktrees", name)); err != nil {
+		return errors.Wrapf(err, "could not remove worktrees of repo %s", name)
+	}
+	return nil
+}
+
+func (j *Janitor) jobPath(job *store.Job) string {
+	return filepath.Join(j.appFolder, "jobs", strconv.Itoa(job.SourceId), strconv.Itoa(job.Id))
+}
+
+// Lists the names of the folders in the folder. Returns nil if the folder does not exist
+func subFolders(folder string) []string {
+	infos, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names
+}
+
+// Gets the total size of the files in the folder. Folders which do not exist are empty
+func dirSize(folder string) (int64, error) {
+	var size int64
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not get size of %s", folder)
+	}
+	return size, nil
+}
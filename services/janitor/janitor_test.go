@@ -0,0 +1,193 @@
+package janitor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/config"
+	"nidavellir/libs"
+	. "nidavellir/services/janitor"
+	"nidavellir/services/store"
+)
+
+type mockStore struct {
+	sources []*store.Source
+	// sources returned from the second listing on, as if added during the clean up
+	added   []*store.Source
+	listed  int
+	jobs    map[int]*store.Job
+	removed []int
+}
+
+func (m *mockStore) GetSources(_ *store.GetSourceOption) ([]*store.Source, error) {
+	m.listed++
+	if m.listed > 1 {
+		return append(m.sources, m.added...), nil
+	}
+	return m.sources, nil
+}
+
+func (m *mockStore) GetJobs(options *store.ListJobOption) ([]*store.Job, error) {
+	var jobs []*store.Job
+	for _, job := range m.jobs {
+		if job.SourceId == options.SourceId && libs.IsIn(job.State, options.State) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Id > jobs[j].Id })
+	return jobs, nil
+}
+
+func (m *mockStore) RemoveJobs(ids []int) error {
+	for _, id := range ids {
+		delete(m.jobs, id)
+	}
+	m.removed = append(m.removed, ids...)
+	return nil
+}
+
+// Creates the job folders with a file of the given size in each
+func newWorkDir(t *testing.T, jobs map[int]*store.Job, size int, repos ...string) string {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-janitor")
+	assert.NoError(err)
+
+	for _, job := range jobs {
+		folder := filepath.Join(dir, "jobs", strconv.Itoa(job.SourceId), strconv.Itoa(job.Id), "output")
+		assert.NoError(os.MkdirAll(folder, 0777))
+		assert.NoError(ioutil.WriteFile(filepath.Join(folder, "data.csv"), make([]byte, size), 0644))
+	}
+	for _, repo := range repos {
+		assert.NoError(os.MkdirAll(filepath.Join(dir, "repos", repo), 0777))
+		assert.NoError(os.MkdirAll(filepath.Join(dir, "worktrees", repo, "1"), 0777))
+	}
+	return dir
+}
+
+func newJanitor(t *testing.T, db IStore, workDir string, retention config.RetentionConfig) *Janitor {
+	require.NoError(t, retention.Validate())
+	conf := &config.Config{Retention: retention}
+	conf.App.WorkDir = workDir
+	return New(db, conf)
+}
+
+func jobExists(workDir string, sourceId, jobId int) bool {
+	return libs.PathExists(filepath.Join(workDir, "jobs", strconv.Itoa(sourceId), strconv.Itoa(jobId)))
+}
+
+func TestJanitor_Run(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -10)
+	db := &mockStore{
+		sources: []*store.Source{
+			{Id: 1, UniqueName: "source-one", KeepJobs: 2},
+			{Id: 2, UniqueName: "source-two"},
+		},
+		jobs: map[int]*store.Job{
+			1: {Id: 1, SourceId: 1, State: store.JobSuccess, EndTime: now},
+			2: {Id: 2, SourceId: 1, State: store.JobFailure, EndTime: now},
+			3: {Id: 3, SourceId: 1, State: store.JobSuccess, EndTime: now},
+			4: {Id: 4, SourceId: 1, State: store.JobCancelled, EndTime: now},
+			5: {Id: 5, SourceId: 2, State: store.JobSuccess, EndTime: old},
+			6: {Id: 6, SourceId: 2, State: store.JobSuccess, EndTime: now},
+			// running jobs are never removed
+			7: {Id: 7, SourceId: 2, State: store.JobRunning},
+			// job of a removed source
+			8: {Id: 8, SourceId: 9, State: store.JobSuccess, EndTime: old},
+		},
+	}
+
+	workDir := newWorkDir(t, db.jobs, 100, "source-one", "removed-source")
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	janitor := newJanitor(t, db, workDir, config.RetentionConfig{KeepDays: 7})
+	report, err := janitor.Run()
+	assert.NoError(err)
+
+	sort.Ints(db.removed)
+	assert.Equal([]int{1, 2, 5}, db.removed)
+	assert.Equal(3, report.Jobs)
+	assert.EqualValues(400, report.JobBytes)
+	assert.Equal(1, report.Repos)
+
+	for _, job := range []*store.Job{db.jobs[3], db.jobs[4], db.jobs[6], db.jobs[7]} {
+		assert.True(jobExists(workDir, job.SourceId, job.Id), "job %d should be kept", job.Id)
+	}
+	for _, id := range []int{1, 2} {
+		assert.False(jobExists(workDir, 1, id))
+	}
+	assert.False(jobExists(workDir, 2, 5))
+	assert.False(libs.PathExists(filepath.Join(workDir, "jobs", "9")))
+	assert.True(libs.PathExists(filepath.Join(workDir, "repos", "source-one")))
+	assert.False(libs.PathExists(filepath.Join(workDir, "repos", "removed-source")))
+	assert.True(libs.PathExists(filepath.Join(workDir, "worktrees", "source-one")))
+	assert.False(libs.PathExists(filepath.Join(workDir, "worktrees", "removed-source")))
+}
+
+func TestJanitor_RunAddedSource(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	db := &mockStore{
+		sources: []*store.Source{{Id: 1, UniqueName: "source-one"}},
+		added:   []*store.Source{{Id: 2, UniqueName: "source-two"}},
+	}
+
+	jobs := map[int]*store.Job{
+		1: {Id: 1, SourceId: 2, State: store.JobRunning},
+		2: {Id: 2, SourceId: 9, State: store.JobSuccess},
+	}
+	workDir := newWorkDir(t, jobs, 100, "source-one", "source-two", "removed-source")
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	// the jobs and repo of a source added after the sources were listed are kept
+	report, err := newJanitor(t, db, workDir, config.RetentionConfig{}).Run()
+	assert.NoError(err)
+	assert.Equal(1, report.Repos)
+	assert.EqualValues(100, report.JobBytes)
+	assert.True(jobExists(workDir, 2, 1))
+	assert.False(jobExists(workDir, 9, 2))
+	assert.True(libs.PathExists(filepath.Join(workDir, "repos", "source-two")))
+	assert.True(libs.PathExists(filepath.Join(workDir, "worktrees", "source-two")))
+	assert.False(libs.PathExists(filepath.Join(workDir, "repos", "removed-source")))
+	assert.False(libs.PathExists(filepath.Join(workDir, "worktrees", "removed-source")))
+}
+
+func TestJanitor_RunMaxSize(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	now := time.Now()
+	db := &mockStore{
+		sources: []*store.Source{{Id: 1, UniqueName: "source-one"}},
+		jobs: map[int]*store.Job{
+			1: {Id: 1, SourceId: 1, State: store.JobSuccess, EndTime: now.Add(-time.Minute)},
+			2: {Id: 2, SourceId: 1, State: store.JobSuccess, EndTime: now.Add(-time.Hour)},
+			3: {Id: 3, SourceId: 1, State: store.JobSuccess, EndTime: now},
+		},
+	}
+
+	workDir := newWorkDir(t, db.jobs, 600)
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	janitor := newJanitor(t, db, workDir, config.RetentionConfig{MaxSize: "1KB"})
+	report, err := janitor.Run()
+	assert.NoError(err)
+
+	// the jobs which ended first are removed until the folders fit
+	sort.Ints(db.removed)
+	assert.Equal([]int{1, 2}, db.removed)
+	assert.EqualValues(1200, report.JobBytes)
+	assert.True(jobExists(workDir, 1, 3))
+}
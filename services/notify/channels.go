@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+	"nidavellir/services/store"
+)
+
+const (
+	// Header holding the hex encoded HMAC-SHA256 signature of the webhook body
+	SignatureHeader = "X-Nida-Signature"
+	// Header holding the webhook event name
+	EventHeader = "X-Nida-Event"
+	// Event name sent with every webhook notification
+	EventJobCompleted = "job.completed"
+)
+
+func newHttpClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// Signs the body with the secret. The signature is given as "sha256=<hex digest>"
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Posts the message as json. If the notification has a secret, the body is signed
+type webhookSender struct {
+	client *http.Client
+}
+
+func (s *webhookSender) Send(n *store.Notification, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "could not encode webhook message")
+	}
+
+	headers := map[string]string{EventHeader: EventJobCompleted}
+	if n.Secret != "" {
+		headers[SignatureHeader] = Sign(n.Secret, body)
+	}
+
+	return post(s.client, n.Target, body, headers)
+}
+
+// Posts a message in the format accepted by Slack-compatible incoming webhooks
+type slackSender struct {
+	client *http.Client
+}
+
+func (s *slackSender) Send(n *store.Notification, msg *Message) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{formatText(msg)})
+	if err != nil {
+		return errors.Wrap(err, "could not encode slack message")
+	}
+
+	return post(s.client, n.Target, body, nil)
+}
+
+// Emails the message through the configured SMTP server
+type emailSender struct {
+	conf config.SMTPConfig
+}
+
+func (s *emailSender) Send(n *store.Notification, msg *Message) error {
+	if !s.conf.Enabled() {
+		return errors.New("smtp server is not configured")
+	}
+
+	addresses, err := mail.ParseAddressList(n.Target)
+	if err != nil {
+		return errors.Wrapf(err, "invalid email addresses '%s'", n.Target)
+	}
+	var to []string
+	for _, a := range addresses {
+		to = append(to, a.Address)
+	}
+
+	var content bytes.Buffer
+	_, _ = fmt.Fprintf(&content, "From: %s\r\n", s.conf.From)
+	_, _ = fmt.Fprintf(&content, "To: %s\r\n", strings.Join(to, ", "))
+	// header values must not contain line breaks
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(formatSubject(msg))
+	_, _ = fmt.Fprintf(&content, "Subject: %s\r\n", subject)
+	_, _ = fmt.Fprint(&content, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	_, _ = fmt.Fprint(&content, strings.ReplaceAll(formatText(msg), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.conf.Username != "" {
+		auth = smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.conf.Host, s.conf.Port)
+	if err := smtp.SendMail(addr, auth, s.conf.From, to, content.Bytes()); err != nil {
+		return errors.Wrap(err, "could not send email")
+	}
+	return nil
+}
+
+func post(client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not send request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("received status %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+func formatSubject(msg *Message) string {
+	if msg.Recovered {
+		return fmt.Sprintf("[Nidavellir] %s recovered (job %d)", msg.Source, msg.JobId)
+	}
+	return fmt.Sprintf("[Nidavellir] %s job %d: %s", msg.Source, msg.JobId, msg.State)
+}
+
+func formatText(msg *Message) string {
+	lines := []string{
+		formatSubject(msg),
+		fmt.Sprintf("Trigger: %s", msg.Trigger),
+		fmt.Sprintf("Attempt: %d", msg.Attempt),
+		fmt.Sprintf("Started: %s", msg.StartTime.Format(time.RFC3339)),
+		fmt.Sprintf("Ended: %s", msg.EndTime.Format(time.RFC3339)),
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+	"nidavellir/services/store"
+)
+
+type IStore interface {
+	// Gets all notifications of the source
+	GetNotifications(sourceId int) ([]*store.Notification, error)
+
+	// Gets the source's last job which ended before the given job
+	GetPreviousJob(job *store.Job) (*store.Job, error)
+
+	// Records an attempt to send a notification
+	AddNotificationDelivery(delivery *store.NotificationDelivery) (*store.NotificationDelivery, error)
+}
+
+// Details of the ended job which are sent to every channel
+type Message struct {
+	SourceId  int       `json:"sourceId"`
+	Source    string    `json:"source"`
+	JobId     int       `json:"jobId"`
+	State     string    `json:"state"`
+	Trigger   string    `json:"trigger"`
+	Attempt   int       `json:"attempt"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// true if the job succeeded after the previous job failed
+	Recovered bool `json:"recovered"`
+}
+
+// Sends a message to a notification channel
+type sender interface {
+	Send(n *store.Notification, msg *Message) error
+}
+
+// Notifier sends job notifications to the channels configured for each source.
+// Notifications are sent in the background and failed deliveries are retried
+type Notifier struct {
+	db       IStore
+	senders  map[string]sender
+	attempts int
+	backoff  time.Duration
+	wg       sync.WaitGroup
+	// closed on shutdown so that pending retries are sent without waiting out their delay
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func New(db IStore, conf config.NotifyConfig) *Notifier {
+	attempts := conf.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	client := newHttpClient()
+	return &Notifier{
+		db: db,
+		senders: map[string]sender{
+			store.ChannelWebhook: &webhookSender{client: client},
+			store.ChannelSlack:   &slackSender{client: client},
+			store.ChannelEmail:   &emailSender{conf: conf.SMTP},
+		},
+		attempts: attempts,
+		backoff:  conf.Backoff,
+		closing:  make(chan struct{}),
+	}
+}
+
+// Notifies the source's channels that the job has ended. The notifications are sent
+// in the background
+func (n *Notifier) JobCompleted(source *store.Source, job *store.Job) {
+	notifications, err := n.db.GetNotifications(source.Id)
+	if err != nil {
+		log.Println(errors.Wrap(err, "could not get notifications"))
+		return
+	} else if len(notifications) == 0 {
+		return
+	}
+
+	prev, err := n.db.GetPreviousJob(job)
+	if err != nil {
+		log.Println(errors.Wrap(err, "could not get previous job to check for recovery"))
+	}
+
+	msg := &Message{
+		SourceId:  source.Id,
+		Source:    source.Name,
+		JobId:     job.Id,
+		State:     job.State,
+		Trigger:   job.Trigger,
+		Attempt:   job.Attempt,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Recovered: job.State == store.JobSuccess && prev != nil && prev.State == store.JobFailure,
+	}
+
+	for _, notification := range notifications {
+		if !shouldNotify(notification.NotifyOn, msg) {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(notification *store.Notification) {
+			defer n.wg.Done()
+			n.deliver(notification, msg)
+		}(notification)
+	}
+}
+
+// Waits for all notifications which are being sent to complete
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// Sends the pending retries without waiting out their delay and waits up to the timeout
+// for all notifications to complete. Returns false if some were still being sent when
+// the timeout expired
+func (n *Notifier) Close(timeout time.Duration) bool {
+	n.closeOnce.Do(func() { close(n.closing) })
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Sends the notification, retrying it until it succeeds or runs out of attempts.
+// Every attempt is recorded
+func (n *Notifier) deliver(notification *store.Notification, msg *Message) {
+	s, exists := n.senders[notification.Channel]
+	if !exists {
+		log.Printf("notification %d has unknown channel '%s'", notification.Id, notification.Channel)
+		return
+	}
+
+	delay := n.backoff
+	for attempt := 1; attempt <= n.attempts; attempt++ {
+		err := s.Send(notification, msg)
+
+		delivery := &store.NotificationDelivery{
+			NotificationId: notification.Id,
+			JobId:          msg.JobId,
+			Attempt:        attempt,
+			Time:           time.Now(),
+			Success:        err == nil,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if _, dbErr := n.db.AddNotificationDelivery(delivery); dbErr != nil {
+			log.Println(dbErr)
+		}
+
+		if err == nil {
+			return
+		}
+		log.Println(errors.Wrapf(err, "could not send notification %d for job %d (attempt %d of %d)", notification.Id, msg.JobId, attempt, n.attempts))
+
+		if attempt < n.attempts {
+			select {
+			case <-time.After(delay):
+			case <-n.closing:
+			}
+			delay *= 2
+		}
+	}
+}
+
+// Checks if the rule requires a notification for the message
+func shouldNotify(rule string, msg *Message) bool {
+	switch rule {
+	case store.NotifyAlways:
+		return true
+	case store.NotifyOnFailure:
+		return msg.State == store.JobFailure
+	case store.NotifyOnRecovery:
+		return msg.State == store.JobFailure || msg.Recovered
+	default:
+		return false
+	}
+}
@@ -0,0 +1,227 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/config"
+	. "nidavellir/services/notify"
+	"nidavellir/services/store"
+)
+
+type mockStore struct {
+	sync.Mutex
+	notifications []*store.Notification
+	previous      *store.Job
+	deliveries    []*store.NotificationDelivery
+}
+
+func (m *mockStore) GetNotifications(sourceId int) ([]*store.Notification, error) {
+	var notifications []*store.Notification
+	for _, n := range m.notifications {
+		if n.SourceId == sourceId {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *mockStore) GetPreviousJob(*store.Job) (*store.Job, error) {
+	return m.previous, nil
+}
+
+func (m *mockStore) AddNotificationDelivery(delivery *store.NotificationDelivery) (*store.NotificationDelivery, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	delivery.Id = len(m.deliveries) + 1
+	m.deliveries = append(m.deliveries, delivery)
+	return delivery, nil
+}
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// Starts a server which records the requests it receives. The first "failures"
+// requests receive an error response
+func newServer(t *testing.T, failures int) (*httptest.Server, func() []request) {
+	var lock sync.Mutex
+	var requests []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, request{r.Header, body})
+		if len(requests) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+
+	return server, func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func newConfig() config.NotifyConfig {
+	return config.NotifyConfig{Attempts: 3, Backoff: time.Millisecond}
+}
+
+func TestNotifier_Webhook(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	server, requests := newServer(t, 0)
+	defer server.Close()
+	db := &mockStore{notifications: []*store.Notification{
+		{Id: 1, SourceId: 1, Channel: store.ChannelWebhook, Target: server.URL, Secret: "secret", NotifyOn: store.NotifyAlways},
+	}}
+
+	n := New(db, newConfig())
+	n.JobCompleted(&store.Source{Id: 1, Name: "Project"}, &store.Job{Id: 5, State: store.JobSuccess, Attempt: 1})
+	n.Wait()
+
+	received := requests()
+	assert.Len(received, 1)
+	assert.Equal(EventJobCompleted, received[0].header.Get(EventHeader))
+	assert.Equal(Sign("secret", received[0].body), received[0].header.Get(SignatureHeader))
+
+	var msg Message
+	assert.NoError(json.Unmarshal(received[0].body, &msg))
+	assert.Equal(5, msg.JobId)
+	assert.Equal("Project", msg.Source)
+	assert.Equal(store.JobSuccess, msg.State)
+
+	assert.Len(db.deliveries, 1)
+	assert.True(db.deliveries[0].Success)
+}
+
+func TestNotifier_Slack(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	server, requests := newServer(t, 0)
+	defer server.Close()
+	db := &mockStore{notifications: []*store.Notification{
+		{Id: 1, SourceId: 1, Channel: store.ChannelSlack, Target: server.URL, NotifyOn: store.NotifyOnFailure},
+	}}
+
+	n := New(db, newConfig())
+	n.JobCompleted(&store.Source{Id: 1, Name: "Project"}, &store.Job{Id: 2, State: store.JobFailure, Attempt: 1})
+	n.Wait()
+
+	received := requests()
+	assert.Len(received, 1)
+	assert.Empty(received[0].header.Get(SignatureHeader))
+
+	var payload map[string]string
+	assert.NoError(json.Unmarshal(received[0].body, &payload))
+	assert.Contains(payload["text"], "Project job 2: FAILURE")
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Failures   int
+		Deliveries int
+		Success    bool
+	}{
+		{0, 1, true},
+		{2, 3, true},
+		{5, 3, false},
+	} {
+		server, requests := newServer(t, test.Failures)
+		defer server.Close()
+		db := &mockStore{notifications: []*store.Notification{
+			{Id: 1, SourceId: 1, Channel: store.ChannelWebhook, Target: server.URL, NotifyOn: store.NotifyAlways},
+		}}
+
+		n := New(db, newConfig())
+		n.JobCompleted(&store.Source{Id: 1}, &store.Job{Id: 1, State: store.JobSuccess})
+		n.Wait()
+
+		assert.Len(requests(), test.Deliveries)
+		assert.Len(db.deliveries, test.Deliveries)
+		for i, d := range db.deliveries {
+			assert.Equal(i+1, d.Attempt)
+		}
+
+		last := db.deliveries[len(db.deliveries)-1]
+		assert.Equal(test.Success, last.Success)
+		if !test.Success {
+			assert.Contains(last.Error, "503")
+		}
+	}
+}
+
+func TestNotifier_Close(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	server, requests := newServer(t, 5)
+	defer server.Close()
+	db := &mockStore{notifications: []*store.Notification{
+		{Id: 1, SourceId: 1, Channel: store.ChannelWebhook, Target: server.URL, NotifyOn: store.NotifyAlways},
+	}}
+
+	// the pending retries are sent right away instead of after the hour long backoff
+	n := New(db, config.NotifyConfig{Attempts: 3, Backoff: time.Hour})
+	n.JobCompleted(&store.Source{Id: 1}, &store.Job{Id: 1, State: store.JobFailure})
+	assert.True(n.Close(10 * time.Second))
+	assert.Len(requests(), 3)
+	assert.True(n.Close(time.Second), "closing again does not panic")
+}
+
+func TestNotifier_Rules(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Rule     string
+		State    string
+		Previous string
+		Expected bool
+	}{
+		{store.NotifyAlways, store.JobSuccess, store.JobSuccess, true},
+		{store.NotifyAlways, store.JobFailure, store.JobSuccess, true},
+		{store.NotifyOnFailure, store.JobSuccess, store.JobFailure, false},
+		{store.NotifyOnFailure, store.JobFailure, store.JobSuccess, true},
+		{store.NotifyOnRecovery, store.JobSuccess, store.JobSuccess, false},
+		{store.NotifyOnRecovery, store.JobSuccess, store.JobFailure, true},
+		{store.NotifyOnRecovery, store.JobFailure, store.JobSuccess, true},
+	} {
+		server, requests := newServer(t, 0)
+		defer server.Close()
+		db := &mockStore{
+			notifications: []*store.Notification{
+				{Id: 1, SourceId: 1, Channel: store.ChannelWebhook, Target: server.URL, NotifyOn: test.Rule},
+			},
+			previous: &store.Job{Id: 1, State: test.Previous},
+		}
+
+		n := New(db, newConfig())
+		n.JobCompleted(&store.Source{Id: 1}, &store.Job{Id: 2, State: test.State})
+		n.Wait()
+
+		if test.Expected {
+			assert.Len(requests(), 1, "rule %s with state %s after %s", test.Rule, test.State, test.Previous)
+		} else {
+			assert.Empty(requests(), "rule %s with state %s after %s", test.Rule, test.State, test.Previous)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// Checks if any task in the runtime config declares its dependencies
+func hasDependencies(steps []rStep) bool {
+	for _, s := range steps {
+		for _, t := range s.Tasks {
+			if len(t.DependsOn) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validates and completes the dependencies of every task. Tasks which do not declare
+// any dependency depend on all tasks in the previous step, so the step order is kept
+// unless a task says otherwise. Task names must be unique across steps, branching is
+// not allowed and the dependencies cannot form a cycle
+func resolveDependencies(steps []*Step) error {
+	var errs error
+
+	tasks := make(map[string]*TaskInfo)
+	for _, s := range steps {
+		if len(s.Branch) > 0 {
+			errs = multierror.Append(errs, errors.Errorf("step '%s' cannot have branch rules when tasks use depends_on", s.Name))
+		}
+
+		for _, t := range s.TaskInfoList {
+			if _, exists := tasks[t.Name]; exists {
+				errs = multierror.Append(errs, errors.Errorf("task name '%s' is used more than once. Task names must be unique when tasks use depends_on", t.Name))
+			}
+			tasks[t.Name] = t
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	for i, s := range steps {
+		for _, t := range s.TaskInfoList {
+			if len(t.DependsOn) == 0 {
+				if i > 0 {
+					for _, prev := range steps[i-1].TaskInfoList {
+						t.DependsOn = append(t.DependsOn, prev.Name)
+					}
+				}
+				continue
+			}
+
+			seen := make(map[string]bool, len(t.DependsOn))
+			var deps []string
+			for _, name := range t.DependsOn {
+				if name == t.Name {
+					errs = multierror.Append(errs, errors.Errorf("task '%s' cannot depend on itself", t.Name))
+				} else if _, exists := tasks[name]; !exists {
+					errs = multierror.Append(errs, errors.Errorf("task '%s' depends on unknown task '%s'", t.Name, name))
+				} else if !seen[name] {
+					seen[name] = true
+					deps = append(deps, name)
+				}
+			}
+			t.DependsOn = deps
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	return findCycle(steps, tasks)
+}
+
+// Returns an error describing the first dependency cycle found, if any
+func findCycle(steps []*Step, tasks map[string]*TaskInfo) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(tasks))
+
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// the cycle is the part of the path which starts with this task
+			for i, n := range path {
+				if n == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return errors.Errorf("tasks have a dependency cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range tasks[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	// visit in the runtime config order so that the error is deterministic
+	for _, s := range steps {
+		for _, t := range s.TaskInfoList {
+			if err := visit(t.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
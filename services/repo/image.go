@@ -1,15 +1,16 @@
 package repo
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"github.com/pkg/errors"
 
 	"nidavellir/config"
 	"nidavellir/libs"
+	"nidavellir/services/docker/dkimage"
 )
 
 type Builder struct {
@@ -68,25 +69,5 @@ func (b *Builder) ImageExists() (bool, error) {
 
 // Checks if the given image name exists
 func ImageExists(image string) (bool, error) {
-	hasTag := strings.Contains(image, ":")
-
-	args := []string{"image", "list", "--format"}
-	if hasTag {
-		args = append(args, "{{.Repository}}:{{.Tag}}")
-	} else {
-		args = append(args, "{{.Repository}}")
-	}
-
-	cmd := exec.Command("docker", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false, errors.Wrap(err, "could not get list of docker images")
-	}
-
-	for _, name := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if strings.TrimSpace(name) == image {
-			return true, nil
-		}
-	}
-	return false, nil
+	return dkimage.Exists(context.Background(), image)
 }
@@ -2,20 +2,28 @@ package repo
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"nidavellir/libs"
+	"nidavellir/services/docker/dkimage"
 )
 
 type Provider string
 
+// Longest time a git command may run. The repo stays locked while its remote is fetched,
+// so a remote which stops responding would otherwise hold up every job of the repo
+const gitTimeout = 30 * time.Minute
+
 const (
 	NoRemote     Provider = ""
 	Github       Provider = "github"
@@ -36,6 +44,34 @@ func ParseProvider(provider string) (Provider, error) {
 	}
 }
 
+// Host of the remote which the provider's tokens are sent to when no host is configured
+func (p Provider) defaultHost() string {
+	switch p {
+	case Github:
+		return "github.com"
+	case GitlabCI, GitlabOauth2:
+		return "gitlab.com"
+	default:
+		return ""
+	}
+}
+
+// Parses the url of a remote repository. Only remotes served over http or https are
+// accepted
+func ParseRemote(source string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(source))
+	if err != nil {
+		return nil, errors.Errorf("invalid repo url '%s'", source)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("expected repo url '%s' to use http or https", source)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("expected repo url '%s' to have a host", source)
+	}
+	return u, nil
+}
+
 type Repo struct {
 	// Repo source url
 	Source string
@@ -44,10 +80,17 @@ type Repo struct {
 
 	// The token provider. Use one of github, gitlab-ci-token or gitlab-oauth2
 	provider Provider
+	// host of the remote which the token belongs to. The token is not sent to other hosts
+	host string
 	// the token
 	token string
+	// stops the git commands when done. Nil is the same as context.Background
+	ctx context.Context
 
-	// Repo's file path. The root of that file path will be the working directory
+	// Path of the bare clone of the repo, which is shared by the jobs of the repo
+	GitDir string
+	// Path of the worktree which holds the repo at Commit. This is the working directory
+	// of the tasks. It is empty until AddWorktree is called
 	WorkDir string
 
 	// git commit to check out
@@ -56,18 +99,26 @@ type Repo struct {
 	Image string
 	// checks if the repo needs to build the image
 	NeedsBuild bool
+	// maximum duration of a job from this repo. 0 means no limit
+	Timeout time.Duration
+	// network mode of the task containers. See the modes in dkspec. Empty uses the
+	// default bridge network
+	Network string
+	// true when tasks declare their dependencies. The tasks are then run as a graph,
+	// each as soon as its dependencies succeed, instead of step by step
+	Graph bool
 
 	Steps []*Step
 }
 
 // Creates a new repository given the source (remote gitlab or github url) and
 // name (the unique identifier for the repo which will be used as the image name
-// and file path). It is assumed that the Repo is already that latest (so please
-// re-clone or pull the actual repo before calling NewRepo). If that is the case,
-// the repo will then checkout any previous versions as specified in the
-// runtime.yaml config file
-func NewRepo(source, name, appFolder, provider, token string) (*Repo, error) {
-	workDir, err := getWorkDir(appFolder, name)
+// and file path). The bare clone of the repo is fetched and the runtime.yaml config
+// file is read from master. The commit given in the config is checked out once a
+// worktree is added with AddWorktree. The token is only used for remotes at the host,
+// which defaults to the provider's public host if empty
+func NewRepo(source, name, appFolder, provider, host, token string) (*Repo, error) {
+	gitDir, err := getGitDir(appFolder, name)
 	if err != nil {
 		return nil, err
 	}
@@ -85,63 +136,121 @@ func NewRepo(source, name, appFolder, provider, token string) (*Repo, error) {
 		Source:   source,
 		Name:     libs.LowerTrimReplaceSpace(name),
 		provider: p,
+		host:     host,
 		token:    token,
-		WorkDir:  workDir,
+		GitDir:   gitDir,
 	}
-
-	if !r.Exists() {
-		err := r.Clone()
-		if err != nil {
-			return nil, err
-		}
+	if r.host == "" {
+		r.host = p.defaultHost()
 	}
 
-	err = r.formatRuntimeConfig(workDir)
-	if err != nil {
+	if err := r.Fetch(); err != nil {
 		return nil, err
 	}
 
-	// Checkout repo
-	if err := r.Checkout(); err != nil {
-		return nil, errors.Wrapf(err, "could not checkout '%s' for repo", r.Commit)
+	if err := r.formatRuntimeConfig(); err != nil {
+		return nil, err
 	}
 
 	return r, nil
 }
 
-// Clones the repo if it does not exists. If repo exists, checks if it is outdated. If repo is outdated,
-// remove original repo and clone it again (thus force updating it)
-func (r *Repo) Clone() error {
-	if r.Exists() {
-		if update, err := r.needsToUpdate(); err != nil {
-			return err
-		} else if !update {
-			return nil
+// Updates the bare clone of the repo with the branches and tags of the remote. The repo
+// is cloned if it does not exist. Clones made by earlier versions of the application,
+// which have a working tree, are replaced by a bare clone
+func (r *Repo) Fetch() error {
+	unlock := lockRepo(r.GitDir)
+	defer unlock()
+
+	if libs.PathExists(filepath.Join(r.GitDir, ".git")) {
+		if err := os.RemoveAll(r.GitDir); err != nil {
+			return errors.Wrap(err, "could not remove old repo")
+		}
+	}
+
+	if !r.Exists() {
+		if _, err := r.git(filepath.Dir(r.GitDir), "clone", "--bare", "--", r.gitUrl(), r.GitDir); err != nil {
+			return errors.Wrap(err, "could not clone repo")
 		}
+		return nil
+	}
+
+	if _, err := r.git(r.GitDir, "fetch", "--prune", "--tags", "--force", "--", r.gitUrl(), "+refs/heads/*:refs/heads/*"); err != nil {
+		return errors.Wrap(err, "could not fetch repo")
+	}
+
+	// forgets the worktrees whose folders no longer exist
+	if _, err := r.git(r.GitDir, "worktree", "prune"); err != nil {
+		return errors.Wrap(err, "could not prune worktrees")
+	}
+	return nil
+}
+
+// Checks out Commit into a worktree at dir. Returns a copy of the repo whose working
+// directory, and that of its tasks, is the worktree. The copy owns the worktree, which
+// is removed with RemoveWorktree. Anything left at dir, such as by an interrupted run of
+// the same job, is removed first
+func (r *Repo) AddWorktree(dir string) (*Repo, error) {
+	unlock := lockRepo(r.GitDir)
+	defer unlock()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, errors.Wrap(err, "could not clear worktree folder")
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+		return nil, errors.Wrap(err, "could not create worktree folder")
+	}
+	if _, err := r.git(r.GitDir, "worktree", "prune"); err != nil {
+		return nil, errors.Wrap(err, "could not prune worktrees")
+	}
+	if _, err := r.git(r.GitDir, "worktree", "add", "--detach", "--", dir, r.Commit); err != nil {
+		return nil, errors.Wrapf(err, "could not checkout '%s'", r.Commit)
+	}
 
-		if err := os.RemoveAll(r.WorkDir); err != nil {
-			return errors.Wrap(err, "could not update repo. old repo cannot be removed")
+	wt := *r
+	wt.WorkDir = dir
+	wt.Steps = make([]*Step, len(r.Steps))
+	for i, s := range r.Steps {
+		step := *s
+		step.TaskInfoList = make([]*TaskInfo, len(s.TaskInfoList))
+		for j, t := range s.TaskInfoList {
+			task := *t
+			task.WorkDir = dir
+			task.Env = make(map[string]string, len(t.Env))
+			for k, v := range t.Env {
+				task.Env[k] = v
+			}
+			step.TaskInfoList[j] = &task
 		}
+		wt.Steps[i] = &step
 	}
+	return &wt, nil
+}
 
-	if err := os.MkdirAll(r.WorkDir, 0777); err != nil {
-		return errors.Wrap(err, "could not create repo directory")
+// Removes the worktree added by AddWorktree. Does nothing if there is no worktree
+func (r *Repo) RemoveWorktree() error {
+	if r.WorkDir == "" {
+		return nil
 	}
 
-	cmd := exec.Command("git", "clone", r.gitUrl(), ".")
-	cmd.Dir = r.WorkDir
+	unlock := lockRepo(r.GitDir)
+	defer unlock()
 
-	if _, err := cmd.CombinedOutput(); err != nil {
-		return err
+	if err := os.RemoveAll(r.WorkDir); err != nil {
+		return errors.Wrapf(err, "could not remove worktree '%s'", r.WorkDir)
+	}
+	if _, err := r.git(r.GitDir, "worktree", "prune"); err != nil {
+		return errors.Wrap(err, "could not prune worktrees")
 	}
 
+	r.WorkDir = ""
 	return nil
 }
 
-// Checks if the repository exists in the filepath. If it doesn't, it should lead to
-// a repo.Clone
+// Checks if the bare clone of the repository exists. If it doesn't, it should lead to
+// a repo.Fetch
 func (r *Repo) Exists() bool {
-	return libs.PathExists(r.WorkDir)
+	return libs.PathExists(r.GitDir)
 }
 
 // Checks if the image required by the repository exists
@@ -151,12 +260,7 @@ func (r *Repo) HasImage() (bool, error) {
 
 // Attempts to pull the image
 func (r *Repo) PullImage() (string, error) {
-	cmd := exec.Command("docker", "image", "pull", r.Image)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", errors.Wrap(err, string(output))
-	}
-	return string(output), nil
+	return dkimage.Pull(context.Background(), r.Image)
 }
 
 // Builds the image for the repository given the rSetup instructions from
@@ -180,86 +284,108 @@ func (r *Repo) BuildImage() (string, error) {
 	return logs, nil
 }
 
+// Url of the remote with the token attached. The token is only attached for http(s)
+// remotes at the token's host so that it is never sent to other servers
 func (r *Repo) gitUrl() string {
-	parts := strings.Split(r.Source, "://")
-	schema := parts[0]
-	path := parts[1]
+	if r.token == "" {
+		return r.Source
+	}
+
+	u, err := ParseRemote(r.Source)
+	if err != nil || !strings.EqualFold(u.Host, r.host) {
+		return r.Source
+	}
 
 	switch r.provider {
 	case Github:
-		return fmt.Sprintf("%s://%s@%s", schema, r.token, path)
-	case GitlabCI:
-		fallthrough
-	case GitlabOauth2:
-		return fmt.Sprintf("%s://%s:%s@%s", schema, r.provider, r.token, path)
+		u.User = url.User(r.token)
+	case GitlabCI, GitlabOauth2:
+		u.User = url.UserPassword(string(r.provider), r.token)
 	default:
 		return r.Source // no remote
 	}
+	return u.String()
 }
 
-func (r *Repo) needsToUpdate() (bool, error) {
-	cmd := exec.Command("git", "ls-remote", "origin", "master")
-	cmd.Dir = r.WorkDir
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false, errors.Wrap(err, "could not fetch data from remote")
+// Runs the git command in dir and returns its trimmed output. The token is masked in
+// the output of failed commands as it is part of the remote url
+func (r *Repo) git(dir string, args ...string) (string, error) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	remoteHash := string(regexp.MustCompile(`([\S]+)`).Find(bytes.TrimSpace(output)))
-
-	cmd = exec.Command("git", "rev-parse", "master")
-	cmd.Dir = r.WorkDir
 
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		return false, errors.Wrap(err, "could not get local repo hash")
+	output, err := runGit(ctx, dir, args...)
+	if err != nil && r.token != "" {
+		return "", errors.New(strings.ReplaceAll(err.Error(), r.token, "***"))
 	}
-	localHash := string(bytes.TrimSpace(output))
-
-	return remoteHash != localHash, nil
+	return output, err
 }
 
-func (r *Repo) Checkout() error {
-	masterHash, err := r.getCommitHash("master")
-	if err != nil {
-		return err
-	}
-
-	if masterHash == r.Commit {
-		// no changes to the commit. master is same as tag
-		return nil
+// Runs the git command in dir. The command is killed once the context is done or after
+// gitTimeout
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// fails instead of waiting for credentials when the remote asks for them
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrapf(err, "could not run git %s", args[0])
 	}
 
-	// master hash not equal to commit hash. Checkout commit
-	cmd := exec.Command("git", "checkout", r.Commit)
-	cmd.Dir = r.WorkDir
+	// the helpers started by git, such as git-remote-http, keep the output open after git
+	// is killed, so git is not waited for once the context is done
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return errors.Wrapf(err, "could not checkout '%s'", r.Commit)
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", errors.Wrapf(err, "git %s failed: %s", args[0], strings.TrimSpace(output.String()))
+		}
+		return strings.TrimSpace(output.String()), nil
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return "", errors.Wrapf(ctx.Err(), "git %s was stopped", args[0])
 	}
+}
 
-	logs := strings.TrimSpace(string(output))
-	if strings.HasPrefix(logs, "error") {
-		return errors.Wrapf(err, "could not checkout '%s'", r.Commit)
-	}
+// Git commands which change the bare clone of a repo are run one at a time
+var repoLocks sync.Map
 
-	return nil
+func lockRepo(gitDir string) (unlock func()) {
+	lock, _ := repoLocks.LoadOrStore(gitDir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
 }
 
-func (r *Repo) getCommitHash(commit string) (string, error) {
-	cmd := exec.Command("git", "rev-parse", commit)
-	cmd.Dir = r.WorkDir
+// Takes the lock which is held while the bare clone of the named repo or its worktrees
+// are changed. Used to remove the repo without a job cloning it at the same time
+func LockRepo(appFolder, name string) (unlock func()) {
+	return lockRepo(filepath.Join(appFolder, "repos", name))
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", errors.Wrap(err, "could not rev-parse to get commit hash")
-	}
+// Path of the worktree of the job
+func WorktreeDir(appFolder, name string, jobId int) string {
+	return filepath.Join(appFolder, "worktrees", name, strconv.Itoa(jobId))
+}
 
-	return strings.TrimSpace(string(output)), nil
+// Removes the worktrees of every job. This should only be called when no job is running
+func ClearWorktrees(appFolder string) error {
+	if err := os.RemoveAll(filepath.Join(appFolder, "worktrees")); err != nil {
+		return errors.Wrap(err, "could not remove worktrees")
+	}
+	return nil
 }
 
-func getWorkDir(appFolder, name string) (string, error) {
+func getGitDir(appFolder, name string) (string, error) {
 	// create repo folder if it doesn't exists
 	folder := filepath.Join(appFolder, "repos")
 	if !libs.PathExists(folder) {
@@ -0,0 +1,236 @@
+package repo_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"nidavellir/libs"
+	. "nidavellir/services/repo"
+)
+
+const runtimeConfig = `
+setup:
+  image: alpine:3.11
+steps:
+  - name: Main
+    tasks:
+      - name: Task
+        cmd: python main.py
+`
+
+// Creates a local origin repo with the runtime config and a data file on master
+func newOrigin(t *testing.T, dir string) string {
+	origin := filepath.Join(dir, "origin")
+	require.NoError(t, os.MkdirAll(origin, 0777))
+
+	git(t, origin, "init")
+	git(t, origin, "checkout", "-b", "master")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(origin, "runtime.yaml"), []byte(runtimeConfig), 0644))
+	commitFile(t, origin, "data.txt", "first")
+	return origin
+}
+
+// Writes the file and commits it. Returns the commit hash
+func commitFile(t *testing.T, dir, name, content string) string {
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	git(t, dir, "add", "-A")
+	git(t, dir, "-c", "user.name=nida", "-c", "user.email=nida@example.com", "commit", "-m", content)
+	return git(t, dir, "rev-parse", "HEAD")
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestRepo_Worktrees(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-repo")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	origin := newOrigin(t, dir)
+	first := git(t, origin, "rev-parse", "HEAD")
+	appFolder := filepath.Join(dir, "app")
+
+	r, err := NewRepo("file://"+origin, "project", appFolder, "", "", "")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(appFolder, "repos", "project"), r.GitDir)
+	assert.Empty(r.WorkDir)
+	assert.Equal(first, r.Commit)
+
+	// jobs of different commits run side by side in worktrees of their own
+	second := commitFile(t, origin, "data.txt", "second")
+	assert.NoError(r.Fetch())
+
+	wt1, err := r.AddWorktree(WorktreeDir(appFolder, r.Name, 1))
+	assert.NoError(err)
+	other := *r
+	other.Commit = second
+	wt2, err := other.AddWorktree(WorktreeDir(appFolder, r.Name, 2))
+	assert.NoError(err)
+
+	assert.Empty(r.WorkDir, "worktrees are added to a copy of the repo")
+	assert.Equal("first", readFile(t, filepath.Join(wt1.WorkDir, "data.txt")))
+	assert.Equal("second", readFile(t, filepath.Join(wt2.WorkDir, "data.txt")))
+	for _, step := range wt1.Steps {
+		for _, task := range step.TaskInfoList {
+			assert.Equal(wt1.WorkDir, task.WorkDir)
+		}
+	}
+	for _, step := range r.Steps {
+		for _, task := range step.TaskInfoList {
+			assert.Empty(task.WorkDir)
+		}
+	}
+
+	path := wt1.WorkDir
+	assert.NoError(wt1.RemoveWorktree())
+	assert.Empty(wt1.WorkDir)
+	assert.False(libs.PathExists(path))
+	assert.True(libs.PathExists(filepath.Join(wt2.WorkDir, "data.txt")))
+
+	// a worktree left behind by an interrupted job is replaced
+	wt2, err = other.AddWorktree(WorktreeDir(appFolder, r.Name, 2))
+	assert.NoError(err)
+	assert.Equal("second", readFile(t, filepath.Join(wt2.WorkDir, "data.txt")))
+
+	assert.NoError(ClearWorktrees(appFolder))
+	assert.False(libs.PathExists(wt2.WorkDir))
+}
+
+func TestRepo_LegacyClone(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "nida-repo")
+	assert.NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	origin := newOrigin(t, dir)
+	appFolder := filepath.Join(dir, "app")
+
+	// clones made by earlier versions have a working tree
+	legacy := filepath.Join(appFolder, "repos", "project")
+	assert.NoError(os.MkdirAll(filepath.Dir(legacy), 0777))
+	git(t, filepath.Dir(legacy), "clone", origin, legacy)
+
+	r, err := NewRepo("file://"+origin, "project", appFolder, "", "", "")
+	assert.NoError(err)
+	assert.False(libs.PathExists(filepath.Join(r.GitDir, ".git")))
+	assert.Equal("true", git(t, r.GitDir, "rev-parse", "--is-bare-repository"))
+}
+
+func TestParseRemote(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Source   string
+		HasError bool
+	}{
+		{"https://github.com/team/project", false},
+		{"http://gitlab.example.com:8080/team/project.git", false},
+		{"github.com/team/project", true},
+		{"file:///tmp/project", true},
+		{"ssh://git@github.com/team/project", true},
+		{"https:///team/project", true},
+		{"::bad", true},
+	} {
+		_, err := ParseRemote(test.Source)
+		if test.HasError {
+			assert.Error(err, test.Source)
+		} else {
+			assert.NoError(err, test.Source)
+		}
+	}
+}
+
+func TestValidateRemote_Token(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	// the remote asks for credentials so that git sends the token if it has one
+	var lock sync.Mutex
+	var credentials []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			credentials = append(credentials, auth)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	host := server.Listener.Addr().String()
+	source := server.URL + "/team/project.git"
+
+	// the token belongs to github so it is not sent to the server
+	_, err := ValidateRemote(context.Background(), source, "", "github", "", "secret-token")
+	assert.Error(err)
+	assert.NotContains(err.Error(), "secret-token")
+	assert.Empty(credentials)
+
+	_, err = ValidateRemote(context.Background(), source, "", "github", host, "secret-token")
+	assert.Error(err)
+	assert.NotContains(err.Error(), "secret-token")
+	assert.NotEmpty(credentials)
+
+	_, err = ValidateRemote(context.Background(), source, "--upload-pack=touch", "github", host, "secret-token")
+	assert.Error(err)
+
+	u, err := url.Parse(source)
+	assert.NoError(err)
+	u.Scheme = "file"
+	_, err = ValidateRemote(context.Background(), u.String(), "", "github", host, "secret-token")
+	assert.Error(err)
+}
+
+func TestValidateRemote_Timeout(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	// the remote never answers
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ValidateRemote(ctx, server.URL+"/team/project.git", "", "", "", "")
+	assert.Error(err)
+	assert.True(time.Since(start) < 10*time.Second, "git should be stopped once the context is done")
+}
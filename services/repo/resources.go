@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"github.com/pkg/errors"
+
+	"nidavellir/config"
+	container "nidavellir/services/docker/dkcontainer"
+)
+
+type rResources struct {
+	CPUs    float64 `yaml:"cpus"`
+	Memory  string  `yaml:"memory"`
+	Pids    int64   `yaml:"pids"`
+	ShmSize string  `yaml:"shm_size"`
+}
+
+func (r *rResources) newResources() (container.Resources, error) {
+	if r == nil {
+		return container.Resources{}, nil
+	}
+
+	memory, err := config.ParseSize(r.Memory)
+	if err != nil {
+		return container.Resources{}, errors.Wrap(err, "invalid memory")
+	}
+	shmSize, err := config.ParseSize(r.ShmSize)
+	if err != nil {
+		return container.Resources{}, errors.Wrap(err, "invalid shm_size")
+	}
+
+	res := container.Resources{
+		CPUs:    r.CPUs,
+		Memory:  memory,
+		Pids:    r.Pids,
+		ShmSize: shmSize,
+	}
+	if err := res.Validate(); err != nil {
+		return container.Resources{}, err
+	}
+	return res, nil
+}
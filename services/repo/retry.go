@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Determines how a task is retried when it fails
+type RetryPolicy struct {
+	// Maximum number of times the task is run, including the first attempt
+	Attempts int
+	// Delay before the first retry. The delay doubles after every retry
+	Backoff time.Duration
+	// Exit codes which will be retried. If empty, every non-zero exit code is retried
+	Codes []int
+}
+
+type rRetry struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+	Codes    []int         `yaml:"codes"`
+}
+
+func (r *rRetry) newRetryPolicy() (*RetryPolicy, error) {
+	if r.Attempts < 1 {
+		return nil, errors.Errorf("expected retry attempts to be at least 1 but got %d", r.Attempts)
+	}
+
+	if r.Backoff < 0 {
+		return nil, errors.Errorf("expected a non-negative retry backoff but got %s", r.Backoff)
+	}
+
+	for _, code := range r.Codes {
+		if code <= 0 {
+			return nil, errors.Errorf("retry exit codes must be positive but got %d", code)
+		}
+	}
+
+	return &RetryPolicy{
+		Attempts: r.Attempts,
+		Backoff:  r.Backoff,
+		Codes:    r.Codes,
+	}, nil
+}
+
+// Checks if a task which ended with the exit code on the given attempt should be run again
+func (p *RetryPolicy) ShouldRetry(attempt, exitCode int) bool {
+	if p == nil || exitCode == 0 || attempt >= p.Attempts {
+		return false
+	}
+
+	if len(p.Codes) == 0 {
+		return true
+	}
+
+	for _, code := range p.Codes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay before running the next attempt after the given attempt has failed
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	if p == nil || attempt < 1 {
+		return 0
+	}
+	return p.Backoff * time.Duration(1<<uint(attempt-1))
+}
@@ -1,15 +1,15 @@
 package repo
 
 import (
-	"io/ioutil"
-	"os/exec"
-	"path/filepath"
+	"context"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 
 	"nidavellir/libs"
+	"nidavellir/services/docker/dkspec"
 )
 
 type runtime struct {
@@ -19,16 +19,21 @@ type runtime struct {
 }
 
 type rSetup struct {
-	Build  bool   `yaml:"build"`
-	Commit string `yaml:"commit"`
-	Image  string `yaml:"image"`
+	Build   bool          `yaml:"build"`
+	Commit  string        `yaml:"commit"`
+	Image   string        `yaml:"image"`
+	Timeout time.Duration `yaml:"timeout"`
+	Network string        `yaml:"network"`
 }
 
 type rStep struct {
-	Name   string            `yaml:"name"`
-	Tasks  []rTask           `yaml:"tasks"`
-	Env    map[string]string `yaml:"environment"`
-	Branch []rBranch         `yaml:"branch"`
+	Name      string            `yaml:"name"`
+	Tasks     []rTask           `yaml:"tasks"`
+	Env       map[string]string `yaml:"environment"`
+	Branch    []rBranch         `yaml:"branch"`
+	Timeout   time.Duration     `yaml:"timeout"`
+	Retry     *rRetry           `yaml:"retry"`
+	Resources *rResources       `yaml:"resources"`
 }
 
 type rBranch struct {
@@ -37,13 +42,17 @@ type rBranch struct {
 }
 
 type rTask struct {
-	Name string            `yaml:"name"`
-	Cmd  string            `yaml:"cmd"`
-	Env  map[string]string `yaml:"environment"`
+	Name      string            `yaml:"name"`
+	Cmd       string            `yaml:"cmd"`
+	Env       map[string]string `yaml:"environment"`
+	Timeout   time.Duration     `yaml:"timeout"`
+	Retry     *rRetry           `yaml:"retry"`
+	DependsOn []string          `yaml:"depends_on"`
+	Resources *rResources       `yaml:"resources"`
 }
 
-func (r *Repo) formatRuntimeConfig(dir string) error {
-	config, err := runtimeFromDir(dir)
+func (r *Repo) formatRuntimeConfig() error {
+	config, err := runtimeFromGit(r.GitDir, "master")
 	if err != nil {
 		return err
 	}
@@ -51,84 +60,112 @@ func (r *Repo) formatRuntimeConfig(dir string) error {
 	r.Commit = config.Setup.Commit
 	r.Image = config.Setup.Image
 	r.NeedsBuild = config.Setup.Build
+	r.Timeout = config.Setup.Timeout
+	r.Network = config.Setup.Network
 
-	if libs.LowerTrimReplaceSpace(r.WorkDir) == "" {
-		return errors.Errorf("workdir needs to be initialized before initializing steps")
-	}
-
+	// the working directory of the tasks is set once the worktree is added
 	r.Steps, err = newSteps(config.Steps, r.Name, r.Image, r.WorkDir, config.Env)
 	if err != nil {
 		return err
 	}
+	r.Graph = hasDependencies(config.Steps)
+
 	return nil
 }
 
-func runtimeFromDir(dir string) (*runtime, error) {
-	info, err := ioutil.ReadDir(dir)
+// Reads the runtime config at the revision of the git repository
+func runtimeFromGit(gitDir, rev string) (*runtime, error) {
+	output, err := runGit(context.Background(), gitDir, "ls-tree", "--name-only", rev)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not read working directory files")
+		return nil, errors.Wrapf(err, "could not list files of '%s'", rev)
 	}
 
 	file := ""
-	for _, f := range info {
-		fn := strings.ToLower(f.Name())
-		if !f.IsDir() && fn == "runtime.yaml" || fn == "runtime.yml" {
-			file = filepath.Join(dir, f.Name())
+	for _, name := range strings.Split(output, "\n") {
+		fn := strings.ToLower(name)
+		if fn == "runtime.yaml" || fn == "runtime.yml" {
+			file = name
 		}
 	}
 
 	if file == "" {
-		return nil, errors.New("no runtime.yaml found in working directory")
+		return nil, errors.New("no runtime.yaml found in repository")
 	}
 
-	content, err := ioutil.ReadFile(file)
+	content, err := runGit(context.Background(), gitDir, "show", rev+":"+file)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not read file content")
 	}
 
-	var config runtime
-	if err := yaml.Unmarshal(content, &config); err != nil {
-		return nil, errors.Wrap(err, "could not decode yaml file")
+	config, err := parseRuntime([]byte(content))
+	if err != nil {
+		return nil, err
 	}
 
-	if err := config.Setup.format(filepath.Dir(file)); err != nil {
+	if err := config.Setup.format(gitDir); err != nil {
 		return nil, errors.Wrap(err, "could not format tag")
 	}
 
+	return config, nil
+}
+
+// Checks that the revision cannot be mistaken for an option by the git commands
+func checkRevision(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return errors.Errorf("invalid commit '%s'", rev)
+	}
+	return nil
+}
+
+func parseRuntime(content []byte) (*runtime, error) {
+	var config runtime
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, errors.Wrap(err, "could not decode yaml file")
+	}
 	return &config, nil
 }
 
-func (s *rSetup) format(workDir string) error {
+// Validates the setup options which do not need the repository
+func (s *rSetup) validate() error {
 	s.Image = strings.TrimSpace(s.Image)
 	if s.Image == "" {
 		return errors.Errorf("image cannot be empty")
 	}
 
-	commit := libs.LowerTrim(s.Commit)
+	if s.Timeout < 0 {
+		return errors.Errorf("expected a non-negative setup timeout but got %s", s.Timeout)
+	}
 
-	if commit == "" || commit == "master" || commit == "latest" {
-		// gets latest tag since tag not specified
-		cmd := exec.Command("git", "rev-parse", "master")
-		cmd.Dir = workDir
+	// named networks can only be given in the source settings by the administrators
+	network, err := dkspec.Validate(s.Network, false)
+	if err != nil {
+		return err
+	}
+	s.Network = network
 
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, "could not get latest git commit hash")
-		} else {
-			commit = strings.TrimSpace(string(output))
-		}
-	} else {
-		// check specified tag exists
-		cmd := exec.Command("git", "rev-parse", "--verify", commit)
-		cmd.Dir = workDir
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, "could not verify if hash or commit is valid")
-		} else if strings.HasPrefix(strings.TrimSpace(string(output)), "fatal") {
-			return errors.Errorf("%s is not a valid commit or tag", commit)
-		}
+	return nil
+}
+
+// Resolves the setup commit, which can be a branch, tag or commit, into a commit hash.
+// An empty commit, "master" or "latest" resolves to master
+func (s *rSetup) format(gitDir string) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	commit := strings.TrimSpace(s.Commit)
+	if c := libs.LowerTrim(commit); c == "" || c == "master" || c == "latest" {
+		commit = "master"
+	}
+	if err := checkRevision(commit); err != nil {
+		return err
 	}
 
-	s.Commit = commit
+	hash, err := runGit(context.Background(), gitDir, "rev-parse", "--verify", commit+"^{commit}")
+	if err != nil {
+		return errors.Errorf("%s is not a valid commit or tag", commit)
+	}
+	s.Commit = hash
 
 	return nil
 }
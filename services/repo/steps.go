@@ -2,18 +2,27 @@ package repo
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 
 	"nidavellir/libs"
+	container "nidavellir/services/docker/dkcontainer"
 )
 
+// Branch target which ends the job instead of going to another step
+const ExitStep = "EXIT"
+
 type Step struct {
 	Name         string
 	TaskInfoList []*TaskInfo
 	Env          map[string]string
 	Branch       map[int]string
+	// maximum duration of the step. 0 means no limit
+	Timeout time.Duration
 }
 
 type TaskInfo struct {
@@ -23,6 +32,15 @@ type TaskInfo struct {
 	Cmd     string
 	WorkDir string
 	Env     map[string]string
+	// maximum duration of the task. 0 means no limit
+	Timeout time.Duration
+	// how the task is retried when it fails. nil means that the task is not retried
+	Retry *RetryPolicy
+	// names of the tasks which must succeed before this task runs. Only used when the
+	// runtime config declares dependencies
+	DependsOn []string
+	// container limits of the task. Limits which are not set fall back to the step's
+	Resources container.Resources
 }
 
 func newSteps(steps []rStep, repoName, image, repoDir string, globalEnv map[string]string) ([]*Step, error) {
@@ -44,14 +62,92 @@ func newSteps(steps []rStep, repoName, image, repoDir string, globalEnv map[stri
 	if errs != nil {
 		return nil, errs
 	}
+
+	if hasDependencies(steps) {
+		if err := resolveDependencies(res); err != nil {
+			return nil, err
+		}
+	} else if err := validateBranches(res); err != nil {
+		return nil, err
+	}
+
 	return res, nil
 }
 
+// Checks that every branch rule leads to a step after its own step or exits. Steps are
+// only searched forward when branching, so any other target fails the job
+func validateBranches(steps []*Step) error {
+	var errs error
+	for i, s := range steps {
+		codes := make([]int, 0, len(s.Branch))
+		for code := range s.Branch {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+
+		for _, code := range codes {
+			target := s.Branch[code]
+			if code < 0 {
+				errs = multierror.Append(errs, errors.Errorf("step '%s' has a branch rule for negative exit code %d", s.Name, code))
+			}
+			if target == ExitStep {
+				continue
+			}
+
+			found := false
+			for _, next := range steps[i+1:] {
+				if next.Name == target {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			exists := false
+			for _, prev := range steps[:i+1] {
+				if prev.Name == target {
+					exists = true
+					break
+				}
+			}
+			if exists {
+				errs = multierror.Append(errs, errors.Errorf("step '%s' branches to step '%s' on exit code %d but branches can only go to later steps", s.Name, target, code))
+			} else {
+				errs = multierror.Append(errs, errors.Errorf("step '%s' branches to unknown step '%s' on exit code %d", s.Name, target, code))
+			}
+		}
+	}
+
+	return errs
+}
+
 func (s *rStep) newStepGroup(repoName, image, repoDir string, globalEnv map[string]string) (*Step, error) {
 	sg := &Step{
 		Name:         s.Name,
 		TaskInfoList: nil,
 		Env:          make(map[string]string),
+		Timeout:      s.Timeout,
+	}
+
+	if s.Timeout < 0 {
+		return nil, errors.Errorf("step '%s' has a negative timeout", s.Name)
+	}
+
+	// step retry policy is used by tasks which do not specify their own
+	var stepRetry *RetryPolicy
+	if s.Retry != nil {
+		policy, err := s.Retry.newRetryPolicy()
+		if err != nil {
+			return nil, errors.Wrapf(err, "step '%s' has an invalid retry policy", s.Name)
+		}
+		stepRetry = policy
+	}
+
+	stepResources, err := s.Resources.newResources()
+	if err != nil {
+		return nil, errors.Wrapf(err, "step '%s' has invalid resources", s.Name)
 	}
 
 	// global env has less priority
@@ -68,7 +164,23 @@ func (s *rStep) newStepGroup(repoName, image, repoDir string, globalEnv map[stri
 	}
 
 	for _, t := range s.Tasks {
+		if t.Timeout < 0 {
+			return nil, errors.Errorf("task '%s' in step '%s' has a negative timeout", t.Name, s.Name)
+		}
 		task := t.newTask(repoName, s.Name, image, repoDir, sg.Env)
+		task.Retry = stepRetry
+		if t.Retry != nil {
+			policy, err := t.Retry.newRetryPolicy()
+			if err != nil {
+				return nil, errors.Wrapf(err, "task '%s' in step '%s' has an invalid retry policy", t.Name, s.Name)
+			}
+			task.Retry = policy
+		}
+		resources, err := t.Resources.newResources()
+		if err != nil {
+			return nil, errors.Wrapf(err, "task '%s' in step '%s' has invalid resources", t.Name, s.Name)
+		}
+		task.Resources = resources.WithDefaults(stepResources)
 		sg.TaskInfoList = append(sg.TaskInfoList, task)
 	}
 
@@ -91,6 +203,11 @@ func (t *rTask) newTask(repoName, stepName, image, repoDir string, stepEnv map[s
 		Cmd:     t.Cmd,
 		WorkDir: repoDir,
 		Env:     make(map[string]string),
+		Timeout: t.Timeout,
+	}
+
+	for _, name := range t.DependsOn {
+		task.DependsOn = append(task.DependsOn, strings.TrimSpace(name))
 	}
 
 	// step env has less priority
@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"nidavellir/libs"
+	container "nidavellir/services/docker/dkcontainer"
+)
+
+// Result of validating a runtime config. The plan is only available if the steps
+// in the runtime config are valid
+type Validation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+	Plan   *Plan    `json:"plan"`
+}
+
+// The steps and tasks that will be run as resolved from the runtime config
+type Plan struct {
+	Image   string      `json:"image"`
+	Build   bool        `json:"build"`
+	Commit  string      `json:"commit"`
+	Timeout string      `json:"timeout"`
+	Network string      `json:"network"`
+	Graph   bool        `json:"graph"`
+	Steps   []*PlanStep `json:"steps"`
+}
+
+type PlanStep struct {
+	Name    string         `json:"name"`
+	Timeout string         `json:"timeout"`
+	Branch  map[int]string `json:"branch"`
+	Tasks   []*PlanTask    `json:"tasks"`
+}
+
+type PlanTask struct {
+	Name      string            `json:"name"`
+	Tag       string            `json:"tag"`
+	Cmd       string            `json:"cmd"`
+	Env       map[string]string `json:"environment"`
+	Timeout   string            `json:"timeout"`
+	Retry     *PlanRetry        `json:"retry"`
+	DependsOn []string          `json:"dependsOn"`
+	Resources *PlanResources    `json:"resources"`
+}
+
+// Container limits of the task. Sizes are in bytes and 0 means no limit
+type PlanResources struct {
+	CPUs    float64 `json:"cpus"`
+	Memory  int64   `json:"memory"`
+	Pids    int64   `json:"pids"`
+	ShmSize int64   `json:"shmSize"`
+}
+
+type PlanRetry struct {
+	Attempts int    `json:"attempts"`
+	Backoff  string `json:"backoff"`
+	Codes    []int  `json:"codes"`
+}
+
+// Validates raw runtime config content. As there is no repository, the setup commit
+// is not checked. The name is used to form the task tags
+func ValidateRuntime(name string, content []byte) *Validation {
+	v := &Validation{Errors: []string{}}
+
+	config, err := parseRuntime(content)
+	if err != nil {
+		v.addError(err)
+		return v
+	}
+
+	if err := config.Setup.validate(); err != nil {
+		v.addError(err)
+	}
+
+	v.validateSteps(config, libs.LowerTrimReplaceSpace(name), "")
+	return v
+}
+
+// Validates the runtime config of the repository at the given commit. The repository
+// is cloned into a scratch folder which is removed afterwards. An error is returned if
+// the url is invalid, the repository could not be cloned or the commit does not exist.
+// Problems with the runtime config are listed in the Validation instead. The token is
+// only used for remotes at the host, as in NewRepo. The git commands are stopped once
+// the context is done
+func ValidateRemote(ctx context.Context, source, commit, provider, host, token string) (*Validation, error) {
+	if _, err := ParseRemote(source); err != nil {
+		return nil, err
+	}
+	commit = strings.TrimSpace(commit)
+	if err := checkRevision(commit); err != nil {
+		return nil, err
+	}
+
+	if token == "" {
+		provider = string(NoRemote)
+	}
+
+	p, err := ParseProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := ioutil.TempDir("", "nida-validate")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create scratch folder")
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+
+	name := strings.TrimSuffix(path.Base(strings.TrimRight(source, "/")), ".git")
+	r := &Repo{
+		Source:   source,
+		Name:     libs.LowerTrimReplaceSpace(name),
+		provider: p,
+		host:     host,
+		token:    token,
+		ctx:      ctx,
+		GitDir:   filepath.Join(scratch, "repo.git"),
+	}
+	if r.host == "" {
+		r.host = p.defaultHost()
+	}
+
+	if err := r.Fetch(); err != nil {
+		return nil, errors.Wrapf(err, "could not clone '%s'", source)
+	}
+
+	rev := "master"
+	if commit != "" {
+		if _, err := r.git(r.GitDir, "rev-parse", "--verify", commit+"^{commit}"); err != nil {
+			return nil, errors.Wrapf(err, "could not find commit '%s'", commit)
+		}
+		rev = commit
+	}
+
+	v := &Validation{Errors: []string{}}
+	config, err := runtimeFromGit(r.GitDir, rev)
+	if err != nil {
+		v.addError(err)
+		return v, nil
+	}
+
+	v.validateSteps(config, r.Name, "")
+	return v, nil
+}
+
+// Validates the steps of the runtime config and forms the plan if they are valid
+func (v *Validation) validateSteps(config *runtime, name, dir string) {
+	steps, err := newSteps(config.Steps, name, config.Setup.Image, dir, config.Env)
+	if err != nil {
+		v.addError(err)
+	} else {
+		v.Plan = newPlan(config, steps)
+	}
+
+	v.Valid = len(v.Errors) == 0
+}
+
+// Adds the error to the list of errors. Multiple errors are added individually
+func (v *Validation) addError(err error) {
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, e := range merr.Errors {
+			v.addError(e)
+		}
+		return
+	}
+	v.Errors = append(v.Errors, err.Error())
+	v.Valid = false
+}
+
+func newPlan(config *runtime, steps []*Step) *Plan {
+	plan := &Plan{
+		Image:   config.Setup.Image,
+		Build:   config.Setup.Build,
+		Commit:  config.Setup.Commit,
+		Timeout: formatDuration(config.Setup.Timeout),
+		Network: config.Setup.Network,
+		Graph:   hasDependencies(config.Steps),
+	}
+
+	for _, s := range steps {
+		step := &PlanStep{
+			Name:    s.Name,
+			Timeout: formatDuration(s.Timeout),
+			Branch:  s.Branch,
+		}
+
+		for _, t := range s.TaskInfoList {
+			task := &PlanTask{
+				Name:      t.Name,
+				Tag:       t.Tag,
+				Cmd:       t.Cmd,
+				Env:       t.Env,
+				Timeout:   formatDuration(t.Timeout),
+				DependsOn: t.DependsOn,
+			}
+			if t.Retry != nil {
+				task.Retry = &PlanRetry{
+					Attempts: t.Retry.Attempts,
+					Backoff:  formatDuration(t.Retry.Backoff),
+					Codes:    t.Retry.Codes,
+				}
+			}
+			if r := t.Resources; r != (container.Resources{}) {
+				task.Resources = &PlanResources{
+					CPUs:    r.CPUs,
+					Memory:  r.Memory,
+					Pids:    r.Pids,
+					ShmSize: r.ShmSize,
+				}
+			}
+			step.Tasks = append(step.Tasks, task)
+		}
+
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	return plan
+}
+
+// Formats the duration for display. A duration of 0 means no limit and is left empty
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
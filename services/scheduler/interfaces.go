@@ -3,6 +3,8 @@ package scheduler
 import "nidavellir/services/store"
 
 type IStore interface {
+	IRunRecorder
+
 	// Used to get all job sources. Set options to get all outdated sources
 	// in implementation
 	GetSources(options *store.GetSourceOption) ([]*store.Source, error)
@@ -10,17 +12,43 @@ type IStore interface {
 	// Gets source with the specified Id
 	GetSource(id int) (*store.Source, error)
 
-	// Used to update source state
-	UpdateSource(source *store.Source) (*store.Source, error)
+	// Saves the source's state and next runtime. The other settings are left alone
+	UpdateSourceState(source *store.Source) (*store.Source, error)
 
 	// Adds a new job
 	AddJob(sourceId int, trigger string) (*store.Job, error)
 
+	// Adds a new job which retries the failed job
+	RetryJob(failed *store.Job) (*store.Job, error)
+
 	// Gets a job by its id
 	GetJob(id int) (*store.Job, error)
 
+	// Gets all jobs specified by the options
+	GetJobs(options *store.ListJobOption) ([]*store.Job, error)
+
 	// Updates the job state
 	UpdateJob(job *store.Job) (*store.Job, error)
+
+	// Gets the keyring which decrypts the source secrets
+	Keyring() *store.Keyring
+}
+
+// Records the execution of the steps and tasks in a job
+type IRunRecorder interface {
+	// Adds a step execution record when the step starts
+	AddStepRun(run *store.StepRun) (*store.StepRun, error)
+
+	// Records the outcome of the step execution
+	UpdateStepRun(run *store.StepRun) (*store.StepRun, error)
+
+	// Adds a task execution record when the task completes
+	AddTaskRun(run *store.TaskRun) (*store.TaskRun, error)
+}
+
+// Notifies the channels of a source when its jobs end
+type INotifier interface {
+	JobCompleted(source *store.Source, job *store.Job)
 }
 
 type IScheduler interface {
@@ -28,6 +56,9 @@ type IScheduler interface {
 	// comes from
 	AddJob(sourceId int, trigger string) error
 
+	// Cancels a queued or running job. Running jobs will have their task containers removed
+	CancelJob(jobId int) error
+
 	// Starts the job
 	Start()
 
@@ -26,17 +26,42 @@ func (q *JobQueue) Enqueue(tg *TaskGroup) {
 
 // Removes the first item in the JobQueue
 func (q *JobQueue) Dequeue() *TaskGroup {
-	if !q.HasJob() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.list) == 0 {
 		return nil
 	}
 
-	q.lock.Lock()
 	tg := q.list[0]
 	q.list = q.list[1:]
-	q.lock.Unlock()
 	return tg
 }
 
+// Removes the first item in the JobQueue which satisfies the predicate. Items which
+// do not satisfy the predicate keep their position in the queue. Returns nil if no
+// item satisfies the predicate
+func (q *JobQueue) DequeueFirst(predicate func(tg *TaskGroup) bool) *TaskGroup {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, tg := range q.list {
+		if predicate(tg) {
+			q.list = append(q.list[:i:i], q.list[i+1:]...)
+			return tg
+		}
+	}
+	return nil
+}
+
+// Removes the TaskGroup with the specified job id from the JobQueue. Returns nil if
+// there is no such TaskGroup in the queue
+func (q *JobQueue) Remove(jobId int) *TaskGroup {
+	return q.DequeueFirst(func(tg *TaskGroup) bool {
+		return tg.JobId == jobId
+	})
+}
+
 // Moves a TaskGroup to the top of the queue where it'll be executed next (immediately)
 func (q *JobQueue) EnqueueTop(tg *TaskGroup) {
 	q.lock.Lock()
@@ -45,6 +70,9 @@ func (q *JobQueue) EnqueueTop(tg *TaskGroup) {
 }
 
 func (q *JobQueue) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
 	return len(q.list)
 }
 
@@ -53,7 +81,10 @@ func (q *JobQueue) HasJob() bool {
 }
 
 func (q *JobQueue) First() (*TaskGroup, error) {
-	if q.Len() == 0 {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	if len(q.list) == 0 {
 		return nil, errors.New("queue is empty")
 	}
 
@@ -0,0 +1,73 @@
+package scheduler_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/scheduler"
+)
+
+func TestJobQueue_DequeueFirst(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	q := NewJobQueue()
+	for i, sourceId := range []int{1, 1, 2, 3} {
+		q.Enqueue(&TaskGroup{SourceId: sourceId, JobId: i + 1})
+	}
+
+	tg := q.DequeueFirst(func(tg *TaskGroup) bool { return tg.SourceId != 1 })
+	assert.NotNil(tg)
+	assert.Equal(3, tg.JobId)
+	assert.Equal(3, q.Len())
+
+	tg = q.DequeueFirst(func(tg *TaskGroup) bool { return tg.SourceId == 99 })
+	assert.Nil(tg)
+
+	// remaining items should keep their relative order
+	for _, jobId := range []int{1, 2, 4} {
+		assert.Equal(jobId, q.Dequeue().JobId)
+	}
+	assert.False(q.HasJob())
+	assert.Nil(q.Dequeue())
+}
+
+func TestJobQueue_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	q := NewJobQueue()
+	n := 100
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			q.Enqueue(&TaskGroup{JobId: i})
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(n, q.Len())
+
+	ch := make(chan *TaskGroup, n)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			ch <- q.Dequeue()
+		}()
+	}
+	wg.Wait()
+	close(ch)
+
+	seen := make(map[int]bool)
+	for tg := range ch {
+		assert.NotNil(tg)
+		assert.False(seen[tg.JobId])
+		seen[tg.JobId] = true
+	}
+	assert.Len(seen, n)
+}
@@ -3,8 +3,11 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -13,27 +16,63 @@ import (
 
 	"nidavellir/config"
 	"nidavellir/libs"
+	"nidavellir/services/artifact"
+	container "nidavellir/services/docker/dkcontainer"
+	"nidavellir/services/docker/dknetwork"
+	"nidavellir/services/docker/dkspec"
 	"nidavellir/services/iofiles"
 	rp "nidavellir/services/repo"
 	"nidavellir/services/store"
 )
 
+// Longest delay before a retried job is dispatched, however many attempts it has had
+const maxRetryDelay = 1 * time.Hour
+
 type JobManager struct {
 	ctx     context.Context
 	db      IStore
 	errs    chan error
 	queue   *JobQueue
 	started bool
+	// maximum number of jobs that can run at any one time
+	maxJobs int
+	// maximum number of concurrent jobs for each source. A limit of 0 means the source
+	// is only bound by maxJobs
+	sourceLimits map[int]int
+	// TaskGroups which are currently dispatched, keyed by their job id
+	running map[int]*TaskGroup
+	// maximum duration of each job. 0 means no limit
+	maxDuration time.Duration
+	// delay before the first retry of a failed job. It doubles with every further attempt
+	retryDelay time.Duration
+	// container limits of tasks which do not declare their own, and the caps of every task
+	defaultResources container.Resources
+	maxResources     container.Resources
+	// hardening of the task containers, which sources can override
+	security config.SecurityConfig
+	// host and named networks which sources may use
+	networks []string
+	// determines whether jobs orphaned by a restart are failed or queued again
+	orphanPolicy string
+	// notifies the source's channels when a job succeeds or fails. Can be nil
+	notifier INotifier
+	// receives the logs and output of every job once it ends. Can be nil
+	artifacts artifact.ArtifactStore
+	// closed once the jobs restored by Recover are queued
+	recovered chan struct{}
 	// An array of completed jobs by the manager, this is primarily used for testing purposes
-	CompletedJobs []int
+	completedJobs []int
+	lock          sync.RWMutex
 	// Path to folder/volume that stores task output and logs
 	AppFolderPath string
 	token         string
 	provider      string
+	host          string
 }
 
 // The manager holds a queue of job. Whenever there are new jobs, it will dispatch
-// the job. At any one time, it can only run one job. Thus the jobs are queued.
+// the job. At any one time, it can run up to the configured maximum number of jobs
+// (subject to each source's own limit). The rest of the jobs are queued.
 // You should not be creating a JobManager, but should call NewScheduler which will
 // create a JobManager internally.
 func NewJobManager(db IStore, ctx context.Context, conf config.AppConfig) (*JobManager, error) {
@@ -44,16 +83,31 @@ func NewJobManager(db IStore, ctx context.Context, conf config.AppConfig) (*JobM
 		}
 	}
 
+	maxJobs := conf.MaxJobs
+	if maxJobs <= 0 {
+		maxJobs = 1
+	}
+
+	// nothing is recovered until Recover is called
+	recovered := make(chan struct{})
+	close(recovered)
+
 	return &JobManager{
 		ctx:           ctx,
+		recovered:     recovered,
 		db:            db,
 		errs:          make(chan error),
 		queue:         NewJobQueue(),
 		started:       false,
-		CompletedJobs: []int{},
+		maxJobs:       maxJobs,
+		orphanPolicy:  conf.OrphanPolicy,
+		sourceLimits:  make(map[int]int),
+		running:       make(map[int]*TaskGroup),
+		completedJobs: []int{},
 		AppFolderPath: conf.WorkDir,
 		token:         conf.PAT.Token,
 		provider:      conf.PAT.Provider,
+		host:          conf.PAT.Host,
 	}, nil
 }
 
@@ -79,6 +133,85 @@ func (m *JobManager) Errors() []error {
 	return errs
 }
 
+// Sets the maximum duration of every job added to the manager. The runtime config of
+// each repo may set a tighter limit. A duration of 0 means no limit
+func (m *JobManager) SetMaxDuration(duration time.Duration) *JobManager {
+	m.maxDuration = duration
+	return m
+}
+
+// Sets the delay before the first retry of a failed job. The delay doubles with every
+// further attempt, up to maxRetryDelay
+func (m *JobManager) SetRetryDelay(delay time.Duration) *JobManager {
+	m.retryDelay = delay
+	return m
+}
+
+// Delay before the given attempt of a job may be dispatched. The first attempt is not
+// delayed
+func (m *JobManager) retryDelayOf(attempt int) time.Duration {
+	if attempt <= 1 || m.retryDelay <= 0 {
+		return 0
+	}
+
+	delay := m.retryDelay
+	for i := 2; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Sets the container limits of tasks which do not declare their own and the caps of
+// every task
+func (m *JobManager) SetResources(defaults, caps container.Resources) *JobManager {
+	m.defaultResources = defaults
+	m.maxResources = caps
+	return m
+}
+
+// Sets the hardening of the task containers. Returns an error if the settings are
+// not valid
+func (m *JobManager) SetSecurity(conf config.SecurityConfig) error {
+	sec, _ := taskSecurity(conf, store.SourceSecurity{})
+	if err := sec.Validate(); err != nil {
+		return errors.Wrap(err, "invalid run security settings")
+	}
+	m.security = conf
+	return nil
+}
+
+// Sets the host and named networks which sources may use. Jobs of sources with any other
+// such network are not queued
+func (m *JobManager) SetNetworks(allowed []string) *JobManager {
+	m.networks = allowed
+	return m
+}
+
+// Sets the notifier which is told whenever a job succeeds or fails
+func (m *JobManager) SetNotifier(notifier INotifier) *JobManager {
+	m.notifier = notifier
+	return m
+}
+
+// Sets the store which the logs and output of every job are uploaded to once the job ends
+func (m *JobManager) SetArtifactStore(artifacts artifact.ArtifactStore) *JobManager {
+	m.artifacts = artifacts
+	return m
+}
+
+// Returns the ids of the jobs which were completed by the manager
+func (m *JobManager) CompletedJobs() []int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	jobs := make([]int, len(m.completedJobs))
+	copy(jobs, m.completedJobs)
+	return jobs
+}
+
 // Stops all job and the job manager.
 func (m *JobManager) Close() {
 	m.started = false
@@ -92,30 +225,282 @@ func (m *JobManager) AddJob(source *store.Source, trigger string) error {
 		return err
 	}
 
-	repo, err := rp.NewRepo(source.RepoUrl, source.UniqueName, m.AppFolderPath, m.provider, m.token)
+	return m.enqueueJob(source, job)
+}
+
+// Creates the TaskGroup for the job and pushes it into the queue. Manual jobs are
+// placed at the front of the queue. The job's task date is set to the source's next
+// runtime if it has not been set before
+func (m *JobManager) enqueueJob(source *store.Source, job *store.Job) error {
+	if job.TaskDate.IsZero() {
+		job.TaskDate = source.NextTime
+		if _, err := m.db.UpdateJob(job); err != nil {
+			return errors.Wrap(err, "could not save job task date")
+		}
+	}
+	taskDate := job.TaskDate
+
+	// the source may have been saved before the network was taken off the allowed list
+	if err := dkspec.Allowed(source.Network, m.networks); err != nil {
+		return err
+	}
+
+	repo, err := rp.NewRepo(source.RepoUrl, source.UniqueName, m.AppFolderPath, m.provider, m.host, m.token)
+	if err != nil {
+		return err
+	}
+
+	tg, err := NewTaskGroup(repo, m.ctx, source.Id, job.Id, taskDate, m.AppFolderPath)
 	if err != nil {
 		return err
 	}
 
-	tg, err := NewTaskGroup(repo, m.ctx, source.Id, job.Id, source.NextTime, m.AppFolderPath)
+	extraEnv, err := source.SecretMap(m.db.Keyring())
 	if err != nil {
+		tg.Close()
 		return err
 	}
+	extraEnv["task_date"] = taskDate.Format("2006-01-02 15:04:05")
+	tg.AddEnvVar(extraEnv).
+		LimitMaxDuration(m.maxDuration).
+		LimitResources(m.defaultResources, m.maxResources).
+		SetNetwork(source.Network).
+		SetSecurity(taskSecurity(m.security, source.Security)).
+		SetRecorder(m.db)
+
+	// the delay counts from the creation of the retry so that it holds across restarts
+	if job.Trigger == store.TriggerRetry {
+		tg.SetNotBefore(job.InitTime.Add(m.retryDelayOf(job.Attempt)))
+	}
 
-	extraEnv := source.SecretMap()
-	extraEnv["task_date"] = source.NextTime.Format("2006-01-02 15:04:05")
-	tg.AddEnvVar(extraEnv)
+	m.lock.Lock()
+	m.sourceLimits[source.Id] = source.MaxJobs
+	m.lock.Unlock()
 
-	switch trigger {
+	switch job.Trigger {
 	case store.TriggerManual:
 		m.queue.EnqueueTop(tg)
 	default:
+		// marks the source as queued so that it will not be picked up again by searchForWork
+		// while it waits for a free slot
+		if _, err := m.db.UpdateSourceState(source.ToQueued()); err != nil {
+			tg.Close()
+			return errors.Wrap(err, "could not update source status")
+		}
 		m.queue.Enqueue(tg)
 	}
 
 	return nil
 }
 
+// Queues a new attempt of the failed job if the source still has retries left.
+// The retried job runs with the same task date as the failed job
+func (m *JobManager) retryJob(source *store.Source, job *store.Job) error {
+	if job.Attempt > source.Retries {
+		return nil
+	}
+
+	retry, err := m.db.RetryJob(job)
+	if err != nil {
+		return err
+	}
+
+	return m.enqueueJob(source, retry)
+}
+
+// Rebuilds the JobQueue from the jobs saved in the database. This should be called
+// before the manager is started. Jobs which were running when the application stopped
+// are either failed or queued again depending on the orphan policy. The states of
+// sources are reset so that they will be scheduled again. The worktrees and isolated
+// networks left behind by the interrupted jobs are removed.
+//
+// As queueing a job fetches its repo and image, which can be slow, the jobs are queued
+// in the background. Recovered is closed once they are queued
+func (m *JobManager) Recover() error {
+	// nothing runs yet, so every worktree was left behind by the previous run
+	if err := rp.ClearWorktrees(m.AppFolderPath); err != nil {
+		return err
+	}
+
+	sources, err := m.db.GetSources(nil)
+	if err != nil {
+		return errors.Wrap(err, "could not fetch sources for recovery")
+	}
+
+	jobs, err := m.db.GetJobs(&store.ListJobOption{
+		State: []string{store.JobQueued, store.JobRunning},
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not fetch unfinished jobs for recovery")
+	}
+	// restore the jobs in the order which they were added
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Id < jobs[j].Id })
+
+	// sources whose scheduled jobs are recovered stay queued so that searchForWork does
+	// not add another job for them before the recovered jobs are queued
+	scheduled := make(map[int]bool)
+	for _, job := range jobs {
+		if job.Trigger != store.TriggerManual {
+			scheduled[job.SourceId] = true
+		}
+	}
+
+	sourceMap := make(map[int]*store.Source)
+	for _, source := range sources {
+		state := store.ScheduleNoop
+		if scheduled[source.Id] {
+			state = store.ScheduleQueued
+		}
+		if source.State != state {
+			source.State = state
+			if _, err := m.db.UpdateSourceState(source); err != nil {
+				return errors.Wrapf(err, "could not reset state of source %d", source.Id)
+			}
+		}
+		sourceMap[source.Id] = source
+	}
+
+	done := make(chan struct{})
+	m.recovered = done
+	go func() {
+		defer close(done)
+		m.recoverJobs(sourceMap, jobs)
+	}()
+
+	return nil
+}
+
+// Closed once the jobs restored by Recover are queued or failed
+func (m *JobManager) Recovered() <-chan struct{} {
+	return m.recovered
+}
+
+func (m *JobManager) recoverJobs(sources map[int]*store.Source, jobs []*store.Job) {
+	// every job network was left behind by the previous run as no job has been dispatched
+	if count, err := dknetwork.Prune(m.ctx); err != nil {
+		log.Println(errors.Wrap(err, "could not remove job networks"))
+	} else if count > 0 {
+		log.Printf("removed %d job networks left behind by interrupted jobs", count)
+	}
+
+	for _, job := range jobs {
+		source, exists := sources[job.SourceId]
+		if !exists {
+			log.Printf("could not recover job %d: source %d does not exist", job.Id, job.SourceId)
+			continue
+		}
+
+		if err := m.recoverJob(source, job); err != nil {
+			log.Println(errors.Wrapf(err, "could not recover job %d", job.Id))
+		}
+	}
+}
+
+// Puts an unfinished job back into the queue or fails it if it was orphaned and the
+// orphan policy does not allow it to be queued again
+func (m *JobManager) recoverJob(source *store.Source, job *store.Job) error {
+	logFile, err := iofiles.NewLogFile(m.AppFolderPath, job.SourceId, job.Id, false)
+	if err != nil {
+		return errors.Wrap(err, "could not create log file")
+	}
+	defer logFile.Close()
+
+	if job.State == store.JobRunning {
+		if m.orphanPolicy != config.OrphanRequeue {
+			_ = logFile.Write("Job was interrupted as the application stopped while it was running")
+			if err := m.failWork(source, job); err != nil {
+				return err
+			}
+			return m.retryJob(source, job)
+		}
+
+		if err := job.ToRequeuedState(); err != nil {
+			return err
+		}
+		if _, err := m.db.UpdateJob(job); err != nil {
+			return errors.Wrap(err, "could not update job status")
+		}
+		_ = logFile.Write("Job was queued again as the application stopped while it was running")
+	}
+
+	if err := m.enqueueJob(source, job); err != nil {
+		// the job can never be dispatched so it is cancelled to keep it from being recovered again
+		err = multierror.Append(err, m.cancelWork(source, job))
+		_ = logFile.Write(err)
+		return err
+	}
+
+	return nil
+}
+
+// Cancels a queued or running job. Queued jobs are removed from the JobQueue while
+// running jobs will have their task containers removed
+func (m *JobManager) CancelJob(jobId int) error {
+	// the dispatcher moves jobs from the queue to the running jobs under the same lock
+	m.lock.Lock()
+	tg, running := m.running[jobId]
+	ended := running && tg.ended
+	if !running {
+		tg = m.queue.Remove(jobId)
+	}
+	m.lock.Unlock()
+
+	if ended {
+		return errors.Errorf("job %d has already ended", jobId)
+	} else if tg == nil {
+		if err := m.checkNotEnded(jobId); err != nil {
+			return err
+		}
+		return errors.Errorf("job %d is not queued or running", jobId)
+	}
+
+	if running {
+		// a job which has just finished stays in the running jobs until it is cleaned up
+		if err := m.checkNotEnded(jobId); err != nil {
+			return err
+		}
+
+		// the dispatcher will record the cancellation once the TaskGroup stops executing
+		tg.Cancel()
+		return nil
+	}
+
+	tg.Cancel()
+	tg.Close()
+
+	source, job, err := m.retrieveWorkDetails(tg)
+	if err != nil {
+		return err
+	}
+
+	if err := m.cancelWork(source, job); err != nil {
+		return err
+	}
+
+	logFile, err := iofiles.NewLogFile(m.AppFolderPath, tg.SourceId, tg.JobId, false)
+	if err != nil {
+		return errors.Wrap(err, "could not create log file")
+	}
+	defer logFile.Close()
+
+	return logFile.Write("Job cancelled before it started")
+}
+
+// Returns an error if the job has ended according to the database
+func (m *JobManager) checkNotEnded(jobId int) error {
+	job, err := m.db.GetJob(jobId)
+	if err != nil {
+		return errors.Wrap(err, "could not check job state")
+	}
+
+	switch job.State {
+	case store.JobSuccess, store.JobFailure, store.JobCancelled:
+		return errors.Errorf("job %d has already ended with state %s", jobId, job.State)
+	default:
+		return nil
+	}
+}
+
 // Looks for new job every 10 seconds. If there are any, inserts them into the JobQueue
 func (m *JobManager) searchForWork() {
 	ticker := time.NewTicker(10 * time.Second)
@@ -143,32 +528,76 @@ func (m *JobManager) searchForWork() {
 	}
 }
 
-// Dispatches any job from the jobQueue if any
+// Dispatches jobs from the jobQueue until the maximum number of concurrent jobs is reached
 func (m *JobManager) dispatchJobs() {
-	ch := make(chan bool, 1)
+	done := make(chan int, m.maxJobs)
 	ticker := time.NewTicker(5 * time.Second)
-	maxJobs := 1
-	numJobs := 0
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if numJobs < maxJobs && m.queue.HasJob() {
-				numJobs += 1
-				go m.dispatch(m.queue.Dequeue(), ch)
+			for tg := m.nextJob(); tg != nil; tg = m.nextJob() {
+				go m.dispatch(tg, done)
 			}
-		case <-ch:
-			numJobs -= 1
+		case jobId := <-done:
+			m.lock.Lock()
+			delete(m.running, jobId)
+			m.lock.Unlock()
 		case <-m.ctx.Done():
 			return
 		}
 	}
 }
 
+// Moves the first TaskGroup which can be dispatched from the JobQueue into the running
+// jobs. Returns nil if the maximum number of jobs is running or no TaskGroup can be
+// dispatched. Both are done under the lock so that CancelJob always finds the job
+func (m *JobManager) nextJob() *TaskGroup {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.running) >= m.maxJobs {
+		return nil
+	}
+
+	tg := m.queue.DequeueFirst(m.canDispatch)
+	if tg != nil {
+		m.running[tg.JobId] = tg
+	}
+	return tg
+}
+
+// Checks that the TaskGroup is not held back and that its source has not hit its
+// concurrent job limit. The lock must be held by the caller
+func (m *JobManager) canDispatch(tg *TaskGroup) bool {
+	if time.Now().Before(tg.notBefore) {
+		return false
+	}
+
+	limit := m.sourceLimits[tg.SourceId]
+	if limit <= 0 {
+		return true
+	}
+
+	count := 0
+	for _, r := range m.running {
+		if r.SourceId == tg.SourceId {
+			count++
+		}
+	}
+	return count < limit
+}
+
 // Executes the TaskGroup
-func (m *JobManager) dispatch(taskGroup *TaskGroup, done chan<- bool) {
+func (m *JobManager) dispatch(taskGroup *TaskGroup, done chan<- int) {
+	if taskGroup == nil {
+		return
+	}
+
 	defer func() {
-		done <- true
+		taskGroup.Close()
+		done <- taskGroup.JobId
 		data, err := json.MarshalIndent(struct {
 			Name string `json:"name"`
 			Date string `json:"date"`
@@ -178,11 +607,13 @@ func (m *JobManager) dispatch(taskGroup *TaskGroup, done chan<- bool) {
 		}
 		path := iofiles.GetMetaFilePath(m.AppFolderPath, taskGroup.SourceId, taskGroup.JobId)
 		_ = ioutil.WriteFile(path, data, 0666)
-	}()
 
-	if taskGroup == nil {
-		return
-	}
+		if m.artifacts != nil {
+			if err := artifact.UploadJob(m.artifacts, m.AppFolderPath, taskGroup.SourceId, taskGroup.JobId); err != nil {
+				log.Println(errors.Wrap(err, "could not upload job artifacts"))
+			}
+		}
+	}()
 
 	logFile, err := iofiles.NewLogFile(m.AppFolderPath, taskGroup.SourceId, taskGroup.JobId, false)
 	if err != nil {
@@ -205,11 +636,22 @@ func (m *JobManager) dispatch(taskGroup *TaskGroup, done chan<- bool) {
 		return
 	}
 
-	// Execute tasks and save logs if any
-	r, err := taskGroup.Execute()
+	// Execute tasks and save logs if any. The container output is streamed into the
+	// log file while the tasks run
+	r, err := taskGroup.SetLogFile(logFile).Execute()
 	if err != nil {
-		err = multierror.Append(err, m.failWork(source, job))
+		if taskGroup.IsCancelled() {
+			err = multierror.Append(errors.Wrap(err, "job cancelled"), m.cancelWork(source, job))
+		} else {
+			err = multierror.Append(err, m.failWork(source, job))
+			if retryErr := m.retryJob(source, job); retryErr != nil {
+				err = multierror.Append(err, errors.Wrap(retryErr, "could not retry job"))
+			}
+		}
 		err = multierror.Append(err, logFile.Write(err))
+		if job.State == store.JobFailure && job.Attempt <= source.Retries {
+			_ = logFile.Write(fmt.Sprintf("Job will be retried in %s. Attempt %d of %d", m.retryDelayOf(job.Attempt+1), job.Attempt+1, source.Retries+1))
+		}
 		log.Println(err)
 		return
 	}
@@ -219,7 +661,10 @@ func (m *JobManager) dispatch(taskGroup *TaskGroup, done chan<- bool) {
 		log.Println(err)
 	}
 	_ = logFile.Write(r.Logs)
-	m.CompletedJobs = append(m.CompletedJobs, job.Id)
+
+	m.lock.Lock()
+	m.completedJobs = append(m.completedJobs, job.Id)
+	m.lock.Unlock()
 }
 
 // Fetches details about the job from the database
@@ -239,13 +684,15 @@ func (m *JobManager) retrieveWorkDetails(tg *TaskGroup) (*store.Source, *store.J
 
 // Announces that the job is completed
 func (m *JobManager) completeWork(source *store.Source, job *store.Job) error {
-	source.ToCompleted()
 	if err := job.ToSuccessState(); err != nil {
 		return err
 	}
 
-	return m.updateJobAndSourceStatus(source, job)
-
+	if err := m.endWork(source, job); err != nil {
+		return err
+	}
+	m.notify(source, job)
+	return nil
 }
 
 // Initializes the work
@@ -260,21 +707,71 @@ func (m *JobManager) initWork(source *store.Source, job *store.Job) error {
 
 // Announces that the job has failed
 func (m *JobManager) failWork(source *store.Source, job *store.Job) error {
-	source.ToCompleted()
 	if err := job.ToFailureState(); err != nil {
 		return err
 	}
 
+	if err := m.endWork(source, job); err != nil {
+		return err
+	}
+	m.notify(source, job)
+	return nil
+}
+
+// Announces that the job was cancelled
+func (m *JobManager) cancelWork(source *store.Source, job *store.Job) error {
+	if err := job.ToCancelledState(); err != nil {
+		return err
+	}
+
+	return m.endWork(source, job)
+}
+
+// Saves the ended job. The source is only set back to idle, with its next runtime
+// calculated, when no other job of the source is still running
+func (m *JobManager) endWork(source *store.Source, job *store.Job) error {
+	if !m.isLastRunning(source.Id, job.Id) {
+		if _, err := m.db.UpdateJob(job); err != nil {
+			return errors.Wrap(err, "could not update job status")
+		}
+		return nil
+	}
+
+	source.ToCompleted()
 	return m.updateJobAndSourceStatus(source, job)
 }
 
+// Marks the job as ended and checks that no other job of the source is running. Jobs
+// which have ended but are still being cleaned up do not count
+func (m *JobManager) isLastRunning(sourceId, jobId int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if tg, exists := m.running[jobId]; exists {
+		tg.ended = true
+	}
+	for _, tg := range m.running {
+		if tg.SourceId == sourceId && !tg.ended {
+			return false
+		}
+	}
+	return true
+}
+
+// Tells the notifier, if any, that the job has ended
+func (m *JobManager) notify(source *store.Source, job *store.Job) {
+	if m.notifier != nil {
+		m.notifier.JobCompleted(source, job)
+	}
+}
+
 // Updates the job status
 func (m *JobManager) updateJobAndSourceStatus(source *store.Source, job *store.Job) error {
 	if _, err := m.db.UpdateJob(job); err != nil {
 		return errors.Wrap(err, "could not update job status")
 	}
 
-	if _, err := m.db.UpdateSource(source); err != nil {
+	if _, err := m.db.UpdateSourceState(source); err != nil {
 		return errors.Wrap(err, "could not update source status")
 	}
 
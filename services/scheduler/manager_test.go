@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,14 +14,17 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
+	"nidavellir/config"
 	"nidavellir/libs"
 	. "nidavellir/services/scheduler"
 	"nidavellir/services/store"
 )
 
 type mockStore struct {
-	sources map[int]*store.Source
-	jobs    map[int]*store.Job
+	sources  map[int]*store.Source
+	jobs     map[int]*store.Job
+	stepRuns map[int]*store.StepRun
+	lock     *sync.Mutex
 }
 
 func newMockStore() *mockStore {
@@ -43,7 +47,9 @@ func newMockStore() *mockStore {
 				},
 			},
 		},
-		jobs: make(map[int]*store.Job),
+		jobs:     make(map[int]*store.Job),
+		stepRuns: make(map[int]*store.StepRun),
+		lock:     &sync.Mutex{},
 	}
 }
 
@@ -65,6 +71,13 @@ func (m mockStore) UpdateSource(source *store.Source) (*store.Source, error) {
 	return source, nil
 }
 
+func (m mockStore) UpdateSourceState(source *store.Source) (*store.Source, error) {
+	saved := m.sources[source.Id]
+	saved.State = source.State
+	saved.NextTime = source.NextTime
+	return source, nil
+}
+
 func (m mockStore) AddJob(sourceId int, trigger string) (*store.Job, error) {
 	id := len(m.jobs) + 1
 	job := &store.Job{
@@ -75,12 +88,21 @@ func (m mockStore) AddJob(sourceId int, trigger string) (*store.Job, error) {
 		EndTime:   time.Time{},
 		State:     store.JobQueued,
 		Trigger:   trigger,
+		Attempt:   1,
 	}
 	m.jobs[id] = job
 
 	return job, nil
 }
 
+func (m mockStore) RetryJob(failed *store.Job) (*store.Job, error) {
+	job, _ := m.AddJob(failed.SourceId, store.TriggerRetry)
+	job.Attempt = failed.Attempt + 1
+	job.RetryOf = failed.Id
+
+	return job, nil
+}
+
 func (m mockStore) GetJob(id int) (*store.Job, error) {
 	if job, exists := m.jobs[id]; !exists {
 		return nil, errors.New("job does not exist")
@@ -89,11 +111,57 @@ func (m mockStore) GetJob(id int) (*store.Job, error) {
 	}
 }
 
+func (m mockStore) GetJobs(options *store.ListJobOption) ([]*store.Job, error) {
+	var jobs []*store.Job
+	for _, job := range m.jobs {
+		if options == nil || len(options.State) == 0 || libs.IsIn(job.State, options.State) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
 func (m mockStore) UpdateJob(job *store.Job) (*store.Job, error) {
 	m.jobs[job.Id] = job
 	return job, nil
 }
 
+func (m mockStore) AddStepRun(run *store.StepRun) (*store.StepRun, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	run.Id = len(m.stepRuns) + 1
+	m.stepRuns[run.Id] = run
+	return run, nil
+}
+
+func (m mockStore) UpdateStepRun(run *store.StepRun) (*store.StepRun, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.stepRuns[run.Id] = run
+	return run, nil
+}
+
+func (m mockStore) AddTaskRun(run *store.TaskRun) (*store.TaskRun, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	step, exists := m.stepRuns[run.StepRunId]
+	if !exists {
+		return nil, errors.Errorf("no step run with id '%d'", run.StepRunId)
+	}
+	run.Id = len(step.Tasks) + 1
+	step.Tasks = append(step.Tasks, *run)
+	return run, nil
+}
+
+// secrets in the mock store are kept in plain text so no keyring is needed
+func (m mockStore) Keyring() *store.Keyring {
+	return nil
+}
+
 func TestNewJobManager(t *testing.T) {
 	t.Parallel()
 	assert := require.New(t)
@@ -124,18 +192,59 @@ func TestNewJobManager(t *testing.T) {
 			select {
 			case <-time.After(5 * time.Second):
 				// job succeeded
-				if len(manager.CompletedJobs) > 0 {
+				if len(manager.CompletedJobs()) > 0 {
 					break poll
 				}
 			case <-timeout:
 				assert.FailNow("manager did not have a completed job after waiting for 3 minutes")
 			}
 		}
-
 		manager.Close()
+
+		// every step and task should have an execution record
+		assert.NotEmpty(db.stepRuns)
+		for _, run := range db.stepRuns {
+			assert.NotEmpty(run.Tasks)
+			assert.False(run.EndTime.IsZero())
+		}
 	})
 }
 
+func TestJobManager_Recover(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []string{config.OrphanFail, config.OrphanRequeue} {
+		assert := require.New(t)
+
+		db := newMockStore()
+		source, _ := db.GetSource(1)
+		source.State = store.ScheduleRunning
+
+		orphan, _ := db.AddJob(source.Id, store.TriggerSchedule)
+		orphan.State = store.JobRunning
+		queued, _ := db.AddJob(source.Id, store.TriggerManual)
+
+		conf := appConf
+		conf.OrphanPolicy = policy
+		manager, err := NewJobManager(db, context.Background(), conf)
+		assert.NoError(err)
+
+		err = manager.Recover()
+		assert.NoError(err)
+		<-manager.Recovered()
+
+		if policy == config.OrphanFail {
+			assert.Equal(store.JobFailure, orphan.State)
+			assert.Equal(store.ScheduleNoop, source.State)
+		} else {
+			assert.Equal(store.JobQueued, orphan.State)
+			assert.Equal(store.ScheduleQueued, source.State)
+		}
+		assert.Equal(store.JobQueued, queued.State)
+		assert.False(queued.TaskDate.IsZero())
+	}
+}
+
 // this test case is used for debugging. Useful for checking folder structures generated by the manager
 func TestNewJobManager_NoTimeOut(t *testing.T) {
 	t.Parallel()
@@ -165,7 +274,7 @@ func TestNewJobManager_NoTimeOut(t *testing.T) {
 			select {
 			case <-time.After(5 * time.Second):
 				// job succeeded
-				if len(manager.CompletedJobs) > 0 {
+				if len(manager.CompletedJobs()) > 0 {
 					// set break point at this line.
 					manager.Close()
 					break loop
@@ -59,14 +59,14 @@ func pullRepo(source string, errCh chan<- error) *repo.Repo {
 	name := filepath.Base(source)
 
 	pat := appConf.PAT
-	rp, err := repo.NewRepo(source, name, appDir, pat.Provider, pat.Token)
+	rp, err := repo.NewRepo(source, name, appDir, pat.Provider, pat.Host, pat.Token)
 	if err != nil {
 		errCh <- err
 		return nil
 	}
 
 	if !rp.Exists() {
-		err := rp.Clone()
+		err := rp.Fetch()
 		if err != nil {
 			errCh <- err
 			return nil
@@ -8,6 +8,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"nidavellir/config"
+	"nidavellir/services/artifact"
+	container "nidavellir/services/docker/dkcontainer"
 )
 
 type Scheduler struct {
@@ -18,12 +20,38 @@ type Scheduler struct {
 }
 
 // Scheduler pings the database at fixed interval to look for new jobs
-// If there are, it will push the job into the manager
-func NewScheduler(db IStore, conf config.AppConfig) (*Scheduler, error) {
+// If there are, it will push the job into the manager. The notifier is told whenever
+// a job ends and can be nil
+func NewScheduler(db IStore, notifier INotifier, conf *config.Config) (*Scheduler, error) {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 
-	manager, err := NewJobManager(db, ctx, conf)
+	manager, err := NewJobManager(db, ctx, conf.App)
 	if err != nil {
+		cancelFunc()
+		return nil, err
+	}
+	manager.SetMaxDuration(conf.Run.MaxDuration).
+		SetRetryDelay(conf.Run.RetryDelay).
+		SetResources(resources(conf.Run.Resources.Default), resources(conf.Run.Resources.Max)).
+		SetNetworks(conf.Run.Networks)
+	if notifier != nil {
+		manager.SetNotifier(notifier)
+	}
+	if err := manager.SetSecurity(conf.Run.Security); err != nil {
+		cancelFunc()
+		return nil, err
+	}
+
+	artifacts, err := artifact.New(conf.Artifact)
+	if err != nil {
+		cancelFunc()
+		return nil, err
+	}
+	manager.SetArtifactStore(artifacts)
+
+	// restores jobs which were queued or running when the application last stopped
+	if err := manager.Recover(); err != nil {
+		cancelFunc()
 		return nil, err
 	}
 
@@ -37,6 +65,15 @@ func NewScheduler(db IStore, conf config.AppConfig) (*Scheduler, error) {
 	return s, nil
 }
 
+func resources(limits config.ResourceLimits) container.Resources {
+	return container.Resources{
+		CPUs:    limits.CPUs,
+		Memory:  limits.MemoryBytes(),
+		Pids:    limits.Pids,
+		ShmSize: limits.ShmSizeBytes(),
+	}
+}
+
 func (s *Scheduler) Close() {
 	s.cancelFunc()
 	s.manager.Close()
@@ -70,3 +107,8 @@ func (s *Scheduler) AddJob(sourceId int, trigger string) error {
 	}
 	return s.manager.AddJob(source, trigger)
 }
+
+// Cancels a queued or running job
+func (s *Scheduler) CancelJob(jobId int) error {
+	return s.manager.CancelJob(jobId)
+}
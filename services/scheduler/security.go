@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"nidavellir/config"
+	container "nidavellir/services/docker/dkcontainer"
+	"nidavellir/services/store"
+)
+
+// Container hardening of a source's tasks. The source's settings can only tighten the
+// application's settings, so that editors of a source can not remove the hardening set
+// by the administrators. Also returns whether the repo is mounted as read-only
+func taskSecurity(conf config.SecurityConfig, source store.SourceSecurity) (container.Security, bool) {
+	sec := container.Security{
+		User:            conf.User,
+		ReadOnlyRootfs:  conf.ReadOnlyRootfs,
+		CapDrop:         conf.CapDrop,
+		NoNewPrivileges: conf.NoNewPrivileges,
+	}.Tighten(container.Security{
+		User:            source.User,
+		ReadOnlyRootfs:  isSet(source.ReadOnlyRootfs),
+		CapDrop:         source.CapDrop,
+		NoNewPrivileges: isSet(source.NoNewPrivileges),
+	})
+	readOnlyRepo := conf.ReadOnlyRepo || isSet(source.ReadOnlyRepo)
+
+	// tasks still need somewhere to write temporary files
+	if sec.ReadOnlyRootfs {
+		options := "rw,nosuid,nodev"
+		if size := conf.ScratchSizeBytes(); size > 0 {
+			options += fmt.Sprintf(",size=%d", size)
+		}
+		sec.Tmpfs = map[string]string{conf.Scratch: options}
+	}
+
+	return sec, readOnlyRepo
+}
+
+func isSet(flag *bool) bool {
+	return flag != nil && *flag
+}
@@ -2,20 +2,28 @@ package scheduler
 
 import (
 	"context"
+	"log"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/semaphore"
 
 	"nidavellir/libs"
+	"nidavellir/services/store"
 )
 
 type StepGroup struct {
 	Name   string
 	Tasks  []*Task
 	Branch map[int]string
+	// maximum duration of the step. 0 means no limit
+	Timeout time.Duration
+	// records the execution of each task in the step when set
+	recorder IRunRecorder
+	run      *store.StepRun
 }
 
 func NewStepGroup(name string, tasks []*Task, branch map[int]string) (*StepGroup, error) {
@@ -31,8 +39,17 @@ func NewStepGroup(name string, tasks []*Task, branch map[int]string) (*StepGroup
 	return sg, nil
 }
 
-// Executes all tasks within step group in parallel subject to the semaphore weights
-func (s *StepGroup) ExecuteTasks(ctx context.Context, sem *semaphore.Weighted) (*TaskOutput, error) {
+// Executes all tasks within step group in parallel subject to the semaphore weights.
+// Tasks which are still running when the step times out are stopped and given the
+// ExitCodeTimeout. An error is only returned if the parent context is done
+func (s *StepGroup) ExecuteTasks(parent context.Context, sem *semaphore.Weighted) (*TaskOutput, error) {
+	ctx := parent
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, s.Timeout)
+		defer cancel()
+	}
+
 	ch := make(chan *TaskOutput, len(s.Tasks))
 
 	// set wait group to wait for number of tasks in the current step
@@ -42,45 +59,81 @@ func (s *StepGroup) ExecuteTasks(ctx context.Context, sem *semaphore.Weighted) (
 	// release the semaphore and reduce wait group count
 	for _, task := range s.Tasks {
 		if err := sem.Acquire(ctx, 1); err != nil {
-			ch <- &TaskOutput{
-				Log:      errors.Wrap(err, "could not acquire semaphore lock to execute tasks").Error(),
-				ExitCode: 999,
-			}
+			ch <- acquireFailure(task, err)
 			continue
 		}
 		wg.Add(1)
-		go runTask(sem, &wg, task, ch)
+		go runTask(ctx, sem, &wg, task, ch)
 	}
 
-	// Put the wait group in a go routine. This ensures the done channel is only closed when
-	// all jobs in the StepGroup are completed. Meanwhile, the for-loop will either be waiting
-	// for the done channel to be closed and also listening to errors from the error channel
+	// Put the wait group in a go routine. This ensures the channel is only closed when all
+	// tasks in the StepGroup are completed. Tasks watch the context themselves, so when the
+	// context is done, they will stop their containers and return early
 	go func() {
 		wg.Wait()
 		close(ch)
 	}()
 
 	outputs := &TaskOutputs{}
-	for {
-		select {
-		case result, ok := <-ch:
-			if ok {
-				outputs.Add(result)
-			} else {
-				// channel closed. Time to join all the output together
-				return outputs.Combine(), nil
-			}
-
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		}
+	for result := range ch {
+		outputs.Add(result)
+		s.recordTask(result)
+	}
+
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+	return outputs.Combine(), nil
+}
+
+// Output of a task which could not run as the semaphore could not be acquired, which
+// only happens when the context is done
+func acquireFailure(task *Task, err error) *TaskOutput {
+	exitCode := ExitCodeCancelled
+	if err == context.DeadlineExceeded {
+		exitCode = ExitCodeTimeout
+	}
+
+	now := time.Now()
+	return &TaskOutput{
+		Log:       errors.Wrap(err, "could not acquire semaphore lock to execute tasks").Error(),
+		ExitCode:  exitCode,
+		TaskName:  task.TaskName,
+		Container: task.TaskTag,
+		Image:     task.Image,
+		StartTime: now,
+		EndTime:   now,
 	}
 }
 
-func runTask(sem *semaphore.Weighted, wg *sync.WaitGroup, task *Task, ch chan<- *TaskOutput) {
+func runTask(ctx context.Context, sem *semaphore.Weighted, wg *sync.WaitGroup, task *Task, ch chan<- *TaskOutput) {
 	defer sem.Release(1)
 	defer wg.Done()
-	ch <- task.Execute()
+	ch <- task.Execute(ctx)
+}
+
+// Saves the execution record of the task if the StepGroup has a recorder. Failures
+// to record are logged as they should not affect the task
+func (s *StepGroup) recordTask(output *TaskOutput) {
+	if s.recorder == nil || s.run == nil {
+		return
+	}
+
+	_, err := s.recorder.AddTaskRun(&store.TaskRun{
+		StepRunId: s.run.Id,
+		JobId:     s.run.JobId,
+		Name:      output.TaskName,
+		Container: output.Container,
+		Image:     output.Image,
+		StartTime: output.StartTime,
+		EndTime:   output.EndTime,
+		ExitCode:  output.ExitCode,
+		OOMKilled: output.OOMKilled,
+		Attempts:  output.Attempts,
+	})
+	if err != nil {
+		log.Println(errors.Wrapf(err, "could not record run of task '%s'", output.TaskName))
+	}
 }
 
 func (s *StepGroup) Validate() error {
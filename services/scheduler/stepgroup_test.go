@@ -39,10 +39,15 @@ func TestStepGroup_ExecuteTasks(t *testing.T) {
 }
 
 // Creates a mock StepGroup. This StepGroup will be formed with the first step from the
-// repo's Steps
+// repo's Steps, which runs in a worktree of its own
 func FormTestStepGroup(repo *rp.Repo, jobId int) (*StepGroup, error) {
 	var tasks []*Task
 
+	repo, err := repo.AddWorktree(rp.WorktreeDir(appDir, repo.Name, jobId))
+	if err != nil {
+		return nil, err
+	}
+
 	for _, ti := range repo.Steps[0].TaskInfoList {
 		outputDir, err := outputDir(1, jobId)
 		if err != nil {
@@ -1,13 +1,24 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	container "nidavellir/services/docker/dkcontainer"
+	"nidavellir/services/repo"
+)
+
+const (
+	// Exit code given to a task whose container was stopped because the job was cancelled
+	ExitCodeCancelled = 130
+	// Exit code given to a task whose container was stopped because it ran past its timeout
+	ExitCodeTimeout = 124
 )
 
 type Task struct {
@@ -21,6 +32,29 @@ type Task struct {
 	Env       map[string]string
 	OutputDir string
 	WorkDir   string
+	// maximum duration of each attempt of the task. 0 means no limit
+	Timeout time.Duration
+	// how the task is retried when it fails. nil means that the task is not retried
+	Retry *repo.RetryPolicy
+	// names of the tasks which must succeed before this task runs. Only used when the
+	// TaskGroup runs as a graph
+	DependsOn []string
+	// CPU, memory and process limits of the task's container
+	Resources container.Resources
+	// network of the task's container. Empty uses the default bridge network
+	Network string
+	// user, filesystem and privilege restrictions of the task's container
+	Security container.Security
+	// mounts the repo at /repo as read-only so that the task can not change the clone
+	ReadOnlyRepo bool
+	// when set, the container output is streamed line by line into Output and is left
+	// out of the TaskOutput logs
+	Output io.Writer
+}
+
+// Writers which hold incomplete lines until they are flushed
+type flusher interface {
+	Flush() error
 }
 
 func NewTask(taskName, image, tag, cmd, outputDir, workDir string, env map[string]string) (*Task, error) {
@@ -55,41 +89,148 @@ func NewTask(taskName, image, tag, cmd, outputDir, workDir string, env map[strin
 type TaskOutput struct {
 	Log      string
 	ExitCode int
+	// true when the container of the last attempt was killed as it ran out of memory
+	OOMKilled bool
+	// number of times the task was run
+	Attempts int
+	// details of the task that produced the output
+	TaskName  string
+	Container string
+	Image     string
+	StartTime time.Time
+	EndTime   time.Time
 }
 
 type TaskOutputs struct {
 	outputs []*TaskOutput
 }
 
-func (t *Task) Execute() *TaskOutput {
+// Executes the task in a container, retrying it according to the task's RetryPolicy.
+// The output contains the logs of every attempt and the exit code of the last attempt
+func (t *Task) Execute(ctx context.Context) *TaskOutput {
+	var logs []string
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		output := t.attempt(ctx)
+		output.Attempts = attempt
+		output.TaskName = t.TaskName
+		output.Container = t.TaskTag
+		output.Image = t.Image
+		output.StartTime = start
+		output.EndTime = time.Now()
+
+		retry := ctx.Err() == nil && t.Retry.ShouldRetry(attempt, output.ExitCode)
+		if attempt > 1 || retry {
+			output.Log = fmt.Sprintf("Attempt %d of %d\n%s", attempt, t.Retry.Attempts, output.Log)
+		}
+		logs = append(logs, output.Log)
+
+		if !retry {
+			output.Log = strings.Join(logs, "\n\n")
+			return output
+		}
+
+		select {
+		case <-time.After(t.Retry.Delay(attempt)):
+		case <-ctx.Done():
+			output.Log = strings.Join(append(logs, "Retry cancelled: "+ctx.Err().Error()), "\n\n")
+			output.EndTime = time.Now()
+			return output
+		}
+	}
+}
+
+// Runs a single attempt of the task in a container. If the context is done or the task's
+// timeout is reached before the container exits, the container is removed and the task
+// is marked as timed out or cancelled
+func (t *Task) attempt(ctx context.Context) *TaskOutput {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	output := t.run(ctx)
+	if ctx.Err() == nil {
+		return output
+	}
+
+	exitCode := ExitCodeCancelled
+	logs := []string{"Task: " + t.TaskName, "\n"}
+	if ctx.Err() == context.DeadlineExceeded {
+		exitCode = ExitCodeTimeout
+		logs = append(logs, fmt.Sprintf("Task timed out. Exited with code %d", exitCode))
+	} else {
+		logs = append(logs, "Task cancelled: "+ctx.Err().Error())
+	}
+
+	// Run removes the container by its id but ignores failures, and has no id if the
+	// context ended while the container was created. The container is removed by name too
+	if err := t.Stop(); err != nil {
+		logs = append(logs, err.Error())
+	}
+
+	return &TaskOutput{
+		Log:      strings.TrimSpace(strings.Join(logs, "\n")),
+		ExitCode: exitCode,
+	}
+}
+
+// Removes the task's container, found by its name, if it exists
+func (t *Task) Stop() error {
+	_, err := container.Stop(context.Background(), &container.StopOptions{Name: t.TaskTag, IgnoreNotFoundError: true})
+	if err != nil {
+		return errors.Wrapf(err, "could not stop container for task '%s'", t.TaskName)
+	}
+	return nil
+}
+
+// Runs the task's container until it exits. The container is removed if the context is
+// done before then
+func (t *Task) run(ctx context.Context) *TaskOutput {
 	re := regexp.MustCompile(`\s`)
+	repoPath := "/repo"
+	if t.ReadOnlyRepo {
+		repoPath += ":ro"
+	}
 
-	result, err := container.Run(&container.RunOptions{
+	result, err := container.Run(ctx, &container.RunOptions{
 		Image:   t.Image,
 		Name:    t.TaskTag,
 		Restart: "no",
 		Env:     t.Env,
 		Cmd:     re.Split(t.Cmd, -1),
 		Volumes: map[string]string{
-			t.WorkDir:   "/repo",
+			t.WorkDir:   repoPath,
 			t.OutputDir: "/output",
 		},
-		Daemon:  false,
-		WorkDir: t.WorkDir,
+		Daemon:    false,
+		Network:   t.Network,
+		WorkDir:   t.WorkDir,
+		Output:    t.Output,
+		Resources: t.Resources,
+		Security:  t.Security,
 	})
 
 	if result == nil {
 		panic("result should never be empty")
 	}
 
-	logs := []string{"Task: " + t.TaskName, "\n", result.Logs}
+	logs := []string{"Task: " + t.TaskName, "\n"}
+	if f, ok := t.Output.(flusher); ok {
+		_ = f.Flush()
+	}
+	if t.Output == nil {
+		logs = append(logs, result.Logs)
+	}
 	if err != nil {
 		logs = append(logs, err.Error())
 	}
 
 	return &TaskOutput{
-		Log:      strings.TrimSpace(strings.Join(logs, "\n")),
-		ExitCode: result.ExitCode,
+		Log:       strings.TrimSpace(strings.Join(logs, "\n")),
+		ExitCode:  result.ExitCode,
+		OOMKilled: result.OOMKilled,
 	}
 }
 
@@ -1,6 +1,7 @@
 package scheduler_test
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -67,7 +68,7 @@ func TestTask_Execute(t *testing.T) {
 	)
 	assert.NoError(err)
 
-	result := task.Execute()
+	result := task.Execute(context.Background())
 	assert.IsType(&TaskOutput{}, result)
 	assert.NotEmpty(result.Log)
 	assert.EqualValues(0, result.ExitCode)
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/services/store"
+)
+
+// A task in the dependency graph
+type graphNode struct {
+	task *Task
+	// index of the StepGroup which the task belongs to
+	step int
+	// number of dependencies which have not succeeded yet
+	remaining  int
+	dependents []*graphNode
+	skipped    bool
+}
+
+// Tracks the progress of a StepGroup when tasks are run as a graph. As tasks from
+// different steps can run together, the step starts when its first task starts and
+// ends when all its tasks have completed or have been skipped
+type graphStep struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	run       *store.StepRun
+	remaining int
+	outputs   TaskOutputs
+}
+
+type graphResult struct {
+	node   *graphNode
+	output *TaskOutput
+}
+
+// Runs the tasks of all StepGroups as a dependency graph. Each task starts as soon as
+// all the tasks it depends on succeed, subject to the TaskGroup's semaphore. Tasks which
+// depend on a task which did not succeed are skipped. The ExecutionResult is only
+// completed if every task succeeds
+func (t *TaskGroup) executeGraph(ctx context.Context) (*ExecutionResult, error) {
+	output := &ExecutionResult{}
+
+	nodes := make(map[string]*graphNode)
+	var order []*graphNode
+	steps := make([]*graphStep, len(t.StepGroups))
+	for i, sg := range t.StepGroups {
+		steps[i] = &graphStep{remaining: len(sg.Tasks)}
+		for _, task := range sg.Tasks {
+			node := &graphNode{task: task, step: i}
+			nodes[task.TaskName] = node
+			order = append(order, node)
+		}
+	}
+
+	for _, node := range order {
+		node.remaining = len(node.task.DependsOn)
+		for _, name := range node.task.DependsOn {
+			dep, exists := nodes[name]
+			if !exists {
+				return output, errors.Errorf("task '%s' depends on unknown task '%s'", node.task.TaskName, name)
+			}
+			dep.dependents = append(dep.dependents, node)
+		}
+	}
+
+	defer func() {
+		for _, s := range steps {
+			if s.cancel != nil {
+				s.cancel()
+			}
+		}
+	}()
+
+	var logs []string
+	results := make(chan *graphResult)
+	running := 0
+
+	launch := func(node *graphNode) {
+		s := steps[node.step]
+		if s.ctx == nil {
+			sg := t.StepGroups[node.step]
+			output.Steps = append(output.Steps, node.step)
+			s.run = t.startStepRun(sg, node.step)
+			if sg.Timeout > 0 {
+				s.ctx, s.cancel = context.WithTimeout(ctx, sg.Timeout)
+			} else {
+				s.ctx, s.cancel = context.WithCancel(ctx)
+			}
+		}
+
+		running++
+		go func() {
+			if err := t.sem.Acquire(s.ctx, 1); err != nil {
+				results <- &graphResult{node, acquireFailure(node.task, err)}
+				return
+			}
+			defer t.sem.Release(1)
+			results <- &graphResult{node, node.task.Execute(s.ctx)}
+		}()
+	}
+
+	// marks a task as done and ends its step once all the step's tasks are done
+	done := func(node *graphNode) {
+		s := steps[node.step]
+		s.remaining--
+		if s.remaining > 0 || s.ctx == nil {
+			return
+		}
+
+		result := s.outputs.Combine()
+		logs = append(logs, result.Log)
+		t.endStepRun(s.run, result.ExitCode, nil)
+		s.cancel()
+	}
+
+	var skip func(node *graphNode, cause string)
+	skip = func(node *graphNode, cause string) {
+		for _, dep := range node.dependents {
+			if dep.skipped {
+				continue
+			}
+			dep.skipped = true
+			logs = append(logs, fmt.Sprintf("Task: %s\n\nSkipped as task '%s' did not succeed", dep.task.TaskName, cause))
+			done(dep)
+			skip(dep, cause)
+		}
+	}
+
+	for _, node := range order {
+		if node.remaining == 0 {
+			launch(node)
+		}
+	}
+
+	var failed []string
+	for running > 0 {
+		result := <-results
+		running--
+
+		node := result.node
+		steps[node.step].outputs.Add(result.output)
+		t.StepGroups[node.step].recordTask(result.output)
+		done(node)
+
+		if result.output.ExitCode != 0 || ctx.Err() != nil {
+			failed = append(failed, fmt.Sprintf("'%s' (exit code %d)", node.task.TaskName, result.output.ExitCode))
+			skip(node, node.task.TaskName)
+			continue
+		}
+
+		for _, dep := range node.dependents {
+			dep.remaining--
+			if dep.remaining == 0 && !dep.skipped {
+				launch(dep)
+			}
+		}
+	}
+
+	output.Logs = formatLogs(t.Name, logs)
+	if err := ctx.Err(); err != nil {
+		return output, err
+	}
+	if len(failed) > 0 {
+		return output, errors.Errorf("tasks %s did not succeed", strings.Join(failed, ", "))
+	}
+
+	output.Completed = true
+	return output, nil
+}
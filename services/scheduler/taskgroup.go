@@ -7,19 +7,26 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sync/semaphore"
 
+	container "nidavellir/services/docker/dkcontainer"
+	"nidavellir/services/docker/dknetwork"
+	"nidavellir/services/docker/dkspec"
 	"nidavellir/services/iofiles"
 	"nidavellir/services/repo"
+	"nidavellir/services/store"
 )
 
 type TaskGroup struct {
 	Name       string
 	StepGroups []*StepGroup
 	ctx        context.Context
+	cancel     context.CancelFunc
+	cancelled  int32
 	sem        *semaphore.Weighted
 	rp         *repo.Repo
 	SourceId   int
@@ -28,6 +35,16 @@ type TaskGroup struct {
 	Duration   time.Duration
 	AppFolder  string
 	OutputDir  string
+	// records the execution of each step and task when set
+	recorder IRunRecorder
+	// when true, tasks are run as a dependency graph instead of step by step
+	graph bool
+	// network mode of the task containers. See the modes in dkspec
+	network string
+	// the TaskGroup is not dispatched before this time. Used to delay retries
+	notBefore time.Time
+	// set by the JobManager, under its lock, once the job has ended
+	ended bool
 }
 
 type ExecutionResult struct {
@@ -42,22 +59,28 @@ func NewTaskGroup(rp *repo.Repo, ctx context.Context, sourceId, jobId int, taskD
 		return nil, err
 	}
 
+	// the job gets its own checkout so that other jobs of the repo can not change it
+	rp, err = rp.AddWorktree(repo.WorktreeDir(appFolder, rp.Name, jobId))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	tg := &TaskGroup{
 		Name:       rp.Name,
 		ctx:        ctx,
+		cancel:     cancel,
 		rp:         rp,
 		sem:        semaphore.NewWeighted(int64(runtime.NumCPU())),
 		StepGroups: []*StepGroup{},
 		SourceId:   sourceId,
 		JobId:      jobId,
 		TaskDate:   taskDate.Format("2006-01-02 15:04:05"),
-		Duration:   1 * time.Hour, // default duration is 1 hour
+		Duration:   rp.Timeout, // timeout from the runtime setup. 0 means no limit
 		AppFolder:  appFolder,
 		OutputDir:  outputDir,
-	}
-
-	if err := tg.updateRepo(); err != nil {
-		return nil, err
+		graph:      rp.Graph,
+		network:    rp.Network,
 	}
 
 	// Checks if image needs to be built
@@ -65,20 +88,48 @@ func NewTaskGroup(rp *repo.Repo, ctx context.Context, sourceId, jobId int, taskD
 		// if so, check that image is updated. If image is updated, don't build, else build
 		err := tg.updateImage()
 		if err != nil {
+			tg.Close()
 			return nil, err
 		}
 	} else if err := tg.pullImage(); err != nil {
 		// no need to build, but check if image exists, if not pull image
+		tg.Close()
 		return nil, err
 	}
 
 	if err := tg.addStepGroups(); err != nil {
+		tg.Close()
 		return nil, errors.Wrap(err, "could not create TaskGroup due to errors in StepGroup configuration")
 	}
 
 	return tg, nil
 }
 
+// Cancels the TaskGroup. If the TaskGroup is executing, all running task containers
+// will be removed and Execute will return with an error
+func (t *TaskGroup) Cancel() {
+	atomic.StoreInt32(&t.cancelled, 1)
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// Removes the worktree of the TaskGroup. The TaskGroup can not be executed afterwards.
+// This should be called once the TaskGroup has been executed or will not be executed
+func (t *TaskGroup) Close() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	if err := t.rp.RemoveWorktree(); err != nil {
+		log.Println(errors.Wrapf(err, "could not remove worktree of job %d", t.JobId))
+	}
+}
+
+// Checks if the TaskGroup was cancelled
+func (t *TaskGroup) IsCancelled() bool {
+	return atomic.LoadInt32(&t.cancelled) == 1
+}
+
 // Adds any environment variable to all tasks in the TaskGroup. These variables will have higher priority
 func (t *TaskGroup) AddEnvVar(env map[string]string) *TaskGroup {
 	for _, sg := range t.StepGroups {
@@ -91,12 +142,74 @@ func (t *TaskGroup) AddEnvVar(env map[string]string) *TaskGroup {
 	return t
 }
 
-// Sets the maximum job duration.
+// Sets the recorder used to save the execution records of the steps and tasks
+func (t *TaskGroup) SetRecorder(recorder IRunRecorder) *TaskGroup {
+	t.recorder = recorder
+	return t
+}
+
+// Streams the container output of every task into the log file as the tasks run. Each
+// line is prefixed with the step and task name
+func (t *TaskGroup) SetLogFile(logFile *iofiles.LogFile) *TaskGroup {
+	for _, sg := range t.StepGroups {
+		for _, task := range sg.Tasks {
+			task.Output = logFile.PrefixWriter(fmt.Sprintf("[%s | %s] ", sg.Name, task.TaskName))
+		}
+	}
+	return t
+}
+
+// Sets the maximum job duration. A duration of 0 means that the job has no time limit
 func (t *TaskGroup) SetMaxDuration(duration time.Duration) *TaskGroup {
 	t.Duration = duration
 	return t
 }
 
+// Limits the job duration to the given duration if it is tighter than the current
+// maximum job duration. A duration of 0 is ignored as it means no limit
+func (t *TaskGroup) LimitMaxDuration(duration time.Duration) *TaskGroup {
+	if duration > 0 && (t.Duration <= 0 || duration < t.Duration) {
+		t.Duration = duration
+	}
+	return t
+}
+
+// Fills in the container limits which the tasks did not declare with the defaults and
+// lowers every limit to its cap
+func (t *TaskGroup) LimitResources(defaults, caps container.Resources) *TaskGroup {
+	for _, sg := range t.StepGroups {
+		for _, task := range sg.Tasks {
+			task.Resources = task.Resources.WithDefaults(defaults).Cap(caps)
+		}
+	}
+	return t
+}
+
+// Sets the hardening of every task container and whether the repo is mounted as read-only
+func (t *TaskGroup) SetSecurity(security container.Security, readOnlyRepo bool) *TaskGroup {
+	for _, sg := range t.StepGroups {
+		for _, task := range sg.Tasks {
+			task.Security = security
+			task.ReadOnlyRepo = readOnlyRepo
+		}
+	}
+	return t
+}
+
+// Holds the TaskGroup back from being dispatched until the given time
+func (t *TaskGroup) SetNotBefore(at time.Time) *TaskGroup {
+	t.notBefore = at
+	return t
+}
+
+// Overrides the network mode of the runtime config. An empty mode is ignored
+func (t *TaskGroup) SetNetwork(mode string) *TaskGroup {
+	if mode != "" {
+		t.network = mode
+	}
+	return t
+}
+
 // Executes the TaskGroup and returns the ExecutionResult. Note that even if the TaskGroup
 // returns an error, the ExecutionResult will not be empty. This is because the
 // ExecutionResult will store successful intermediate results
@@ -107,21 +220,44 @@ func (t *TaskGroup) Execute() (*ExecutionResult, error) {
 		return output, nil
 	}
 
+	removeNetwork, err := t.setupNetwork()
+	if err != nil {
+		return output, err
+	}
+	defer removeNetwork()
+
 	var logs []string
-	ctx, cancel := context.WithTimeout(t.ctx, t.Duration)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.Duration > 0 {
+		ctx, cancel = context.WithTimeout(t.ctx, t.Duration)
+	} else {
+		ctx, cancel = context.WithCancel(t.ctx)
+	}
 	defer cancel()
 
+	if t.graph {
+		return t.executeGraph(ctx)
+	}
+
 	index := 0
 	sg := t.StepGroups[index]
 	for {
 		output.Steps = append(output.Steps, index)
+		run := t.startStepRun(sg, index)
 		result, err := sg.ExecuteTasks(ctx, t.sem)
 		if err != nil {
+			exitCode := ExitCodeCancelled
+			if err == context.DeadlineExceeded {
+				exitCode = ExitCodeTimeout
+			}
+			t.endStepRun(run, exitCode, nil)
 			return output, err
 		}
 		logs = append(logs, result.Log)
 
 		sg, index, err = t.nextStep(index, result.ExitCode)
+		t.endStepRun(run, result.ExitCode, sg)
 		if err != nil || sg == nil {
 			output.Completed = sg == nil
 			output.Logs = formatLogs(t.Name, logs)
@@ -131,6 +267,88 @@ func (t *TaskGroup) Execute() (*ExecutionResult, error) {
 	}
 }
 
+// Sets the network of every task. Jobs in the isolated mode get a network of their own,
+// which is removed by the returned function once the tasks are done
+func (t *TaskGroup) setupNetwork() (func(), error) {
+	name := t.network
+	remove := func() {}
+
+	switch t.network {
+	case "", dkspec.ModeBridge:
+		name = ""
+	case dkspec.ModeNone, dkspec.ModeHost:
+	case dkspec.ModeIsolated:
+		name = dknetwork.JobNetwork(t.JobId)
+		// the network is left behind if the application stopped while the job was running
+		if err := dknetwork.Remove(context.Background(), name); err != nil {
+			return nil, errors.Wrap(err, "could not remove previous network of the job")
+		}
+		if err := dknetwork.Create(context.Background(), name); err != nil {
+			return nil, err
+		}
+		remove = func() {
+			if err := dknetwork.Remove(context.Background(), name); err != nil {
+				log.Println(errors.Wrapf(err, "could not remove network of job %d", t.JobId))
+			}
+		}
+	default:
+		exists, err := dknetwork.Exists(context.Background(), name)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, errors.Errorf("network '%s' does not exist", name)
+		}
+	}
+
+	for _, sg := range t.StepGroups {
+		for _, task := range sg.Tasks {
+			task.Network = name
+		}
+	}
+	return remove, nil
+}
+
+// Saves the execution record of the step when it starts. The StepGroup uses the record
+// to save the execution records of its tasks. Returns nil if the TaskGroup has no recorder
+// or if the record could not be saved
+func (t *TaskGroup) startStepRun(sg *StepGroup, index int) *store.StepRun {
+	if t.recorder == nil {
+		return nil
+	}
+
+	run, err := t.recorder.AddStepRun(&store.StepRun{
+		JobId:     t.JobId,
+		Name:      sg.Name,
+		Position:  index,
+		StartTime: time.Now(),
+	})
+	if err != nil {
+		log.Println(errors.Wrapf(err, "could not record run of step '%s'", sg.Name))
+		return nil
+	}
+
+	sg.recorder = t.recorder
+	sg.run = run
+	return run
+}
+
+// Saves the exit code and the next step (if any) of the step's execution record
+func (t *TaskGroup) endStepRun(run *store.StepRun, exitCode int, next *StepGroup) {
+	if t.recorder == nil || run == nil {
+		return
+	}
+
+	run.EndTime = time.Now()
+	run.ExitCode = exitCode
+	if next != nil {
+		run.Branch = next.Name
+	}
+
+	if _, err := t.recorder.UpdateStepRun(run); err != nil {
+		log.Println(errors.Wrapf(err, "could not record end of step '%s'", run.Name))
+	}
+}
+
 // determines the next step based on the branching rules conditioned on the current step index and exit code
 func (t *TaskGroup) nextStep(index, exitCode int) (*StepGroup, int, error) {
 	if exitCode == 0 {
@@ -159,7 +377,7 @@ func (t *TaskGroup) nextStep(index, exitCode int) (*StepGroup, int, error) {
 
 // Adds StepGroups from the repo.Steps information. Order of execution for the StepGroup
 // is determined by their relative position in the repo's runtime.yaml config file.
-//Tasks in each StepGroup will be executed in parallel.
+// Tasks in each StepGroup will be executed in parallel.
 func (t *TaskGroup) addStepGroups() error {
 	for _, step := range t.rp.Steps {
 		var groups []*Task
@@ -177,6 +395,10 @@ func (t *TaskGroup) addStepGroups() error {
 			if err != nil {
 				return errors.Wrap(err, "invalid task specifications")
 			}
+			t.Timeout = task.Timeout
+			t.Retry = task.Retry
+			t.DependsOn = task.DependsOn
+			t.Resources = task.Resources
 
 			groups = append(groups, t)
 		}
@@ -185,20 +407,13 @@ func (t *TaskGroup) addStepGroups() error {
 		if err != nil {
 			return err
 		}
+		sg.Timeout = step.Timeout
 
 		t.StepGroups = append(t.StepGroups, sg)
 	}
 	return nil
 }
 
-// Updates the repo to the latest version
-func (t *TaskGroup) updateRepo() error {
-	if err := t.rp.Clone(); err != nil {
-		return err
-	}
-	return nil
-}
-
 // Check image is updated
 func (t *TaskGroup) updateImage() error {
 	rp := t.rp
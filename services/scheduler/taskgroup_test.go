@@ -187,6 +187,26 @@ func TestTaskGroup_BranchExitCode(t *testing.T) {
 	}
 }
 
+func TestTaskGroup_LimitMaxDuration(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Current  time.Duration
+		Limit    time.Duration
+		Expected time.Duration
+	}{
+		{0, 0, 0},
+		{0, time.Hour, time.Hour},
+		{time.Hour, 0, time.Hour},
+		{time.Hour, time.Minute, time.Minute},
+		{time.Minute, time.Hour, time.Minute},
+	} {
+		tg := (&TaskGroup{}).SetMaxDuration(test.Current).LimitMaxDuration(test.Limit)
+		assert.Equal(test.Expected, tg.Duration)
+	}
+}
+
 func newTaskGroup(rp *repo.Repo) (*TaskGroup, error) {
 	return NewTaskGroup(rp, context.Background(), 0, uniqueJobId(), time.Now(), appDir)
 }
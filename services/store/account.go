@@ -1,7 +1,10 @@
 package store
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 
 	"nidavellir/libs"
 )
@@ -9,10 +12,19 @@ import (
 type Account struct {
 	Id       int    `json:"id"`
 	Username string `json:"username"`
+	// bcrypt hash of the password. Plain text passwords given to AddAccount and
+	// UpdateAccount are hashed before they are saved
 	Password string `json:"password,omitempty"`
 	IsAdmin  bool   `json:"isAdmin"`
+	// the account's role on every source. Source grants can give the account a more
+	// privileged role on specific sources
+	Role string `json:"role"`
+	// hash made by hashPassword or loaded from the database. A password equal to it is not
+	// hashed again, while any other password is hashed even if it looks like a hash
+	hashed string
 }
 
+// Creates a new Account with its password hashed
 func NewAccount(username, password string, isAdmin bool) (*Account, error) {
 	u := &Account{
 		Username: username,
@@ -24,6 +36,10 @@ func NewAccount(username, password string, isAdmin bool) (*Account, error) {
 		return nil, err
 	}
 
+	if err := u.hashPassword(); err != nil {
+		return nil, err
+	}
+
 	return u, nil
 }
 
@@ -32,6 +48,18 @@ func (u *Account) Validate() error {
 		return errors.New("username cannot be empty")
 	}
 
+	u.Role = libs.LowerTrim(u.Role)
+	if u.Role == "" {
+		if u.IsAdmin {
+			u.Role = RoleAdmin
+		} else {
+			u.Role = RoleViewer
+		}
+	} else if !isValidRole(u.Role) {
+		return errors.Errorf("'%s' is not a valid role. Use one of %s", u.Role, strings.Join(roles, ", "))
+	}
+	u.IsAdmin = u.Role == RoleAdmin
+
 	if u.IsAdmin && libs.IsEmptyOrWhitespace(u.Password) {
 		return errors.New("password cannot be empty for admin accounts")
 	}
@@ -39,8 +67,41 @@ func (u *Account) Validate() error {
 	return nil
 }
 
+// Checks the password against the account's password hash
 func (u *Account) HasValidPassword(password string) bool {
-	return u.Password == password
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// Remembers the password hash loaded from the database so that saving the account does
+// not hash it again. Called by gorm after the account is queried
+func (u *Account) AfterFind() {
+	if isPasswordHash(u.Password) {
+		u.hashed = u.Password
+	}
+}
+
+// Replaces the password with its hash. Only the hash the account was loaded with or
+// already hashed to is kept
+func (u *Account) hashPassword() error {
+	if u.hashed != "" && u.Password == u.hashed {
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "could not hash password")
+	}
+	u.Password = string(hash)
+	u.hashed = u.Password
+	return nil
+}
+
+// Checks if the password is a bcrypt hash
+func isPasswordHash(password string) bool {
+	if _, err := bcrypt.Cost([]byte(password)); err != nil {
+		return false
+	}
+	return strings.HasPrefix(password, "$2")
 }
 
 // Hides all sensitive data
@@ -82,7 +143,8 @@ func (p *Postgres) GetAccounts() ([]*Account, error) {
 	return accounts, nil
 }
 
-func (p *Postgres) getAccountById(id int) (*Account, error) {
+// Gets the account by its id. The password hash is included
+func (p *Postgres) GetAccountById(id int) (*Account, error) {
 	var account Account
 	if err := p.db.First(&account, "id = ?", id).Error; err != nil {
 		return nil, errors.Wrapf(err, "could not get account with id '%d'", id)
@@ -92,6 +154,14 @@ func (p *Postgres) getAccountById(id int) (*Account, error) {
 
 // Creates an Account. The caller should check that it is the admin calling this method
 func (p *Postgres) AddAccount(account *Account) (*Account, error) {
+	if err := account.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := account.hashPassword(); err != nil {
+		return nil, err
+	}
+
 	if err := p.db.Create(account).Error; err != nil {
 		return nil, errors.Wrap(err, "could not create new account")
 	}
@@ -99,24 +169,52 @@ func (p *Postgres) AddAccount(account *Account) (*Account, error) {
 	return account, nil
 }
 
-// Updates a account's username and password. The caller should check that it is the admin calling
-// this method
+// Updates a account's username, password and role. The password is left unchanged if it
+// is empty. The caller should check that it is the admin calling this method
 func (p *Postgres) UpdateAccount(account *Account) (*Account, error) {
 	if account.Id <= 0 {
 		return nil, errors.New("account id must be specified")
 	}
 
-	if prev, err := p.getAccountById(account.Id); err != nil {
+	prev, err := p.GetAccountById(account.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.Role == "" {
+		account.Role = prev.Role
+	}
+	if account.Password == "" {
+		// the existing password is kept but it is needed for the validation of admins
+		account.Password = prev.Password
+		account.hashed = prev.hashed
+	}
+	if err := account.Validate(); err != nil {
+		return nil, err
+	}
+
+	if prev.IsAdmin && !account.IsAdmin {
+		if isLastAdmin, err := p.IsLastAdmin(account.Id); err != nil {
+			return nil, err
+		} else if isLastAdmin {
+			return nil, errors.New("cannot remove the admin role from the last admin account")
+		}
+	}
+
+	if err := account.hashPassword(); err != nil {
 		return nil, err
-	} else {
-		// set critical components here
-		account.IsAdmin = prev.IsAdmin // non-admins cannot make themselves admins
 	}
 
-	err := p.db.
+	// a map is used so that the admin flag can be cleared
+	err = p.db.
 		Model(account).
 		Where("id = ?", account.Id).
-		Update(*account).
+		Updates(map[string]interface{}{
+			"username": account.Username,
+			"password": account.Password,
+			"is_admin": account.IsAdmin,
+			"role":     account.Role,
+		}).
 		Error
 	if err != nil {
 		return nil, errors.Wrap(err, "could not update account")
@@ -145,7 +243,7 @@ func (p *Postgres) RemoveAccount(id int) error {
 // Checks if the account specified by the id is the last admin. Usually, this method is used to ensure that
 // we do not remove the last admin account
 func (p *Postgres) IsLastAdmin(id int) (bool, error) {
-	a, err := p.getAccountById(id)
+	a, err := p.GetAccountById(id)
 	if err != nil {
 		return false, err
 	} else if !a.IsAdmin {
@@ -158,3 +256,32 @@ func (p *Postgres) IsLastAdmin(id int) (bool, error) {
 	}
 	return numAdmin == 1, nil
 }
+
+// Hashes passwords which were saved in plain text before passwords were hashed
+func (p *Postgres) hashPlainPasswords() error {
+	var accounts []*Account
+	if err := p.db.Find(&accounts).Error; err != nil {
+		return errors.Wrap(err, "could not get accounts")
+	}
+
+	for _, account := range accounts {
+		if isPasswordHash(account.Password) {
+			continue
+		}
+
+		if err := account.hashPassword(); err != nil {
+			return err
+		}
+
+		err := p.db.
+			Model(account).
+			Where("id = ?", account.Id).
+			Update("password", account.Password).
+			Error
+		if err != nil {
+			return errors.Wrapf(err, "could not hash password of account '%s'", account.Username)
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,12 @@
 package store_test
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/dhui/dktest"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 
 	. "nidavellir/services/store"
 )
@@ -37,6 +39,15 @@ func TestNewAccount(t *testing.T) {
 			assert.False(u.HasValidPassword(test.Password + "1"))
 		}
 	}
+
+	// a password which looks like a bcrypt hash is hashed like any other password
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(err)
+	u, err := NewAccount("username", string(hash), false)
+	assert.NoError(err)
+	assert.NotEqual(string(hash), u.Password)
+	assert.True(u.HasValidPassword(string(hash)))
+	assert.False(u.HasValidPassword("password"))
 }
 
 func TestPostgres_AddAccount(t *testing.T) {
@@ -176,7 +187,88 @@ func TestPostgres_UpdateAccount(t *testing.T) {
 		u, err = db.UpdateAccount(u)
 
 		assert.NoError(err)
-		assert.Equal(expected, u)
+		assert.Equal(expected.Id, u.Id)
+		assert.Equal(expected.Username, u.Username)
+		assert.Equal(expected.IsAdmin, u.IsAdmin)
+
+		// password is saved as a hash
+		u, err = db.GetAccount(expected.Username)
+		assert.NoError(err)
+		assert.NotEqual(expected.Password, u.Password)
+		assert.True(u.HasValidPassword(expected.Password))
+
+		// empty password leaves the password unchanged
+		u.Password = ""
+		_, err = db.UpdateAccount(u)
+		assert.NoError(err)
+
+		u, err = db.GetAccount(expected.Username)
+		assert.NoError(err)
+		assert.True(u.HasValidPassword(expected.Password))
+
+		// a hash given as the new password is hashed too
+		hash, err := bcrypt.GenerateFromPassword([]byte(expected.Password), bcrypt.MinCost)
+		assert.NoError(err)
+		u.Password = string(hash)
+		_, err = db.UpdateAccount(u)
+		assert.NoError(err)
+
+		u, err = db.GetAccount(expected.Username)
+		assert.NoError(err)
+		assert.True(u.HasValidPassword(string(hash)))
+		assert.False(u.HasValidPassword(expected.Password))
+
+		// the last admin can't lose the admin role
+		u.Role = RoleEditor
+		_, err = db.UpdateAccount(u)
+		assert.Error(err)
+
+		user, err := db.GetAccount("user2")
+		assert.NoError(err)
+		user.Role = RoleOperator
+		user, err = db.UpdateAccount(user)
+		assert.NoError(err)
+		assert.Equal(RoleOperator, user.Role)
+		assert.False(user.IsAdmin)
+	})
+}
+
+func TestPostgres_HashPlainPasswords(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info)
+		assert.NoError(err)
+
+		// insert accounts the way they were saved before passwords were hashed
+		cs, err := connectionString(info)
+		assert.NoError(err)
+		conn, err := sql.Open("postgres", cs)
+		assert.NoError(err)
+		defer func() { _ = conn.Close() }()
+
+		_, err = conn.Exec(`INSERT INTO account (username, password, is_admin) VALUES ('admin', 'password', TRUE), ('user', '', FALSE)`)
+		assert.NoError(err)
+
+		// hashing is done on every migration
+		assert.NoError(db.Migrate())
+
+		admin, err := db.GetAccount("admin")
+		assert.NoError(err)
+		assert.NotEqual("password", admin.Password)
+		assert.True(admin.HasValidPassword("password"))
+
+		user, err := db.GetAccount("user")
+		assert.NoError(err)
+		assert.True(user.HasValidPassword(""))
+		assert.False(user.HasValidPassword("password"))
+
+		// hashed passwords are not hashed again
+		assert.NoError(db.Migrate())
+		same, err := db.GetAccount("admin")
+		assert.NoError(err)
+		assert.Equal(admin.Password, same.Password)
 	})
 }
 
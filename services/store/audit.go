@@ -0,0 +1,161 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/libs"
+)
+
+const (
+	AuditCreate  = "CREATE"
+	AuditUpdate  = "UPDATE"
+	AuditDelete  = "DELETE"
+	AuditTrigger = "TRIGGER"
+
+	AuditSource       = "SOURCE"
+	AuditSecret       = "SECRET"
+	AuditAccount      = "ACCOUNT"
+	AuditSourceGrant  = "SOURCE_GRANT"
+	AuditApiToken     = "API_TOKEN"
+	AuditNotification = "NOTIFICATION"
+
+	// Maximum number of audit logs returned by GetAuditLogs
+	MaxAuditLogs = 1000
+)
+
+// Records a change made through the api
+type AuditLog struct {
+	Id int `json:"id"`
+	// username of the user who made the change. Empty if authentication is not used
+	Actor      string `json:"actor"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetId   int    `json:"targetId"`
+	// json snapshot of the target before and after the change
+	Before AuditState `json:"before"`
+	After  AuditState `json:"after"`
+	Time   time.Time  `json:"time"`
+}
+
+// Json snapshot of an audited target. It is saved as text and returned as json
+type AuditState string
+
+func (s AuditState) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	return []byte(s), nil
+}
+
+func (s *AuditState) UnmarshalJSON(data []byte) error {
+	*s = AuditState(data)
+	return nil
+}
+
+// Creates an audit log. The before and after states are converted to json, so any
+// sensitive data in them must be masked beforehand
+func NewAuditLog(actor, action, targetType string, targetId int, before, after interface{}) (*AuditLog, error) {
+	b, err := json.Marshal(before)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not convert state before change to json")
+	}
+	a, err := json.Marshal(after)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not convert state after change to json")
+	}
+
+	return &AuditLog{
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Before:     AuditState(b),
+		After:      AuditState(a),
+		Time:       time.Now(),
+	}, nil
+}
+
+func (a *AuditLog) Validate() error {
+	if !libs.IsIn(a.Action, []string{AuditCreate, AuditUpdate, AuditDelete, AuditTrigger}) {
+		return errors.Errorf("'%s' is not a valid audit action", a.Action)
+	} else if !libs.IsIn(a.TargetType, []string{AuditSource, AuditSecret, AuditAccount, AuditSourceGrant, AuditApiToken, AuditNotification}) {
+		return errors.Errorf("'%s' is not a valid audit target type", a.TargetType)
+	}
+
+	if a.Before == "" {
+		a.Before = "null"
+	}
+	if a.After == "" {
+		a.After = "null"
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	return nil
+}
+
+func (p *Postgres) AddAuditLog(log *AuditLog) (*AuditLog, error) {
+	log.Id = 0
+	if err := log.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := p.db.Create(log).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not add audit log for %s %s", log.Action, log.TargetType)
+	}
+	return log, nil
+}
+
+// Gets the audit logs matching the options, latest first
+func (p *Postgres) GetAuditLogs(options *ListAuditOption) ([]*AuditLog, error) {
+	if options == nil {
+		options = &ListAuditOption{}
+	}
+
+	query := p.db
+	if options.Actor != "" {
+		query = query.Where("actor = ?", options.Actor)
+	}
+	if options.Action != "" {
+		query = query.Where("action = ?", options.Action)
+	}
+	if options.TargetType != "" {
+		query = query.Where("target_type = ?", options.TargetType)
+	}
+	if options.TargetId != 0 {
+		query = query.Where("target_id = ?", options.TargetId)
+	}
+	if !options.Since.IsZero() {
+		query = query.Where("time >= ?", options.Since)
+	}
+	if !options.Until.IsZero() {
+		query = query.Where("time < ?", options.Until)
+	}
+
+	limit := options.Limit
+	if limit <= 0 || limit > MaxAuditLogs {
+		limit = MaxAuditLogs
+	}
+
+	var logs []*AuditLog
+	if err := query.Order("time DESC, id DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, errors.Wrap(err, "could not get audit logs")
+	}
+	return logs, nil
+}
+
+type ListAuditOption struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetId   int
+	// only logs at or after this time
+	Since time.Time
+	// only logs before this time
+	Until time.Time
+	// defaults to MaxAuditLogs
+	Limit int
+}
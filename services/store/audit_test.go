@@ -0,0 +1,91 @@
+package store_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dhui/dktest"
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestNewAuditLog(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	before := &Secret{Id: 1, SourceId: 1, Key: "key", Value: "old"}
+	after := &Secret{Id: 1, SourceId: 1, Key: "key", Value: "new"}
+	log, err := NewAuditLog("user", AuditUpdate, AuditSecret, 1, before.Mask(), after.Mask())
+	assert.NoError(err)
+	assert.NoError(log.Validate())
+	assert.NotContains(string(log.Before), "old")
+	assert.NotContains(string(log.After), "new")
+
+	// states are returned as json rather than as strings
+	content, err := json.Marshal(log)
+	assert.NoError(err)
+	var output struct {
+		Before map[string]interface{} `json:"before"`
+		After  map[string]interface{} `json:"after"`
+	}
+	assert.NoError(json.Unmarshal(content, &output))
+	assert.Equal("key", output.After["key"])
+
+	log, err = NewAuditLog("user", AuditCreate, AuditSource, 1, nil, nil)
+	assert.NoError(err)
+	assert.EqualValues("null", log.Before)
+
+	for _, log := range []*AuditLog{
+		{Action: "READ", TargetType: AuditSource},
+		{Action: AuditCreate, TargetType: "JOB"},
+	} {
+		assert.Error(log.Validate())
+	}
+}
+
+func TestPostgres_AuditLogs(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info)
+		assert.NoError(err)
+
+		start := time.Now().Add(-time.Minute)
+		for _, log := range []*AuditLog{
+			{Actor: "admin", Action: AuditCreate, TargetType: AuditSource, TargetId: 1, After: `{"id":1}`},
+			{Actor: "admin", Action: AuditUpdate, TargetType: AuditSource, TargetId: 1, Before: `{"id":1}`, After: `{"id":1}`},
+			{Actor: "user", Action: AuditTrigger, TargetType: AuditSource, TargetId: 1},
+			{Actor: "user", Action: AuditDelete, TargetType: AuditSecret, TargetId: 2, Before: `{"id":2}`},
+		} {
+			log, err := db.AddAuditLog(log)
+			assert.NoError(err)
+			assert.NotZero(log.Id)
+		}
+
+		for _, test := range []struct {
+			Options  *ListAuditOption
+			Expected int
+		}{
+			{nil, 4},
+			{&ListAuditOption{Actor: "admin"}, 2},
+			{&ListAuditOption{Action: AuditTrigger}, 1},
+			{&ListAuditOption{TargetType: AuditSource, TargetId: 1}, 3},
+			{&ListAuditOption{Since: start}, 4},
+			{&ListAuditOption{Until: start}, 0},
+			{&ListAuditOption{Limit: 2}, 2},
+		} {
+			logs, err := db.GetAuditLogs(test.Options)
+			assert.NoError(err)
+			assert.Len(logs, test.Expected)
+		}
+
+		logs, err := db.GetAuditLogs(nil)
+		assert.NoError(err)
+		assert.Equal(AuditDelete, logs[0].Action)
+		assert.EqualValues(`{"id":2}`, logs[0].Before)
+		assert.EqualValues("null", logs[0].After)
+	})
+}
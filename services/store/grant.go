@@ -0,0 +1,128 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/libs"
+)
+
+const (
+	// Can view sources, jobs and their logs
+	RoleViewer = "viewer"
+	// Can also trigger and cancel jobs
+	RoleOperator = "operator"
+	// Can also change sources, their secrets and notifications
+	RoleEditor = "editor"
+	// Can do everything, including managing accounts
+	RoleAdmin = "admin"
+)
+
+// Roles ordered from the least to the most privileged. Every role has the privileges
+// of the roles before it
+var roles = []string{RoleViewer, RoleOperator, RoleEditor, RoleAdmin}
+
+// Checks if the role has at least the privileges of the required role
+func HasRole(role, required string) bool {
+	return roleLevel(role) >= roleLevel(required) && roleLevel(required) >= 0
+}
+
+// Gets the more privileged of the two roles
+func HigherRole(a, b string) string {
+	if roleLevel(b) > roleLevel(a) {
+		return b
+	}
+	return a
+}
+
+// Gets the less privileged of the two roles
+func LowerRole(a, b string) string {
+	if roleLevel(b) < roleLevel(a) {
+		return b
+	}
+	return a
+}
+
+func roleLevel(role string) int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Roles which can be granted on a source. Viewers are left out as every account can
+// already view every source, while admins have every role on every source
+var grantRoles = []string{RoleOperator, RoleEditor}
+
+func isValidRole(role string) bool {
+	return libs.IsIn(role, roles)
+}
+
+// Gives the account a role on a single source in addition to its own role. As every
+// account can view every source, grants are only given for the operator and editor roles
+type SourceGrant struct {
+	Id        int    `json:"id"`
+	AccountId int    `json:"accountId"`
+	SourceId  int    `json:"sourceId"`
+	Role      string `json:"role"`
+}
+
+func (g *SourceGrant) Validate() error {
+	if g.AccountId <= 0 {
+		return errors.New("account id not specified")
+	} else if g.SourceId <= 0 {
+		return errors.New("source id not specified")
+	}
+
+	g.Role = libs.LowerTrim(g.Role)
+	if g.Role != RoleOperator && g.Role != RoleEditor {
+		return errors.Errorf("'%s' is not a valid source role. Use one of %s", g.Role, strings.Join(grantRoles, ", "))
+	}
+	return nil
+}
+
+// Gets all source grants of the account
+func (p *Postgres) GetSourceGrants(accountId int) ([]*SourceGrant, error) {
+	var grants []*SourceGrant
+	if err := p.db.Order("source_id").Find(&grants, "account_id = ?", accountId).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not get source grants of account id %d", accountId)
+	}
+	return grants, nil
+}
+
+// Gives the account the role on the source, replacing any role it had on the source
+func (p *Postgres) SetSourceGrant(grant *SourceGrant) (*SourceGrant, error) {
+	if err := grant.Validate(); err != nil {
+		return nil, err
+	}
+
+	var existing SourceGrant
+	err := p.db.First(&existing, "account_id = ? AND source_id = ?", grant.AccountId, grant.SourceId).Error
+	if err == nil {
+		grant.Id = existing.Id
+		err = p.db.Model(grant).Where("id = ?", grant.Id).Update("role", grant.Role).Error
+	} else {
+		grant.Id = 0
+		err = p.db.Create(grant).Error
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not grant account id %d access to source id %d", grant.AccountId, grant.SourceId)
+	}
+	return grant, nil
+}
+
+// Removes the account's role on the source
+func (p *Postgres) RemoveSourceGrant(accountId, sourceId int) error {
+	err := p.db.
+		Where("account_id = ? AND source_id = ?", accountId, sourceId).
+		Delete(&SourceGrant{}).
+		Error
+	if err != nil {
+		return errors.Wrapf(err, "could not remove access of account id %d to source id %d", accountId, sourceId)
+	}
+	return nil
+}
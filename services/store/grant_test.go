@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/dhui/dktest"
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestHasRole(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Role     string
+		Required string
+		Expected bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleEditor, RoleOperator, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleAdmin, RoleEditor, true},
+		{"", RoleViewer, false},
+		{RoleAdmin, "unknown", false},
+	} {
+		assert.Equal(test.Expected, HasRole(test.Role, test.Required), "%s requires %s", test.Role, test.Required)
+	}
+
+	assert.Equal(RoleEditor, HigherRole(RoleViewer, RoleEditor))
+	assert.Equal(RoleEditor, HigherRole(RoleEditor, RoleOperator))
+}
+
+func TestAccount_Validate(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Account  Account
+		Role     string
+		IsAdmin  bool
+		HasError bool
+	}{
+		{Account{Username: "user"}, RoleViewer, false, false},
+		{Account{Username: "user", Role: " Editor "}, RoleEditor, false, false},
+		{Account{Username: "admin", Password: "password", IsAdmin: true}, RoleAdmin, true, false},
+		{Account{Username: "admin", Password: "password", Role: RoleAdmin}, RoleAdmin, true, false},
+		{Account{Username: "admin", Role: RoleAdmin}, "", false, true},
+		{Account{Username: "user", Role: "owner"}, "", false, true},
+	} {
+		a := test.Account
+		err := a.Validate()
+		if test.HasError {
+			assert.Error(err)
+		} else {
+			assert.NoError(err)
+			assert.Equal(test.Role, a.Role)
+			assert.Equal(test.IsAdmin, a.IsAdmin)
+		}
+	}
+}
+
+func TestPostgres_SourceGrants(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedAccounts)
+		assert.NoError(err)
+
+		user, err := db.GetAccount("user2")
+		assert.NoError(err)
+
+		_, err = db.SetSourceGrant(&SourceGrant{AccountId: user.Id, SourceId: 1, Role: RoleAdmin})
+		assert.Error(err)
+
+		_, err = db.SetSourceGrant(&SourceGrant{AccountId: user.Id, SourceId: 1, Role: RoleOperator})
+		assert.NoError(err)
+		_, err = db.SetSourceGrant(&SourceGrant{AccountId: user.Id, SourceId: 2, Role: RoleOperator})
+		assert.NoError(err)
+
+		// replaces the role on the source
+		_, err = db.SetSourceGrant(&SourceGrant{AccountId: user.Id, SourceId: 1, Role: RoleEditor})
+		assert.NoError(err)
+
+		grants, err := db.GetSourceGrants(user.Id)
+		assert.NoError(err)
+		assert.Len(grants, 2)
+		assert.Equal(RoleEditor, grants[0].Role)
+
+		err = db.RemoveSourceGrant(user.Id, 1)
+		assert.NoError(err)
+
+		grants, err = db.GetSourceGrants(user.Id)
+		assert.NoError(err)
+		assert.Len(grants, 1)
+
+		// grants are removed with the account
+		err = db.RemoveAccount(user.Id)
+		assert.NoError(err)
+
+		grants, err = db.GetSourceGrants(user.Id)
+		assert.NoError(err)
+		assert.Empty(grants)
+	})
+}
@@ -3,17 +3,20 @@ package store
 import (
 	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 )
 
 const (
-	JobQueued  = "QUEUED"
-	JobRunning = "RUNNING"
-	JobFailure = "FAILURE"
-	JobSuccess = "SUCCESS"
+	JobQueued    = "QUEUED"
+	JobRunning   = "RUNNING"
+	JobFailure   = "FAILURE"
+	JobSuccess   = "SUCCESS"
+	JobCancelled = "CANCELLED"
 
 	TriggerManual   = "MANUAL"
 	TriggerSchedule = "SCHEDULE"
+	TriggerRetry    = "RETRY"
 )
 
 type Job struct {
@@ -24,6 +27,13 @@ type Job struct {
 	EndTime   time.Time `json:"endTime"`
 	State     string    `json:"state"`
 	Trigger   string    `json:"trigger"`
+	// the attempt number of the job. Jobs which are retried after a failure will
+	// have an attempt number greater than 1
+	Attempt int `json:"attempt"`
+	// the id of the failed job which this job retries. 0 if this is not a retry
+	RetryOf int `json:"retryOf"`
+	// the scheduled date of the job which is passed to the tasks as the "task_date"
+	TaskDate time.Time `json:"taskDate"`
 }
 
 func (j *Job) ToStartState() error {
@@ -59,6 +69,31 @@ func (j *Job) ToSuccessState() error {
 	return nil
 }
 
+// Puts a running job back into the queue. This is used when the application restarts
+// while the job was running
+func (j *Job) ToRequeuedState() error {
+	if j.State != JobRunning {
+		return errors.Errorf("cannot requeue job from '%s' state", j.State)
+	}
+
+	j.StartTime = time.Time{}
+	j.State = JobQueued
+
+	return nil
+}
+
+// Cancels the job. Only jobs which are queued or running can be cancelled
+func (j *Job) ToCancelledState() error {
+	if j.State != JobQueued && j.State != JobRunning {
+		return errors.Errorf("cannot reach '%s' state from '%s' state", JobCancelled, j.State)
+	}
+
+	j.EndTime = time.Now()
+	j.State = JobCancelled
+
+	return nil
+}
+
 // Adds a new job
 func (p *Postgres) AddJob(sourceId int, trigger string) (*Job, error) {
 	if trigger != TriggerSchedule && trigger != TriggerManual {
@@ -72,6 +107,7 @@ func (p *Postgres) AddJob(sourceId int, trigger string) (*Job, error) {
 		EndTime:   time.Time{},
 		State:     JobQueued,
 		Trigger:   trigger,
+		Attempt:   1,
 	}
 
 	if err := p.db.Create(job).Error; err != nil {
@@ -81,16 +117,53 @@ func (p *Postgres) AddJob(sourceId int, trigger string) (*Job, error) {
 	return job, nil
 }
 
+// Adds a new job which retries the failed job
+func (p *Postgres) RetryJob(failed *Job) (*Job, error) {
+	if failed.State != JobFailure {
+		return nil, errors.Errorf("cannot retry job in '%s' state", failed.State)
+	}
+
+	job := &Job{
+		SourceId:  failed.SourceId,
+		InitTime:  time.Now(),
+		StartTime: time.Time{},
+		EndTime:   time.Time{},
+		State:     JobQueued,
+		Trigger:   TriggerRetry,
+		Attempt:   failed.Attempt + 1,
+		RetryOf:   failed.Id,
+		TaskDate:  failed.TaskDate,
+	}
+
+	if err := p.db.Create(job).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not create retry job for job %d", failed.Id)
+	}
+
+	return job, nil
+}
+
 // Updates the details of the job. Must have the id specified
 func (p *Postgres) UpdateJob(job *Job) (*Job, error) {
 	if job.Id == 0 {
 		return nil, errors.New("job id must be specified")
 	}
 
+	// updating with a struct skips the zero values, such as the start time of a job
+	// which is queued again
 	err := p.db.
 		Model(job).
 		Where("id = ?", job.Id).
-		Update(*job).
+		Updates(map[string]interface{}{
+			"source_id":  job.SourceId,
+			"init_time":  job.InitTime,
+			"start_time": job.StartTime,
+			"end_time":   job.EndTime,
+			"state":      job.State,
+			"trigger":    job.Trigger,
+			"attempt":    job.Attempt,
+			"retry_of":   job.RetryOf,
+			"task_date":  job.TaskDate,
+		}).
 		Error
 	if err != nil {
 		return nil, errors.Wrap(err, "could not update job")
@@ -109,7 +182,7 @@ func (p *Postgres) GetJob(id int) (*Job, error) {
 }
 
 // Gets a list of all jobs specified by the options. If options are not specified
-// returns all jobs
+// returns all jobs sorted by their id
 func (p *Postgres) GetJobs(options *ListJobOption) ([]*Job, error) {
 	var jobs []*Job
 
@@ -117,6 +190,53 @@ func (p *Postgres) GetJobs(options *ListJobOption) ([]*Job, error) {
 		options = &ListJobOption{}
 	}
 
+	order, err := options.order()
+	if err != nil {
+		return nil, err
+	}
+
+	query := p.filterJobs(options).Order(order)
+	if options.Offset > 0 {
+		query = query.Offset(options.Offset)
+	}
+	if options.Limit > 0 {
+		query = query.Limit(options.Limit)
+	}
+
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, errors.Wrap(err, "could not get jobs")
+	}
+
+	return jobs, nil
+}
+
+// Removes the jobs together with their step and task runs
+func (p *Postgres) RemoveJobs(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := p.db.Where("id IN (?)", ids).Delete(&Job{}).Error; err != nil {
+		return errors.Wrapf(err, "could not remove %d jobs", len(ids))
+	}
+	return nil
+}
+
+// Counts the jobs matching the options' filters. The limit, offset and sort order
+// are ignored
+func (p *Postgres) CountJobs(options *ListJobOption) (int, error) {
+	if options == nil {
+		options = &ListJobOption{}
+	}
+
+	var count int
+	if err := p.filterJobs(options).Model(&Job{}).Count(&count).Error; err != nil {
+		return 0, errors.Wrap(err, "could not count jobs")
+	}
+	return count, nil
+}
+
+func (p *Postgres) filterJobs(options *ListJobOption) *gorm.DB {
 	query := p.db
 	if len(options.State) > 0 {
 		query = query.Where("state IN (?)", options.State)
@@ -127,16 +247,66 @@ func (p *Postgres) GetJobs(options *ListJobOption) ([]*Job, error) {
 	if options.SourceId != 0 {
 		query = query.Where("source_id = ?", options.SourceId)
 	}
-
-	if err := query.Find(&jobs).Error; err != nil {
-		return nil, errors.Wrap(err, "could not get jobs")
+	if !options.Since.IsZero() {
+		query = query.Where("init_time >= ?", options.Since)
 	}
+	if !options.Until.IsZero() {
+		query = query.Where("init_time < ?", options.Until)
+	}
+	return query
+}
 
-	return jobs, nil
+const (
+	JobSortId        = "id"
+	JobSortInitTime  = "initTime"
+	JobSortStartTime = "startTime"
+	JobSortEndTime   = "endTime"
+)
+
+// Columns which jobs can be sorted by
+var jobSortColumns = map[string]string{
+	JobSortId:        "id",
+	JobSortInitTime:  "init_time",
+	JobSortStartTime: "start_time",
+	JobSortEndTime:   "end_time",
 }
 
 type ListJobOption struct {
 	Trigger  string
 	State    []string
 	SourceId int
+	// only jobs initialized at or after this time
+	Since time.Time
+	// only jobs initialized before this time
+	Until time.Time
+	// maximum number of jobs returned. 0 for no limit
+	Limit  int
+	Offset int
+	// field the jobs are sorted by. Defaults to the id
+	SortBy     string
+	Descending bool
+}
+
+// Gets the sql order clause. Ties are broken by the id so that pages are stable
+func (o *ListJobOption) order() (string, error) {
+	sortBy := o.SortBy
+	if sortBy == "" {
+		sortBy = JobSortId
+	}
+
+	column, exists := jobSortColumns[sortBy]
+	if !exists {
+		return "", errors.Errorf("cannot sort jobs by '%s'", o.SortBy)
+	}
+
+	direction := "ASC"
+	if o.Descending {
+		direction = "DESC"
+	}
+
+	order := column + " " + direction
+	if column != "id" {
+		order += ", id " + direction
+	}
+	return order, nil
 }
@@ -2,6 +2,7 @@ package store_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dhui/dktest"
 	"github.com/stretchr/testify/require"
@@ -77,6 +78,50 @@ func TestPostgres_GetJobs(t *testing.T) {
 		})
 		assert.NoError(err)
 		assert.Len(jobs, numJobs)
+
+		options := &ListJobOption{Limit: 1, Offset: 1, SortBy: JobSortId, Descending: true}
+		jobs, err = db.GetJobs(options)
+		assert.NoError(err)
+		assert.Len(jobs, 1)
+		assert.Equal(numJobs-1, jobs[0].Id)
+
+		count, err := db.CountJobs(options)
+		assert.NoError(err)
+		assert.Equal(numJobs, count)
+
+		jobs, err = db.GetJobs(&ListJobOption{Until: time.Now().Add(-time.Hour)})
+		assert.NoError(err)
+		assert.Empty(jobs)
+
+		jobs, err = db.GetJobs(&ListJobOption{SortBy: JobSortInitTime, Since: time.Now().Add(-time.Hour)})
+		assert.NoError(err)
+		assert.Len(jobs, numJobs)
+
+		_, err = db.GetJobs(&ListJobOption{SortBy: "name"})
+		assert.Error(err)
+	})
+}
+
+func TestPostgres_RemoveJobs(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	sources, _ := newSources()
+	numJobs := len(sources)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedJobs)
+		assert.NoError(err)
+
+		assert.NoError(db.RemoveJobs(nil))
+		assert.NoError(db.RemoveJobs([]int{1, 2}))
+
+		count, err := db.CountJobs(nil)
+		assert.NoError(err)
+		assert.Equal(numJobs-2, count)
+
+		_, err = db.GetJob(1)
+		assert.Error(err)
 	})
 }
 
@@ -122,9 +167,108 @@ func TestPostgres_UpdateJob(t *testing.T) {
 		job, err = db.UpdateJob(job)
 		assert.NoError(err)
 		assert.EqualValues(job.State, JobFailure)
+
+		// the start time of a job which is queued again is cleared
+		job, err = db.AddJob(jobs[0].SourceId, TriggerManual)
+		assert.NoError(err)
+		assert.NoError(job.ToStartState())
+		_, err = db.UpdateJob(job)
+		assert.NoError(err)
+		assert.NoError(job.ToRequeuedState())
+		_, err = db.UpdateJob(job)
+		assert.NoError(err)
+
+		job, err = db.GetJob(job.Id)
+		assert.NoError(err)
+		assert.Equal(JobQueued, job.State)
+		assert.True(job.StartTime.IsZero())
 	})
 }
 
+func TestPostgres_RetryJob(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedJobs)
+		assert.NoError(err)
+
+		job, err := db.GetJob(1)
+		assert.NoError(err)
+
+		// only failed jobs can be retried
+		_, err = db.RetryJob(job)
+		assert.Error(err)
+
+		assert.NoError(job.ToStartState())
+		assert.NoError(job.ToFailureState())
+		job, err = db.UpdateJob(job)
+		assert.NoError(err)
+
+		retry, err := db.RetryJob(job)
+		assert.NoError(err)
+		assert.Equal(job.SourceId, retry.SourceId)
+		assert.Equal(TriggerRetry, retry.Trigger)
+		assert.Equal(JobQueued, retry.State)
+		assert.Equal(job.Attempt+1, retry.Attempt)
+		assert.Equal(job.Id, retry.RetryOf)
+	})
+}
+
+func TestJob_ToCancelledState(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		State    string
+		HasError bool
+	}{
+		{JobQueued, false},
+		{JobRunning, false},
+		{JobSuccess, true},
+		{JobFailure, true},
+		{JobCancelled, true},
+	} {
+		job := &Job{State: test.State}
+		err := job.ToCancelledState()
+		if test.HasError {
+			assert.Error(err)
+			assert.Equal(test.State, job.State)
+		} else {
+			assert.NoError(err)
+			assert.Equal(JobCancelled, job.State)
+			assert.False(job.EndTime.IsZero())
+		}
+	}
+}
+
+func TestJob_ToRequeuedState(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		State    string
+		HasError bool
+	}{
+		{JobQueued, true},
+		{JobRunning, false},
+		{JobSuccess, true},
+		{JobFailure, true},
+		{JobCancelled, true},
+	} {
+		job := &Job{State: test.State}
+		err := job.ToRequeuedState()
+		if test.HasError {
+			assert.Error(err)
+			assert.Equal(test.State, job.State)
+		} else {
+			assert.NoError(err)
+			assert.Equal(JobQueued, job.State)
+			assert.True(job.StartTime.IsZero())
+		}
+	}
+}
+
 func seedJobs(db *Postgres) error {
 	sources, err := db.GetSources(nil)
 	if err != nil {
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Size in bytes of the master keys and data keys. Keys are used with AES-256-GCM
+const KeySize = 32
+
+// Keyring holds the master keys used for envelope encryption of secrets. Each secret
+// value is encrypted with its own random data key and the data key is encrypted with
+// the current master key. Older master keys are kept so that secrets encrypted with
+// them can still be decrypted until they are re-encrypted
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// Creates a keyring from the master keys given by their id. New secrets are encrypted
+// with the current key
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if current == "" {
+		return nil, errors.New("current master key id must be specified")
+	} else if _, exists := keys[current]; !exists {
+		return nil, errors.Errorf("master key '%s' does not exist", current)
+	}
+
+	k := &Keyring{current: current, keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, errors.Errorf("master key '%s' must be %d bytes long but has %d bytes", id, KeySize, len(key))
+		}
+		k.keys[id] = key
+	}
+
+	return k, nil
+}
+
+// Id of the master key used to encrypt new secrets
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Encrypts the plaintext with a new data key. Returns the ciphertext and the data key
+// encrypted with the current master key
+func (k *Keyring) Encrypt(plaintext string) (ciphertext, dataKey string, err error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", "", errors.Wrap(err, "could not generate data key")
+	}
+
+	ciphertext, err = seal(key, []byte(plaintext))
+	if err != nil {
+		return "", "", err
+	}
+
+	dataKey, err = seal(k.keys[k.current], key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return ciphertext, dataKey, nil
+}
+
+// Decrypts the ciphertext with the data key, which was encrypted by the master key
+// with the given id
+func (k *Keyring) Decrypt(keyId, ciphertext, dataKey string) (string, error) {
+	key, err := k.openDataKey(keyId, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(key, ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "could not decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+// Encrypts the data key, which was encrypted by the master key with the given id,
+// with the current master key. The value encrypted by the data key is unchanged
+func (k *Keyring) Rewrap(keyId, dataKey string) (string, error) {
+	key, err := k.openDataKey(keyId, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return seal(k.keys[k.current], key)
+}
+
+func (k *Keyring) openDataKey(keyId, dataKey string) ([]byte, error) {
+	master, exists := k.keys[keyId]
+	if !exists {
+		return nil, errors.Errorf("master key '%s' is not available", keyId)
+	}
+
+	key, err := open(master, dataKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decrypt data key with master key '%s'", keyId)
+	}
+	return key, nil
+}
+
+// Encrypts the plaintext with AES-GCM. The result is the base64 encoded nonce
+// followed by the ciphertext
+func seal(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "could not generate nonce")
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(key []byte, value string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid encrypted value")
+	} else if len(content) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	nonce, ciphertext := content[:gcm.NonceSize()], content[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create cipher")
+	}
+	return gcm, nil
+}
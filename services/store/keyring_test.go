@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func newKey(c string) []byte {
+	return []byte(strings.Repeat(c, KeySize))
+}
+
+func TestNewKeyring(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Current  string
+		Keys     map[string][]byte
+		HasError bool
+	}{
+		{"a", map[string][]byte{"a": newKey("a")}, false},
+		{"b", map[string][]byte{"a": newKey("a"), "b": newKey("b")}, false},
+		{"", map[string][]byte{"a": newKey("a")}, true},
+		{"b", map[string][]byte{"a": newKey("a")}, true},
+		{"a", map[string][]byte{"a": []byte("short")}, true},
+	} {
+		k, err := NewKeyring(test.Current, test.Keys)
+		if test.HasError {
+			assert.Error(err)
+			assert.Nil(k)
+		} else {
+			assert.NoError(err)
+			assert.Equal(test.Current, k.Current())
+		}
+	}
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	old, err := NewKeyring("old", map[string][]byte{"old": newKey("o")})
+	assert.NoError(err)
+
+	value, dataKey, err := old.Encrypt("password")
+	assert.NoError(err)
+	assert.NotContains(value, "password")
+
+	plaintext, err := old.Decrypt("old", value, dataKey)
+	assert.NoError(err)
+	assert.Equal("password", plaintext)
+
+	// the same value is encrypted differently every time
+	value2, dataKey2, err := old.Encrypt("password")
+	assert.NoError(err)
+	assert.NotEqual(value, value2)
+	assert.NotEqual(dataKey, dataKey2)
+
+	// rotating the master key only changes the data key
+	rotated, err := NewKeyring("new", map[string][]byte{"old": newKey("o"), "new": newKey("n")})
+	assert.NoError(err)
+
+	newDataKey, err := rotated.Rewrap("old", dataKey)
+	assert.NoError(err)
+
+	current, err := NewKeyring("new", map[string][]byte{"new": newKey("n")})
+	assert.NoError(err)
+
+	plaintext, err = current.Decrypt("new", value, newDataKey)
+	assert.NoError(err)
+	assert.Equal("password", plaintext)
+
+	// the previous key is no longer available
+	_, err = current.Decrypt("old", value, dataKey)
+	assert.Error(err)
+
+	// wrong master key
+	_, err = current.Decrypt("new", value, dataKey)
+	assert.Error(err)
+}
+
+func TestSource_SecretMap(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	keyring, err := NewKeyring("key", map[string][]byte{"key": newKey("k")})
+	assert.NoError(err)
+
+	value, dataKey, err := keyring.Encrypt("encrypted-value")
+	assert.NoError(err)
+
+	source := &Source{Secrets: []Secret{
+		{Key: "plain", Value: "plain-value"},
+		{Key: "encrypted", Value: value, KeyId: "key", DataKey: dataKey},
+	}}
+
+	secrets, err := source.SecretMap(keyring)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"plain": "plain-value", "encrypted": "encrypted-value"}, secrets)
+
+	_, err = source.SecretMap(nil)
+	assert.Error(err)
+
+	source.MaskSecrets()
+	for _, s := range source.Secrets {
+		assert.Equal(SecretMask, s.Value)
+	}
+}
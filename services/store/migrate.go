@@ -32,6 +32,18 @@ func (p *Postgres) Migrate() error {
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
 		return errors.Wrap(err, "could not apply migrations")
 	}
+
+	// passwords from before hashing was introduced can't be hashed in sql
+	if err := p.hashPlainPasswords(); err != nil {
+		return errors.Wrap(err, "could not hash account passwords")
+	}
+
+	// likewise for secrets saved before they were encrypted
+	if p.keyring != nil {
+		if _, err := p.reencryptSecrets(false); err != nil {
+			return errors.Wrap(err, "could not encrypt secrets")
+		}
+	}
 	return nil
 }
 
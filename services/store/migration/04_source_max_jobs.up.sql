@@ -0,0 +1,2 @@
+ALTER TABLE source
+    ADD COLUMN max_jobs INTEGER NOT NULL DEFAULT 0 CHECK ( max_jobs >= 0 );
@@ -0,0 +1,6 @@
+ALTER TABLE job
+    DROP COLUMN IF EXISTS retry_of,
+    DROP COLUMN IF EXISTS attempt;
+
+ALTER TABLE source
+    DROP COLUMN IF EXISTS retries;
@@ -0,0 +1,7 @@
+ALTER TABLE source
+    ADD COLUMN retries INTEGER NOT NULL DEFAULT 0 CHECK ( retries >= 0 );
+
+-- retry_of is 0 for jobs which are not retries of an earlier job
+ALTER TABLE job
+    ADD COLUMN attempt  INTEGER NOT NULL DEFAULT 1 CHECK ( attempt >= 1 ),
+    ADD COLUMN retry_of INTEGER NOT NULL DEFAULT 0;
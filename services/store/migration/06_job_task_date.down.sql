@@ -0,0 +1,2 @@
+ALTER TABLE job
+    DROP COLUMN IF EXISTS task_date;
@@ -0,0 +1,2 @@
+ALTER TABLE job
+    ADD COLUMN task_date TIMESTAMP;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_run;
+DROP TABLE IF EXISTS step_run;
@@ -0,0 +1,28 @@
+CREATE TABLE step_run
+(
+    id         SERIAL PRIMARY KEY,
+    job_id     INTEGER REFERENCES job (id) ON DELETE CASCADE,
+    name       VARCHAR(255) NOT NULL,
+    position   INTEGER      NOT NULL,
+    start_time TIMESTAMP    NOT NULL,
+    end_time   TIMESTAMP,
+    exit_code  INTEGER      NOT NULL DEFAULT 0,
+    branch     VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE task_run
+(
+    id          SERIAL PRIMARY KEY,
+    step_run_id INTEGER REFERENCES step_run (id) ON DELETE CASCADE,
+    job_id      INTEGER REFERENCES job (id) ON DELETE CASCADE,
+    name        VARCHAR(255)  NOT NULL,
+    container   VARCHAR(255)  NOT NULL,
+    image       VARCHAR(2000) NOT NULL,
+    start_time  TIMESTAMP     NOT NULL,
+    end_time    TIMESTAMP     NOT NULL,
+    exit_code   INTEGER       NOT NULL,
+    attempts    INTEGER       NOT NULL DEFAULT 1
+);
+
+CREATE INDEX step_run_job_id ON step_run (job_id);
+CREATE INDEX task_run_step_run_id ON task_run (step_run_id);
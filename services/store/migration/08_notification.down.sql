@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS notification_delivery;
+DROP TABLE IF EXISTS notification;
@@ -0,0 +1,23 @@
+CREATE TABLE notification
+(
+    id        SERIAL PRIMARY KEY,
+    source_id INTEGER REFERENCES source (id) ON DELETE CASCADE,
+    channel   VARCHAR(20)   NOT NULL,
+    target    VARCHAR(2000) NOT NULL,
+    secret    TEXT          NOT NULL DEFAULT '',
+    notify_on VARCHAR(20)   NOT NULL
+);
+
+CREATE TABLE notification_delivery
+(
+    id              SERIAL PRIMARY KEY,
+    notification_id INTEGER REFERENCES notification (id) ON DELETE CASCADE,
+    job_id          INTEGER REFERENCES job (id) ON DELETE CASCADE,
+    attempt         INTEGER   NOT NULL,
+    time            TIMESTAMP NOT NULL,
+    success         BOOLEAN   NOT NULL,
+    error           TEXT      NOT NULL DEFAULT ''
+);
+
+CREATE INDEX notification_source_id ON notification (source_id);
+CREATE INDEX notification_delivery_notification_id ON notification_delivery (notification_id);
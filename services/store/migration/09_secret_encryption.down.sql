@@ -0,0 +1,4 @@
+-- encrypted values can't be decrypted here and are left as they are
+ALTER TABLE secret
+    DROP COLUMN IF EXISTS key_id,
+    DROP COLUMN IF EXISTS data_key;
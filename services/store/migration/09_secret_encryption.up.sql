@@ -0,0 +1,3 @@
+ALTER TABLE secret
+    ADD COLUMN key_id   VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN data_key TEXT         NOT NULL DEFAULT '';
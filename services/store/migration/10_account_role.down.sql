@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS source_grant;
+
+ALTER TABLE account
+    DROP COLUMN IF EXISTS role;
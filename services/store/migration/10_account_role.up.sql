@@ -0,0 +1,15 @@
+ALTER TABLE account
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'viewer';
+
+-- existing accounts keep the access they had before roles were introduced
+UPDATE account
+SET role = CASE WHEN is_admin THEN 'admin' ELSE 'editor' END;
+
+CREATE TABLE source_grant
+(
+    id         SERIAL PRIMARY KEY,
+    account_id INTEGER REFERENCES account (id) ON DELETE CASCADE,
+    source_id  INTEGER REFERENCES source (id) ON DELETE CASCADE,
+    role       VARCHAR(20) NOT NULL,
+    UNIQUE (account_id, source_id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE audit_log
+(
+    id          SERIAL PRIMARY KEY,
+    actor       VARCHAR(255) NOT NULL,
+    action      VARCHAR(20)  NOT NULL,
+    target_type VARCHAR(20)  NOT NULL,
+    target_id   INTEGER      NOT NULL,
+    before      TEXT         NOT NULL DEFAULT 'null',
+    after       TEXT         NOT NULL DEFAULT 'null',
+    time        TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX audit_log_time ON audit_log (time);
+CREATE INDEX audit_log_target ON audit_log (target_type, target_id);
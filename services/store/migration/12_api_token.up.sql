@@ -0,0 +1,13 @@
+CREATE TABLE api_token
+(
+    id         SERIAL PRIMARY KEY,
+    account_id INTEGER REFERENCES account (id) ON DELETE CASCADE,
+    name       VARCHAR(255) NOT NULL,
+    hash       CHAR(64)     NOT NULL UNIQUE,
+    scopes     VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP    NOT NULL,
+    last_used  TIMESTAMP,
+    created_at TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX api_token_account_id ON api_token (account_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS job_init_time;
+DROP INDEX IF EXISTS job_state;
+DROP INDEX IF EXISTS job_source_id_init_time;
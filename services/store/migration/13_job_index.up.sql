@@ -0,0 +1,3 @@
+CREATE INDEX job_source_id_init_time ON job (source_id, init_time);
+CREATE INDEX job_state ON job (state);
+CREATE INDEX job_init_time ON job (init_time);
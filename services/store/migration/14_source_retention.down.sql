@@ -0,0 +1,3 @@
+ALTER TABLE source
+    DROP COLUMN IF EXISTS keep_jobs,
+    DROP COLUMN IF EXISTS keep_days;
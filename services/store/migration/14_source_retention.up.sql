@@ -0,0 +1,4 @@
+-- 0 uses the application's retention policy
+ALTER TABLE source
+    ADD COLUMN keep_jobs INTEGER NOT NULL DEFAULT 0 CHECK ( keep_jobs >= 0 ),
+    ADD COLUMN keep_days INTEGER NOT NULL DEFAULT 0 CHECK ( keep_days >= 0 );
@@ -0,0 +1,2 @@
+ALTER TABLE task_run
+    DROP COLUMN IF EXISTS oom_killed;
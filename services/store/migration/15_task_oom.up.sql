@@ -0,0 +1,3 @@
+-- set when the container was killed as it ran out of memory
+ALTER TABLE task_run
+    ADD COLUMN oom_killed BOOLEAN NOT NULL DEFAULT FALSE;
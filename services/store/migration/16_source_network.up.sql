@@ -0,0 +1,3 @@
+-- empty uses the network mode of the runtime config
+ALTER TABLE source
+    ADD COLUMN network VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE source
+    DROP COLUMN IF EXISTS security;
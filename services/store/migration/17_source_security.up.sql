@@ -0,0 +1,3 @@
+-- json of the container hardening settings which override the application's
+ALTER TABLE source
+    ADD COLUMN security TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- the removed viewer grants gave no access, so there is nothing to restore
+SELECT 1;
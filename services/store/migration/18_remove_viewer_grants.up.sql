@@ -0,0 +1,4 @@
+-- every account can view every source, so viewer grants never gave any access
+DELETE
+FROM source_grant
+WHERE role = 'viewer';
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"nidavellir/libs"
+)
+
+const (
+	// Posts the job details as json to the target url. The body is signed with the secret
+	ChannelWebhook = "WEBHOOK"
+	// Emails the job details to the comma separated list of addresses in the target
+	ChannelEmail = "EMAIL"
+	// Posts a Slack-compatible message to the target incoming webhook url
+	ChannelSlack = "SLACK"
+
+	// Notifies only when the job fails
+	NotifyOnFailure = "FAILURE"
+	// Notifies whenever a job ends
+	NotifyAlways = "ALWAYS"
+	// Notifies when the job fails and when the job succeeds after the previous job failed
+	NotifyOnRecovery = "RECOVERY"
+)
+
+// A channel which is notified when the source's jobs end
+type Notification struct {
+	Id       int    `json:"id"`
+	SourceId int    `json:"sourceId"`
+	Channel  string `json:"channel"`
+	// the webhook url or the email addresses which are notified
+	Target string `json:"target"`
+	// key used to sign webhook notifications
+	Secret   string `json:"secret,omitempty"`
+	NotifyOn string `json:"notifyOn"`
+}
+
+// Record of an attempt to send a notification
+type NotificationDelivery struct {
+	Id             int       `json:"id"`
+	NotificationId int       `json:"notificationId"`
+	JobId          int       `json:"jobId"`
+	Attempt        int       `json:"attempt"`
+	Time           time.Time `json:"time"`
+	Success        bool      `json:"success"`
+	Error          string    `json:"error"`
+}
+
+func (n *Notification) Validate() error {
+	n.Channel = strings.ToUpper(strings.TrimSpace(n.Channel))
+	n.NotifyOn = strings.ToUpper(strings.TrimSpace(n.NotifyOn))
+	n.Target = strings.TrimSpace(n.Target)
+
+	if n.NotifyOn == "" {
+		n.NotifyOn = NotifyOnFailure
+	} else if !libs.IsIn(n.NotifyOn, []string{NotifyOnFailure, NotifyAlways, NotifyOnRecovery}) {
+		return errors.Errorf("'%s' is not a valid notification rule", n.NotifyOn)
+	}
+
+	switch n.Channel {
+	case ChannelWebhook, ChannelSlack:
+		u, err := url.Parse(n.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("expected '%s' to be a http url", n.Target)
+		}
+	case ChannelEmail:
+		if _, err := mail.ParseAddressList(n.Target); err != nil {
+			return errors.Wrapf(err, "'%s' is not a valid list of email addresses", n.Target)
+		}
+	default:
+		return errors.Errorf("'%s' is not a valid notification channel", n.Channel)
+	}
+
+	return nil
+}
+
+// Adds a notification channel to a source
+func (p *Postgres) AddNotification(notification *Notification) (*Notification, error) {
+	notification.Id = 0
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := p.db.Create(notification).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not create notification for source id %d", notification.SourceId)
+	}
+
+	return notification, nil
+}
+
+// Gets a notification by its id
+func (p *Postgres) GetNotification(id int) (*Notification, error) {
+	var n Notification
+	if err := p.db.First(&n, "id = ?", id).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not get notification with id: %d", id)
+	}
+	return &n, nil
+}
+
+// Gets all notifications of the source
+func (p *Postgres) GetNotifications(sourceId int) ([]*Notification, error) {
+	var n []*Notification
+	if err := p.db.Order("id").Find(&n, "source_id = ?", sourceId).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not get notifications of source id: %d", sourceId)
+	}
+	return n, nil
+}
+
+// Updates the notification. Must have the id specified
+func (p *Postgres) UpdateNotification(notification *Notification) (*Notification, error) {
+	if notification.Id == 0 {
+		return nil, errors.New("updated notification's id not specified")
+	}
+
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+
+	// a map is used so that the secret can be cleared
+	err := p.db.
+		Model(notification).
+		Where("id = ?", notification.Id).
+		Updates(map[string]interface{}{
+			"channel":   notification.Channel,
+			"target":    notification.Target,
+			"secret":    notification.Secret,
+			"notify_on": notification.NotifyOn,
+		}).
+		Error
+	if err != nil {
+		return nil, errors.Wrap(err, "could not update notification")
+	}
+
+	return notification, nil
+}
+
+// Removes the notification together with its delivery records
+func (p *Postgres) RemoveNotification(id int) error {
+	n, err := p.GetNotification(id)
+	if err != nil {
+		return err
+	}
+
+	if err := p.db.Delete(n).Error; err != nil {
+		return errors.Wrap(err, "could not remove notification")
+	}
+
+	return nil
+}
+
+// Records an attempt to send a notification
+func (p *Postgres) AddNotificationDelivery(delivery *NotificationDelivery) (*NotificationDelivery, error) {
+	delivery.Id = 0
+	if err := p.db.Create(delivery).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not record delivery of notification %d", delivery.NotificationId)
+	}
+	return delivery, nil
+}
+
+// Gets the delivery records of the notification, latest first
+func (p *Postgres) GetNotificationDeliveries(notificationId int) ([]*NotificationDelivery, error) {
+	var d []*NotificationDelivery
+	err := p.db.
+		Order("time DESC, id DESC").
+		Find(&d, "notification_id = ?", notificationId).
+		Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get deliveries of notification %d", notificationId)
+	}
+	return d, nil
+}
+
+// Gets the source's last job which ended before the given job. Returns nil if there
+// is no such job
+func (p *Postgres) GetPreviousJob(job *Job) (*Job, error) {
+	var prev Job
+	err := p.db.
+		Where("source_id = ? AND id < ? AND state IN (?)", job.SourceId, job.Id, []string{JobSuccess, JobFailure}).
+		Order("id DESC").
+		First(&prev).
+		Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "could not get job before job %d", job.Id)
+	}
+	return &prev, nil
+}
@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dhui/dktest"
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestNotification_Validate(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Notification Notification
+		NotifyOn     string
+		HasError     bool
+	}{
+		{Notification{Channel: "webhook", Target: "https://example.com/hook"}, NotifyOnFailure, false},
+		{Notification{Channel: "slack", Target: "https://hooks.slack.com/x", NotifyOn: "recovery"}, NotifyOnRecovery, false},
+		{Notification{Channel: "email", Target: "a@example.com, B <b@example.com>", NotifyOn: "always"}, NotifyAlways, false},
+		{Notification{Channel: "webhook", Target: "example.com/hook"}, "", true},
+		{Notification{Channel: "email", Target: "not an email"}, "", true},
+		{Notification{Channel: "pager", Target: "https://example.com"}, "", true},
+		{Notification{Channel: "webhook", Target: "https://example.com", NotifyOn: "never"}, "", true},
+	} {
+		n := test.Notification
+		err := n.Validate()
+		if test.HasError {
+			assert.Error(err)
+		} else {
+			assert.NoError(err)
+			assert.Equal(test.NotifyOn, n.NotifyOn)
+		}
+	}
+}
+
+func TestPostgres_Notifications(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedJobs)
+		assert.NoError(err)
+
+		n, err := db.AddNotification(&Notification{
+			SourceId: 1,
+			Channel:  ChannelWebhook,
+			Target:   "https://example.com/hook",
+			Secret:   "secret",
+		})
+		assert.NoError(err)
+		assert.Equal(NotifyOnFailure, n.NotifyOn)
+
+		_, err = db.AddNotification(&Notification{SourceId: 1, Channel: ChannelEmail, Target: "team@example.com"})
+		assert.NoError(err)
+
+		notifications, err := db.GetNotifications(1)
+		assert.NoError(err)
+		assert.Len(notifications, 2)
+
+		n.Secret = ""
+		n.NotifyOn = NotifyAlways
+		_, err = db.UpdateNotification(n)
+		assert.NoError(err)
+
+		n, err = db.GetNotification(n.Id)
+		assert.NoError(err)
+		assert.Empty(n.Secret)
+		assert.Equal(NotifyAlways, n.NotifyOn)
+
+		for i := 1; i <= 2; i++ {
+			_, err := db.AddNotificationDelivery(&NotificationDelivery{
+				NotificationId: n.Id,
+				JobId:          1,
+				Attempt:        i,
+				Time:           time.Now(),
+				Success:        i == 2,
+			})
+			assert.NoError(err)
+		}
+
+		deliveries, err := db.GetNotificationDeliveries(n.Id)
+		assert.NoError(err)
+		assert.Len(deliveries, 2)
+		assert.True(deliveries[0].Success)
+
+		err = db.RemoveNotification(n.Id)
+		assert.NoError(err)
+
+		deliveries, err = db.GetNotificationDeliveries(n.Id)
+		assert.NoError(err)
+		assert.Empty(deliveries)
+	})
+}
@@ -12,6 +12,8 @@ import (
 
 type Postgres struct {
 	db *gorm.DB
+	// encrypts source secrets
+	keyring *Keyring
 }
 
 type DbOption struct {
@@ -51,3 +53,13 @@ func New(option *DbOption) (*Postgres, error) {
 
 	return nil, errors.Errorf("could not connect to database with '%s'", option.ConnectionString(true))
 }
+
+// Sets the keyring used to encrypt source secrets
+func (p *Postgres) SetKeyring(keyring *Keyring) {
+	p.keyring = keyring
+}
+
+// Gets the keyring used to encrypt source secrets
+func (p *Postgres) Keyring() *Keyring {
+	return p.keyring
+}
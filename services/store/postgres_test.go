@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dhui/dktest"
@@ -72,6 +73,12 @@ func newTestDb(c dktest.ContainerInfo, seedFns ...func(p *Postgres) error) (*Pos
 		return nil, errors.Wrap(err, "could not create test postgres db")
 	}
 
+	keyring, err := NewKeyring("test", map[string][]byte{"test": []byte(strings.Repeat("k", KeySize))})
+	if err != nil {
+		return nil, err
+	}
+	store.SetKeyring(keyring)
+
 	if err = store.Migrate(); err != nil {
 		return nil, err
 	}
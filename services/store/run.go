@@ -0,0 +1,110 @@
+package store
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Execution record of a step in a job
+type StepRun struct {
+	Id    int    `json:"id"`
+	JobId int    `json:"jobId"`
+	Name  string `json:"name"`
+	// position of the step in the runtime config
+	Position  int       `json:"position"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// the largest exit code of all tasks in the step
+	ExitCode int `json:"exitCode"`
+	// name of the next step taken after this step. Empty if the job ended after this step
+	Branch string    `json:"branch"`
+	Tasks  []TaskRun `json:"tasks"`
+}
+
+// Execution record of a task in a step
+type TaskRun struct {
+	Id        int       `json:"id"`
+	StepRunId int       `json:"stepRunId"`
+	JobId     int       `json:"jobId"`
+	Name      string    `json:"name"`
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	ExitCode  int       `json:"exitCode"`
+	// true when the task's container was killed as it ran out of memory
+	OOMKilled bool `json:"oomKilled"`
+	// number of times the task was run
+	Attempts int `json:"attempts"`
+}
+
+// Adds a new step execution record. This should be called when the step starts
+func (p *Postgres) AddStepRun(run *StepRun) (*StepRun, error) {
+	if run.JobId == 0 {
+		return nil, errors.New("job id must be specified")
+	}
+
+	if err := p.db.Create(run).Error; err != nil {
+		return nil, errors.Wrap(err, "could not create step run")
+	}
+
+	return run, nil
+}
+
+// Records the end time, exit code and branch of the step execution record
+func (p *Postgres) UpdateStepRun(run *StepRun) (*StepRun, error) {
+	if run.Id == 0 {
+		return nil, errors.New("step run id must be specified")
+	}
+
+	// a map is used so that zero values such as an exit code of 0 are saved
+	err := p.db.
+		Model(run).
+		Where("id = ?", run.Id).
+		Updates(map[string]interface{}{
+			"end_time":  run.EndTime,
+			"exit_code": run.ExitCode,
+			"branch":    run.Branch,
+		}).
+		Error
+	if err != nil {
+		return nil, errors.Wrap(err, "could not update step run")
+	}
+
+	return run, nil
+}
+
+// Adds a new task execution record. This should be called when the task completes
+func (p *Postgres) AddTaskRun(run *TaskRun) (*TaskRun, error) {
+	if run.StepRunId == 0 {
+		return nil, errors.New("step run id must be specified")
+	}
+
+	if err := p.db.Create(run).Error; err != nil {
+		return nil, errors.Wrap(err, "could not create task run")
+	}
+
+	return run, nil
+}
+
+// Gets the execution records of all steps in the job together with their tasks,
+// ordered by their start time
+func (p *Postgres) GetStepRuns(jobId int) ([]*StepRun, error) {
+	var runs []*StepRun
+
+	err := p.db.
+		Preload("Tasks", func(db *gorm.DB) *gorm.DB {
+			return db.Order("start_time, id")
+		}).
+		Where("job_id = ?", jobId).
+		Order("start_time, id").
+		Find(&runs).
+		Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get step runs of job '%d'", jobId)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dhui/dktest"
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestPostgres_StepRuns(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedJobs)
+		assert.NoError(err)
+
+		_, err = db.AddStepRun(&StepRun{Name: "no job"})
+		assert.Error(err)
+
+		start := time.Now()
+		for i, name := range []string{"Extraction", "Transformation"} {
+			step, err := db.AddStepRun(&StepRun{JobId: 1, Name: name, Position: i, StartTime: start})
+			assert.NoError(err)
+
+			for _, task := range []string{"Task A", "Task B"} {
+				_, err := db.AddTaskRun(&TaskRun{
+					StepRunId: step.Id,
+					JobId:     1,
+					Name:      task,
+					Container: "container",
+					Image:     "image",
+					StartTime: start,
+					EndTime:   start.Add(time.Minute),
+					ExitCode:  i,
+					OOMKilled: task == "Task B",
+					Attempts:  1,
+				})
+				assert.NoError(err)
+			}
+
+			step.EndTime = start.Add(time.Minute)
+			step.ExitCode = i
+			step.Branch = "Transformation"
+			_, err = db.UpdateStepRun(step)
+			assert.NoError(err)
+
+			start = start.Add(time.Minute)
+		}
+
+		_, err = db.AddTaskRun(&TaskRun{Name: "no step"})
+		assert.Error(err)
+
+		runs, err := db.GetStepRuns(1)
+		assert.NoError(err)
+		assert.Len(runs, 2)
+		assert.Equal("Extraction", runs[0].Name)
+		assert.Equal("Transformation", runs[0].Branch)
+		assert.Len(runs[0].Tasks, 2)
+		assert.True(runs[0].Tasks[1].OOMKilled)
+		assert.Equal(1, runs[1].ExitCode)
+
+		runs, err = db.GetStepRuns(2)
+		assert.NoError(err)
+		assert.Empty(runs)
+	})
+}
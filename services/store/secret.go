@@ -6,11 +6,21 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Shown in place of secret values returned by the api
+const SecretMask = "********"
+
 type Secret struct {
 	Id       int    `json:"id"`
 	SourceId int    `json:"sourceId"`
 	Key      string `json:"key"`
-	Value    string `json:"value"`
+	// the value is given in plain text but is saved encrypted. It is only decrypted
+	// by Source.SecretMap when a job is built
+	Value string `json:"value"`
+	// id of the master key which encrypted the data key. Empty if the value was saved
+	// before secrets were encrypted
+	KeyId string `json:"-"`
+	// key which encrypted the value, itself encrypted by the master key
+	DataKey string `json:"-"`
 }
 
 func NewSecret(sourceId int, key, value string) (*Secret, error) {
@@ -44,6 +54,44 @@ func (s *Secret) Validate() error {
 	return nil
 }
 
+// Hides the secret's value
+func (s *Secret) Mask() *Secret {
+	s.Value = SecretMask
+	return s
+}
+
+// Gets the plain text value of the secret
+func (s *Secret) decrypt(keyring *Keyring) (string, error) {
+	if s.KeyId == "" {
+		return s.Value, nil
+	} else if keyring == nil {
+		return "", errors.Errorf("no keyring to decrypt secret '%s'", s.Key)
+	}
+
+	value, err := keyring.Decrypt(s.KeyId, s.Value, s.DataKey)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not decrypt secret '%s'", s.Key)
+	}
+	return value, nil
+}
+
+// Encrypts the secret's plain text value
+func (p *Postgres) encryptSecret(secret *Secret) error {
+	if p.keyring == nil {
+		return errors.New("no keyring to encrypt secrets with")
+	}
+
+	value, dataKey, err := p.keyring.Encrypt(secret.Value)
+	if err != nil {
+		return errors.Wrapf(err, "could not encrypt secret '%s'", secret.Key)
+	}
+
+	secret.Value = value
+	secret.DataKey = dataKey
+	secret.KeyId = p.keyring.Current()
+	return nil
+}
+
 // Adds a secret
 func (p *Postgres) AddSecret(secret *Secret) (*Secret, error) {
 	secret.Id = 0
@@ -51,6 +99,10 @@ func (p *Postgres) AddSecret(secret *Secret) (*Secret, error) {
 		return nil, err
 	}
 
+	if err := p.encryptSecret(secret); err != nil {
+		return nil, err
+	}
+
 	if err := p.db.Create(secret).Error; err != nil {
 		return nil, errors.Wrapf(err, "could not create secret for source id %d", secret.SourceId)
 	}
@@ -76,7 +128,8 @@ func (p *Postgres) GetSecrets(sourceId int) ([]*Secret, error) {
 	return s, nil
 }
 
-// Updates a secret's key value. The sourceId and key will uniquely identify the secret
+// Updates a secret's key value. The sourceId and key will uniquely identify the secret.
+// The value must be given in plain text
 func (p *Postgres) UpdateSecret(secret *Secret) (*Secret, error) {
 	if secret.Id == 0 {
 		return nil, errors.New("updated secret's id not specified")
@@ -86,6 +139,10 @@ func (p *Postgres) UpdateSecret(secret *Secret) (*Secret, error) {
 		return nil, err
 	}
 
+	if err := p.encryptSecret(secret); err != nil {
+		return nil, err
+	}
+
 	err := p.db.
 		Model(secret).
 		Where("id = ?", secret.Id).
@@ -111,3 +168,59 @@ func (p *Postgres) RemoveSecret(id int) error {
 
 	return nil
 }
+
+// Encrypts secrets which were saved in plain text. If rotate is true, the data keys of
+// secrets which were not encrypted with the current master key are encrypted with it.
+// Returns the number of secrets which were changed
+func (p *Postgres) reencryptSecrets(rotate bool) (int, error) {
+	if p.keyring == nil {
+		return 0, errors.New("no keyring to encrypt secrets with")
+	}
+
+	var secrets []*Secret
+	if err := p.db.Find(&secrets).Error; err != nil {
+		return 0, errors.Wrap(err, "could not get secrets")
+	}
+
+	count := 0
+	for _, secret := range secrets {
+		switch {
+		case secret.KeyId == "":
+			if err := p.encryptSecret(secret); err != nil {
+				return count, err
+			}
+		case rotate && secret.KeyId != p.keyring.Current():
+			dataKey, err := p.keyring.Rewrap(secret.KeyId, secret.DataKey)
+			if err != nil {
+				return count, errors.Wrapf(err, "could not re-encrypt secret '%s' of source id %d", secret.Key, secret.SourceId)
+			}
+			secret.DataKey = dataKey
+			secret.KeyId = p.keyring.Current()
+		default:
+			continue
+		}
+
+		err := p.db.
+			Model(secret).
+			Where("id = ?", secret.Id).
+			Updates(map[string]interface{}{
+				"value":    secret.Value,
+				"key_id":   secret.KeyId,
+				"data_key": secret.DataKey,
+			}).
+			Error
+		if err != nil {
+			return count, errors.Wrapf(err, "could not save re-encrypted secret '%s' of source id %d", secret.Key, secret.SourceId)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Encrypts every secret's data key with the current master key, and any secret saved
+// in plain text. Used after the master key is rotated so that the previous master key
+// can be retired. Returns the number of secrets which were re-encrypted
+func (p *Postgres) ReencryptSecrets() (int, error) {
+	return p.reencryptSecrets(true)
+}
@@ -1,6 +1,7 @@
 package store_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/dhui/dktest"
@@ -81,6 +82,58 @@ func TestPostgres_UpdateSecret(t *testing.T) {
 		s2, err := db.GetSecret(1)
 		assert.NoError(err)
 		assert.EqualValues(s2.Value, s.Value)
+
+		source, err := db.GetSource(1)
+		assert.NoError(err)
+		secrets, err := source.SecretMap(db.Keyring())
+		assert.NoError(err)
+		assert.Equal("ABC123", secrets[s.Key])
+	})
+}
+
+func TestPostgres_SecretsEncrypted(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources, seedSecrets)
+		assert.NoError(err)
+
+		s, err := db.GetSecret(1)
+		assert.NoError(err)
+		assert.NotEqual("value", s.Value)
+
+		source, err := db.GetSource(1)
+		assert.NoError(err)
+		secrets, err := source.SecretMap(db.Keyring())
+		assert.NoError(err)
+		assert.Equal("value", secrets["key"])
+
+		// rotate the master key and re-encrypt
+		rotated, err := NewKeyring("rotated", map[string][]byte{
+			db.Keyring().Current(): []byte(strings.Repeat("k", KeySize)),
+			"rotated":              []byte(strings.Repeat("r", KeySize)),
+		})
+		assert.NoError(err)
+		db.SetKeyring(rotated)
+
+		count, err := db.ReencryptSecrets()
+		assert.NoError(err)
+		assert.True(count > 0)
+
+		count, err = db.ReencryptSecrets()
+		assert.NoError(err)
+		assert.Equal(0, count)
+
+		// the previous master key is no longer needed
+		current, err := NewKeyring("rotated", map[string][]byte{"rotated": []byte(strings.Repeat("r", KeySize))})
+		assert.NoError(err)
+
+		source, err = db.GetSource(1)
+		assert.NoError(err)
+		secrets, err = source.SecretMap(current)
+		assert.NoError(err)
+		assert.Equal("value", secrets["key"])
 	})
 }
 
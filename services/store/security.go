@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/services/docker/dkspec"
+)
+
+// Hardening of the containers of the source's jobs on top of the application's
+// run.security settings, which the source can only tighten. Flags which are true turn
+// the setting on, the capabilities in CapDrop are dropped besides the application's and
+// the user, which can not be root or in the root group, replaces the application's
+// user. SourceSecurity is saved as json
+type SourceSecurity struct {
+	// user and optionally the group the tasks run as, such as "1000:1000"
+	User            string   `json:"user"`
+	ReadOnlyRepo    *bool    `json:"readOnlyRepo"`
+	ReadOnlyRootfs  *bool    `json:"readOnlyRootfs"`
+	CapDrop         []string `json:"capDrop"`
+	NoNewPrivileges *bool    `json:"noNewPrivileges"`
+}
+
+func (s *SourceSecurity) Validate() error {
+	s.User = strings.TrimSpace(s.User)
+	for i, c := range s.CapDrop {
+		s.CapDrop[i] = strings.ToUpper(strings.TrimSpace(c))
+	}
+
+	if s.User != "" {
+		if err := dkspec.ValidateUser(s.User); err != nil {
+			return errors.Wrap(err, "invalid security settings")
+		}
+	}
+	for _, c := range s.CapDrop {
+		if err := dkspec.ValidateCapability(c); err != nil {
+			return errors.Wrap(err, "invalid security settings")
+		}
+	}
+	if s.User != "" && dkspec.IsRootUser(s.User) {
+		return errors.New("invalid security settings: tasks of a source can not run as root or in the root group")
+	}
+	return nil
+}
+
+func (s SourceSecurity) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (s *SourceSecurity) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+	default:
+		return errors.Errorf("could not convert %T to security settings", value)
+	}
+
+	*s = SourceSecurity{}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, s)
+}
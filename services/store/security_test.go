@@ -0,0 +1,42 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestSourceSecurity(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	readOnly := true
+	sec := SourceSecurity{User: " 1000:1000 ", ReadOnlyRepo: &readOnly, CapDrop: []string{" all"}}
+	assert.NoError(sec.Validate())
+	assert.Equal("1000:1000", sec.User)
+	assert.Equal([]string{"ALL"}, sec.CapDrop)
+
+	value, err := sec.Value()
+	assert.NoError(err)
+
+	var saved SourceSecurity
+	assert.NoError(saved.Scan(value))
+	assert.Equal(sec, saved)
+
+	saved = SourceSecurity{CapDrop: []string{}}
+	value, err = saved.Value()
+	assert.NoError(err)
+	assert.NoError(saved.Scan([]byte(value.(string))))
+	assert.Nil(saved.ReadOnlyRootfs)
+
+	// sources saved before the settings existed have no settings
+	assert.NoError(saved.Scan(""))
+	assert.Equal(SourceSecurity{}, saved)
+
+	for _, user := range []string{"root user", "root", "0", "0:1000", "00:0", "1000:0", "1000:root"} {
+		sec = SourceSecurity{User: user}
+		assert.Error(sec.Validate(), user)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"nidavellir/libs"
+	"nidavellir/services/docker/dkspec"
 )
 
 const (
@@ -26,6 +27,20 @@ type Source struct {
 	NextTime   time.Time `json:"nextTime"`
 	Secrets    []Secret  `json:"secrets"`
 	CronExpr   string    `json:"cronExpr"`
+	// maximum number of jobs from this source that can run concurrently. 0 means that
+	// the source is only limited by the application's max-jobs setting
+	MaxJobs int `json:"maxJobs"`
+	// number of times a failed job is retried
+	Retries int `json:"retries"`
+	// number of most recent ended jobs kept and number of days they are kept for. 0
+	// uses the application's retention policy
+	KeepJobs int `json:"keepJobs"`
+	KeepDays int `json:"keepDays"`
+	// network mode of the job containers, which overrides the mode in the runtime config.
+	// Besides the modes in dkspec, this can be the name of an existing network
+	Network string `json:"network"`
+	// container hardening of the jobs, which tightens the application's settings
+	Security SourceSecurity `json:"security"`
 }
 
 func NewSource(name, repoUrl string, startTime time.Time, secrets []Secret, cronExpr string) (*Source, error) {
@@ -63,6 +78,28 @@ func (s *Source) Validate() error {
 		return errors.Errorf("'%s' is an invalid schedule state", s.State)
 	}
 
+	if s.MaxJobs < 0 {
+		return errors.New("max jobs cannot be negative")
+	}
+
+	if s.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+
+	if s.KeepJobs < 0 || s.KeepDays < 0 {
+		return errors.New("retention policy cannot be negative")
+	}
+
+	network, err := dkspec.Validate(s.Network, true)
+	if err != nil {
+		return err
+	}
+	s.Network = network
+
+	if err := s.Security.Validate(); err != nil {
+		return err
+	}
+
 	cron, err := cronexpr.Parse(s.CronExpr)
 	if err != nil {
 		return errors.Wrapf(err, "malformed cron expression: %s", s.CronExpr)
@@ -82,16 +119,26 @@ func (s *Source) Validate() error {
 	return nil
 }
 
+// sets the source state to Queued
+func (s *Source) ToQueued() *Source {
+	s.State = ScheduleQueued
+	return s
+}
+
 // sets the source state to Running
 func (s *Source) ToRunning() *Source {
 	s.State = ScheduleRunning
 	return s
 }
 
-// Sets the job's state to completed and calculates the next runtime
+// Sets the job's state to completed and calculates the next runtime. The next runtime
+// is left alone if it is already in the future, which is the case when a manual or retried
+// job completes after the scheduled job
 func (s *Source) ToCompleted() *Source {
-	expr := cronexpr.MustParse(s.CronExpr)
-	s.NextTime = expr.Next(s.NextTime)
+	if !s.NextTime.After(time.Now()) {
+		expr := cronexpr.MustParse(s.CronExpr)
+		s.NextTime = expr.Next(s.NextTime)
+	}
 	s.State = ScheduleNoop
 	return s
 }
@@ -104,6 +151,12 @@ func (p *Postgres) AddSource(source *Source) (*Source, error) {
 		return nil, err
 	}
 
+	for i := range source.Secrets {
+		if err := p.encryptSecret(&source.Secrets[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := p.db.Create(source).Error; err != nil {
 		return nil, errors.Wrap(err, "could not create new source")
 	}
@@ -153,7 +206,8 @@ func (p *Postgres) GetSources(options *GetSourceOption) ([]*Source, error) {
 	return sources, nil
 }
 
-// Updates a job source
+// Updates a job source. The source's secrets are not saved as they are updated through
+// UpdateSecret. Every other field is saved, including those set back to their zero value
 func (p *Postgres) UpdateSource(source *Source) (*Source, error) {
 	if err := source.Validate(); err != nil {
 		return nil, err
@@ -161,10 +215,25 @@ func (p *Postgres) UpdateSource(source *Source) (*Source, error) {
 		return nil, errors.New("source id must be specified")
 	}
 
+	// updating with a struct skips the zero values, such as a MaxJobs set back to 0
 	err := p.db.
+		Set("gorm:save_associations", false).
 		Model(source).
 		Where("id = ?", source.Id).
-		Update(*source).
+		Updates(map[string]interface{}{
+			"name":        source.Name,
+			"unique_name": source.UniqueName,
+			"repo_url":    source.RepoUrl,
+			"state":       source.State,
+			"next_time":   source.NextTime,
+			"cron_expr":   source.CronExpr,
+			"max_jobs":    source.MaxJobs,
+			"retries":     source.Retries,
+			"keep_jobs":   source.KeepJobs,
+			"keep_days":   source.KeepDays,
+			"network":     source.Network,
+			"security":    source.Security,
+		}).
 		Error
 	if err != nil {
 		return nil, errors.Wrap(err, "could not update source")
@@ -173,6 +242,28 @@ func (p *Postgres) UpdateSource(source *Source) (*Source, error) {
 	return source, nil
 }
 
+// Saves the source's schedule state and next runtime only, so that the scheduler does not
+// revert changes made to the source's settings while its jobs ran
+func (p *Postgres) UpdateSourceState(source *Source) (*Source, error) {
+	if source.Id <= 0 {
+		return nil, errors.New("source id must be specified")
+	}
+
+	err := p.db.
+		Model(&Source{}).
+		Where("id = ?", source.Id).
+		Updates(map[string]interface{}{
+			"state":     source.State,
+			"next_time": source.NextTime,
+		}).
+		Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not update state of source %d", source.Id)
+	}
+
+	return source, nil
+}
+
 // Removes a job source
 func (p *Postgres) RemoveSource(id int) error {
 	if id <= 0 {
@@ -190,12 +281,26 @@ func (p *Postgres) RemoveSource(id int) error {
 	return nil
 }
 
-func (s *Source) SecretMap() map[string]string {
+// Gets the decrypted secrets of the source by their key. This is only meant to be used
+// when the environment of a job is built
+func (s *Source) SecretMap(keyring *Keyring) (map[string]string, error) {
 	secrets := make(map[string]string, len(s.Secrets))
 
 	for _, secret := range s.Secrets {
-		secrets[secret.Key] = secret.Value
+		value, err := secret.decrypt(keyring)
+		if err != nil {
+			return nil, err
+		}
+		secrets[secret.Key] = value
 	}
 
-	return secrets
+	return secrets, nil
+}
+
+// Hides the values of the source's secrets
+func (s *Source) MaskSecrets() *Source {
+	for i := range s.Secrets {
+		s.Secrets[i].Mask()
+	}
+	return s
 }
@@ -227,6 +227,53 @@ func TestPostgres_UpdateSource(t *testing.T) {
 	})
 }
 
+func TestPostgres_UpdateSource_ClearsFields(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources)
+		assert.NoError(err)
+
+		readOnly := true
+		s, err := db.GetSource(1)
+		assert.NoError(err)
+		s.MaxJobs = 2
+		s.Retries = 3
+		s.KeepJobs = 4
+		s.KeepDays = 5
+		s.Network = "isolated"
+		s.Security = SourceSecurity{User: "1000", ReadOnlyRootfs: &readOnly, CapDrop: []string{"ALL"}}
+		_, err = db.UpdateSource(s)
+		assert.NoError(err)
+
+		s, err = db.GetSource(1)
+		assert.NoError(err)
+		assert.Equal(2, s.MaxJobs)
+		assert.Equal("isolated", s.Network)
+		assert.Equal("1000", s.Security.User)
+
+		// every field can be set back to its zero value
+		s.MaxJobs = 0
+		s.Retries = 0
+		s.KeepJobs = 0
+		s.KeepDays = 0
+		s.Network = ""
+		s.Security = SourceSecurity{}
+		_, err = db.UpdateSource(s)
+		assert.NoError(err)
+
+		s, err = db.GetSource(1)
+		assert.NoError(err)
+		assert.Equal(0, s.MaxJobs)
+		assert.Equal(0, s.Retries)
+		assert.Equal(0, s.KeepJobs)
+		assert.Equal(0, s.KeepDays)
+		assert.Equal("", s.Network)
+		assert.Equal(SourceSecurity{}, s.Security)
+	})
+}
+
 func newSources() ([]*Source, error) {
 	var sources []*Source
 
@@ -262,3 +309,40 @@ func seedSources(db *Postgres) error {
 	}
 	return nil
 }
+
+func TestPostgres_UpdateSourceState(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedSources)
+		assert.NoError(err)
+
+		// the scheduler's copy of the source is older than the settings saved since
+		stale, err := db.GetSource(1)
+		assert.NoError(err)
+
+		s, err := db.GetSource(1)
+		assert.NoError(err)
+		s.MaxJobs = 2
+		s.Network = "isolated"
+		_, err = db.UpdateSource(s)
+		assert.NoError(err)
+
+		next := stale.NextTime.Add(time.Hour).Truncate(time.Second)
+		stale.State = ScheduleRunning
+		stale.NextTime = next
+		_, err = db.UpdateSourceState(stale)
+		assert.NoError(err)
+
+		s, err = db.GetSource(1)
+		assert.NoError(err)
+		assert.Equal(ScheduleRunning, s.State)
+		assert.True(next.Equal(s.NextTime))
+		assert.Equal(2, s.MaxJobs)
+		assert.Equal("isolated", s.Network)
+
+		_, err = db.UpdateSourceState(&Source{})
+		assert.Error(err)
+	})
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"nidavellir/libs"
+)
+
+const (
+	// Can view sources, jobs and their logs
+	ScopeRead = "read"
+	// Can also trigger and cancel jobs
+	ScopeTrigger = "trigger"
+	// Can also change sources, their secrets and notifications
+	ScopeWrite = "write"
+	// Can use every right of the account
+	ScopeAdmin = "admin"
+
+	// Prefix of every api token, which tells them apart from other bearer tokens
+	ApiTokenPrefix = "nida_"
+	// Validity of tokens created without an expiry
+	DefaultApiTokenExpiry = 90 * 24 * time.Hour
+)
+
+// The most privileged role which each scope allows
+var scopeRoles = map[string]string{
+	ScopeRead:    RoleViewer,
+	ScopeTrigger: RoleOperator,
+	ScopeWrite:   RoleEditor,
+	ScopeAdmin:   RoleAdmin,
+}
+
+// Gets the most privileged role allowed by the scopes. Returns an empty string if
+// none of the scopes are valid
+func ScopeRole(scopes []string) string {
+	role := ""
+	for _, s := range scopes {
+		if r, exists := scopeRoles[s]; exists {
+			if role == "" {
+				role = r
+			} else {
+				role = HigherRole(role, r)
+			}
+		}
+	}
+	return role
+}
+
+// Scopes is saved as a comma separated list
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+	default:
+		return errors.Errorf("could not convert %T to scopes", value)
+	}
+
+	*s = Scopes{}
+	for _, scope := range strings.Split(text, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+	return nil
+}
+
+// Token used by machine clients to call the api on behalf of an account. The rights
+// of the token are limited by both its scopes and the account's role
+type ApiToken struct {
+	Id        int    `json:"id"`
+	AccountId int    `json:"accountId"`
+	Name      string `json:"name"`
+	// sha256 hash of the token. The token itself is only returned when it is created
+	Hash      string     `json:"-"`
+	Scopes    Scopes     `json:"scopes"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	LastUsed  *time.Time `json:"lastUsed"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (t *ApiToken) Validate() error {
+	if t.AccountId <= 0 {
+		return errors.New("account id not specified")
+	}
+
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return errors.New("token name cannot be empty")
+	}
+
+	var scopes Scopes
+	for _, s := range t.Scopes {
+		s = libs.LowerTrim(s)
+		if _, exists := scopeRoles[s]; !exists {
+			return errors.Errorf("'%s' is not a valid scope. Use any of %s, %s, %s or %s", s, ScopeRead, ScopeTrigger, ScopeWrite, ScopeAdmin)
+		}
+		if !libs.IsIn(s, scopes) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return errors.New("token must have at least one scope")
+	}
+	t.Scopes = scopes
+
+	if t.ExpiresAt.IsZero() {
+		t.ExpiresAt = time.Now().Add(DefaultApiTokenExpiry)
+	} else if t.ExpiresAt.Before(time.Now()) {
+		return errors.New("token expiry must be in the future")
+	}
+
+	return nil
+}
+
+func (t *ApiToken) IsExpired() bool {
+	return !t.ExpiresAt.After(time.Now())
+}
+
+// Hashes the token for lookups. Tokens are random so a fast hash is sufficient
+func HashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateApiToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", errors.Wrap(err, "could not generate token")
+	}
+	return ApiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Creates an api token for the account. Returns the token, which is not saved and
+// can not be retrieved later
+func (p *Postgres) AddApiToken(token *ApiToken) (*ApiToken, string, error) {
+	token.Id = 0
+	token.LastUsed = nil
+	if err := token.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	value, err := generateApiToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token.Hash = HashApiToken(value)
+
+	if err := p.db.Create(token).Error; err != nil {
+		return nil, "", errors.Wrapf(err, "could not create token for account id %d", token.AccountId)
+	}
+	return token, value, nil
+}
+
+// Gets the api tokens of the account
+func (p *Postgres) GetApiTokens(accountId int) ([]*ApiToken, error) {
+	var tokens []*ApiToken
+	if err := p.db.Order("id").Find(&tokens, "account_id = ?", accountId).Error; err != nil {
+		return nil, errors.Wrapf(err, "could not get tokens of account id %d", accountId)
+	}
+	return tokens, nil
+}
+
+// Gets the api token given its value. Expired tokens are returned too, so the caller
+// must check the expiry
+func (p *Postgres) GetApiToken(value string) (*ApiToken, error) {
+	var token ApiToken
+	if err := p.db.First(&token, "hash = ?", HashApiToken(value)).Error; err != nil {
+		return nil, errors.Wrap(err, "could not find token")
+	}
+	return &token, nil
+}
+
+// Sets the time the token was last used to now
+func (p *Postgres) TouchApiToken(id int) error {
+	err := p.db.Model(&ApiToken{}).Where("id = ?", id).Update("last_used", time.Now()).Error
+	if err != nil {
+		return errors.Wrapf(err, "could not update last used time of token id %d", id)
+	}
+	return nil
+}
+
+// Removes the account's api token
+func (p *Postgres) RemoveApiToken(accountId, id int) error {
+	result := p.db.Where("account_id = ? AND id = ?", accountId, id).Delete(&ApiToken{})
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "could not remove token id %d", id)
+	} else if result.RowsAffected == 0 {
+		return errors.Errorf("account id %d has no token with id %d", accountId, id)
+	}
+	return nil
+}
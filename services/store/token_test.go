@@ -0,0 +1,92 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhui/dktest"
+	"github.com/stretchr/testify/require"
+
+	. "nidavellir/services/store"
+)
+
+func TestApiToken_Validate(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	for _, test := range []struct {
+		Token    ApiToken
+		Scopes   Scopes
+		HasError bool
+	}{
+		{ApiToken{AccountId: 1, Name: "ci", Scopes: Scopes{" Read ", "write", "read"}}, Scopes{ScopeRead, ScopeWrite}, false},
+		{ApiToken{AccountId: 1, Name: "ci", Scopes: Scopes{ScopeTrigger}, ExpiresAt: time.Now().Add(time.Hour)}, Scopes{ScopeTrigger}, false},
+		{ApiToken{AccountId: 1, Name: "ci", Scopes: Scopes{ScopeRead}, ExpiresAt: time.Now().Add(-time.Hour)}, nil, true},
+		{ApiToken{AccountId: 1, Name: "ci", Scopes: Scopes{"delete"}}, nil, true},
+		{ApiToken{AccountId: 1, Name: "ci"}, nil, true},
+		{ApiToken{AccountId: 1, Scopes: Scopes{ScopeRead}}, nil, true},
+		{ApiToken{Name: "ci", Scopes: Scopes{ScopeRead}}, nil, true},
+	} {
+		token := test.Token
+		err := token.Validate()
+		if test.HasError {
+			assert.Error(err)
+		} else {
+			assert.NoError(err)
+			assert.Equal(test.Scopes, token.Scopes)
+			assert.False(token.IsExpired())
+		}
+	}
+}
+
+func TestScopeRole(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	assert.Equal(RoleViewer, ScopeRole([]string{ScopeRead}))
+	assert.Equal(RoleEditor, ScopeRole([]string{ScopeRead, ScopeWrite, ScopeTrigger}))
+	assert.Equal(RoleAdmin, ScopeRole([]string{ScopeAdmin}))
+	assert.Equal("", ScopeRole([]string{"unknown"}))
+	assert.Equal(RoleViewer, LowerRole(RoleAdmin, RoleViewer))
+}
+
+func TestPostgres_ApiTokens(t *testing.T) {
+	t.Parallel()
+	assert := require.New(t)
+
+	dktest.Run(t, imageName, postgresImageOptions, func(t *testing.T, info dktest.ContainerInfo) {
+		db, err := newTestDb(info, seedAccounts)
+		assert.NoError(err)
+
+		user, err := db.GetAccount("user2")
+		assert.NoError(err)
+
+		token, value, err := db.AddApiToken(&ApiToken{AccountId: user.Id, Name: "ci", Scopes: Scopes{ScopeTrigger}})
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(value, ApiTokenPrefix))
+		assert.Equal(HashApiToken(value), token.Hash)
+		assert.NotEqual(value, token.Hash)
+
+		found, err := db.GetApiToken(value)
+		assert.NoError(err)
+		assert.Equal(token.Id, found.Id)
+		assert.Equal(Scopes{ScopeTrigger}, found.Scopes)
+		assert.Nil(found.LastUsed)
+
+		_, err = db.GetApiToken(value + "x")
+		assert.Error(err)
+
+		assert.NoError(db.TouchApiToken(token.Id))
+		tokens, err := db.GetApiTokens(user.Id)
+		assert.NoError(err)
+		assert.Len(tokens, 1)
+		assert.NotNil(tokens[0].LastUsed)
+
+		assert.Error(db.RemoveApiToken(user.Id+1, token.Id))
+		assert.NoError(db.RemoveApiToken(user.Id, token.Id))
+		tokens, err = db.GetApiTokens(user.Id)
+		assert.NoError(err)
+		assert.Len(tokens, 0)
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -87,7 +88,7 @@ func (s *System) Initialize() (option *store.DbOption) {
 }
 
 func (s *System) startDb(option *store.DbOption) error {
-	if result, err := container.Run(&container.RunOptions{
+	if result, err := container.Run(context.Background(), &container.RunOptions{
 		Image: "postgres",
 		Tag:   "12-alpine",
 		Name:  s.DatabaseName,
@@ -118,7 +119,7 @@ func (s *System) CleanUp() {
 }
 
 func (s *System) stopDb() error {
-	logs, err := container.Stop(&container.StopOptions{Name: s.DatabaseName, Port: s.DatabasePort, IgnoreNotFoundError: true})
+	logs, err := container.Stop(context.Background(), &container.StopOptions{Name: s.DatabaseName, Port: s.DatabasePort, IgnoreNotFoundError: true})
 	if err != nil {
 		return err
 	} else if len(logs) > 0 {